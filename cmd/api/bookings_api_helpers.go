@@ -42,6 +42,21 @@ func (pcb PassengerCarpoolBooking) ToBooking() *Booking {
 	}
 }
 
+// Booking performs a lossy conversion of the driver or passenger carpool
+// booking of a booking event to a Booking object
+func (e CarpoolBookingEvent) Booking() (*Booking, error) {
+	if dcb, err := e.Data.AsDriverCarpoolBooking(); err == nil {
+		return dcb.ToBooking(), nil
+	}
+
+	pcb, err := e.Data.AsPassengerCarpoolBooking()
+	if err != nil {
+		return nil, err
+	}
+
+	return pcb.ToBooking(), nil
+}
+
 // ToDriverCarpoolBooking performs a lossy conversion from
 // Booking to DriverCarpoolBooking objects
 func (b Booking) ToDriverCarpoolBooking() *DriverCarpoolBooking {
@@ -86,3 +101,43 @@ func (b Booking) toCarpoolBooking() CarpoolBooking {
 		WebUrl:                 *b.WebUrl,
 	}
 }
+
+// bookingStatusTransitions are the allowed transitions of the booking state
+// machine, from a status to the next ones. VALIDATED and CANCELLED are final
+// statuses.
+var bookingStatusTransitions = map[BookingStatus][]BookingStatus{
+	BookingStatusWAITINGCONFIRMATION:        {BookingStatusCONFIRMED, BookingStatusCANCELLED},
+	BookingStatusCONFIRMED:                  {BookingStatusCOMPLETEDPENDINGVALIDATION, BookingStatusCANCELLED},
+	BookingStatusCOMPLETEDPENDINGVALIDATION: {BookingStatusVALIDATED},
+	BookingStatusVALIDATED:                  {},
+	BookingStatusCANCELLED:                  {},
+}
+
+// BookingStatuses returns all booking statuses, in lifecycle order
+func BookingStatuses() []BookingStatus {
+	return []BookingStatus{
+		BookingStatusWAITINGCONFIRMATION,
+		BookingStatusCONFIRMED,
+		BookingStatusCOMPLETEDPENDINGVALIDATION,
+		BookingStatusVALIDATED,
+		BookingStatusCANCELLED,
+	}
+}
+
+// IsValid checks if a status is a known booking status
+func (s BookingStatus) IsValid() bool {
+	_, ok := bookingStatusTransitions[s]
+	return ok
+}
+
+// CanTransitionTo checks if a booking with status s can be updated to status
+// next, according to the booking state machine
+func (s BookingStatus) CanTransitionTo(next BookingStatus) bool {
+	for _, allowed := range bookingStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,4 @@
+package api
+
+// HeaderXAPIKey is the header holding the API key of a request
+const HeaderXAPIKey = "X-API-Key"
@@ -10,6 +10,7 @@ import (
 var (
 	ExampleOperator    = "example.com"
 	ExampleJourneyType = DYNAMIC
+	ExampleDuration    = 3600
 )
 
 // NewGetDriverJourneysParams returns query parameters, looking for a trip
@@ -47,10 +48,20 @@ func NewGetPassengerJourneysParams(
 func NewTrip() Trip {
 	t := Trip{}
 	t.Operator = ExampleOperator
+	t.Duration = ExampleDuration
 
 	return t
 }
 
+// NewUser returns a valid User
+func NewUser() User {
+	return User{
+		Id:       "1",
+		Alias:    "alias",
+		Operator: ExampleOperator,
+	}
+}
+
 // NewJourneySchedule returns a valid JourneySchedule
 func NewJourneySchedule() JourneySchedule {
 	js := JourneySchedule{}
@@ -64,6 +75,7 @@ func NewDriverJourney() DriverJourney {
 	dj := DriverJourney{}
 	dj.JourneySchedule = NewJourneySchedule()
 	dj.Trip = NewTrip()
+	dj.Driver = NewUser()
 
 	return dj
 }
@@ -73,6 +85,7 @@ func NewPassengerJourney() PassengerJourney {
 	pj := PassengerJourney{}
 	pj.JourneySchedule = NewJourneySchedule()
 	pj.Trip = NewTrip()
+	pj.Passenger = NewUser()
 
 	// despite being a pointer, DriverDepartureDate is required
 	departureDate := int64(0)
@@ -67,8 +67,17 @@ func makeEndpointCommandWithCustomRunner(runner test.TestRunner, endpoint endpoi
 			exitWithError(err)
 		}
 
-		err = runner.Run(endpoint.Method, URL, query, body, verbose, apiKey,
-			flagsWithDefault(defaultResponseCode))
+		startRecording()
+
+		flags := flagsWithDefault(defaultResponseCode)
+
+		if r, ok := runner.(test.OptionsRunner); ok {
+			err = r.RunWithOptions(endpoint.Method, URL, query, body, flags,
+				test.RunOptions{Verbose: verbose, Format: reportFormat, APIKey: apiKey})
+		} else {
+			err = runner.Run(endpoint.Method, URL, query, body, verbose, apiKey, flags)
+		}
+
 		exitWithError(err)
 	}
 
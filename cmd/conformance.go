@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"github.com/fabmob/playground-standard-covoiturage/cmd/test"
+	"github.com/spf13/cobra"
+)
+
+// conformanceCmd represents the conformance command
+var conformanceCmd = &cobra.Command{
+	Use:   "conformance",
+	Short: "Check the conformance of an API to the standard covoiturage",
+	Long: `Check the conformance of an API to the standard covoiturage.
+
+A built-in battery of requests is run against every endpoint of the standard:
+valid searches, invalid parameters, unknown booking ids, duplicate bookings,
+illegal status transitions, etc. Each request checks a requirement at MUST or
+SHOULD level, and a per-endpoint compliance matrix is printed.
+
+An API is compliant if all MUST requirements are met, and fully compliant if
+SHOULD requirements are met as well. The command fails if any MUST
+requirement is not met.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		suite, err := test.ConformanceSuite()
+		exitWithError(err)
+
+		suite.Server = server
+		suite.APIKey = apiKey
+		setSuiteVariables(suite)
+
+		err = test.RunConformance(suite, verbose, reportFormat)
+		exitWithError(err)
+	},
+}
+
+func init() {
+	conformanceCmd.Flags().StringVar(&server, "server", "", "Server to check")
+	conformanceCmd.Flags().StringVar(&apiKey, "auth", "", "API key sent in the \"X-API-Key\" header of the requests")
+	conformanceCmd.Flags().StringToStringVar(&suiteVariables, "var", nil, "Set a variable of the battery, e.g. --var operator=carpool.mycity.com")
+	conformanceCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Make the operation more talkative")
+	conformanceCmd.Flags().Var(
+		&reportFormat,
+		"report-format",
+		"Format of the report, either text (default), json or junit",
+	)
+
+	_ = conformanceCmd.MarkFlagRequired("server")
+
+	rootCmd.AddCommand(conformanceCmd)
+}
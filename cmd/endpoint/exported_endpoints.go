@@ -35,3 +35,8 @@ var (
 	// GetStatus is the of GET /status
 	GetStatus = New(http.MethodGet, "/status")
 )
+
+// All returns all endpoints of the standard
+func All() []Info {
+	return append([]Info{}, allEndpoints...)
+}
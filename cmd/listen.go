@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/test"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+// listenCmd represents the listen command
+var listenCmd = &cobra.Command{
+	Use:   "listen",
+	Short: "Receive and check booking events sent by an operator",
+	Long: `Receive and check booking events sent by an operator.
+
+An HTTP receiver is started for POST /booking_events. Each received
+CarpoolBookingEvent is validated against the specification. Its booking must
+be known (listed with --booking, or created by a previous event), or created
+by the event with status WAITING_CONFIRMATION, and its status must be a legal
+transition from the status of the previous event of the booking. A report is
+printed (or, with --report-format json or junit, a single report of all
+events at the end). Valid events are acknowledged with code 200, invalid ones
+are rejected with code 400.
+
+Events are received during the time window set with --window, or until SIGINT
+or SIGTERM if no window is set. The command fails if any event failed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		listenConfig.Address = fmt.Sprintf("%s:%d", listenHost, listenPort)
+		listenConfig.Verbose = verbose
+		listenConfig.Format = reportFormat
+
+		for _, id := range listenBookings {
+			bookingID, err := uuid.Parse(id)
+			if err != nil {
+				exitWithError(fmt.Errorf("invalid booking id %q: %w", id, err))
+			}
+
+			listenConfig.Bookings = append(listenConfig.Bookings, bookingID)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		err := test.Listen(ctx, listenConfig)
+		exitWithError(err)
+	},
+}
+
+// DefaultListenPort is the default port of the listen command
+const DefaultListenPort = 1324
+
+var (
+	listenConfig   test.ListenConfig
+	listenHost     string
+	listenPort     int
+	listenBookings []string
+)
+
+func init() {
+	listenCmd.Flags().StringVar(&listenHost, "host", "", "Host on which the receiver listens (all interfaces by default)")
+	listenCmd.Flags().IntVar(&listenPort, "port", DefaultListenPort, "Port on which the receiver listens")
+	listenCmd.Flags().StringVar(&listenConfig.BasePath, "basePath", "", "Prefix of the /booking_events path, e.g. /stdcov/v1")
+	listenCmd.Flags().DurationVar(
+		&listenConfig.Window,
+		"window",
+		0,
+		"Time during which events are received, e.g. 30s or 5m. If not set, events are received until interrupted",
+	)
+	listenCmd.Flags().StringSliceVar(
+		&listenBookings,
+		"booking",
+		nil,
+		"ID of a booking known before the receiver starts, whose events may have any status (repeatable)",
+	)
+	listenCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Make the operation more talkative")
+	listenCmd.Flags().Var(
+		&reportFormat,
+		"report-format",
+		"Format of the reports, either text (default), json or junit. With json and junit, a single report of all events is printed at the end",
+	)
+
+	rootCmd.AddCommand(listenCmd)
+}
@@ -28,7 +28,7 @@ func init() {}
 
 func exitWithError(err error) {
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
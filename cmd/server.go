@@ -9,16 +9,162 @@ import (
 var serveCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Serves a test API enforcing the standard covoitrage specification",
-	Long:  ``,
+	Long: `Serves a test API enforcing the standard covoitrage specification.
+
+If API keys are provided, requests without a valid key in the "X-API-Key"
+header are rejected with code 401, and bookings of other operators than the
+one bound to the key are rejected with code 403.
+
+If a webhook URL is provided, the MaaS platform served at this URL is sent a
+booking event on POST /booking_events each time a booking status changes
+through PATCH /bookings or the admin API.
+
+If an idToken secret or JWKS is provided, the idToken of booking events
+received on POST /booking_events is verified as a JWT: signature, expiry, and
+audience matching the operator served by the server, set with
+--idTokenAudience (operator.example.org by default, as in default data).
+Invalid tokens are rejected with code 401.
+
+If an admin key is provided, an admin API is served under /admin to upload,
+reset, snapshot and edit data at runtime.
+
+Bookings only change status on request by default. With --autoConfirm,
+--autoComplete and --autoCancelRate, created bookings are confirmed, completed
+or cancelled over time, as by a real operator. The MaaS platform is notified
+of these changes if a webhook is set.
+
+With --faults, faults are injected in the responses of the API to test the
+resilience of clients: latency, 500 and 503 errors, dropped connections,
+truncated bodies, wrong content types and 429 responses with Retry-After.
+Fault rules can be changed at runtime through the admin API.
+
+With --violate, the server deliberately breaks rules of the specification
+(e.g. --violate=departureRadius,duplicateIds), to check that "test" detects
+them. Unknown violations are rejected with the list of known ones.
+
+Data is stored in memory by default, and lost when the server stops. With
+--store, data is persisted in a json file.
+
+The server stops gracefully on SIGINT or SIGTERM.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		service.Run(dataFile)
+		if apiKeysFile != "" {
+			keys, err := service.ReadAPIKeysFile(apiKeysFile)
+			exitWithError(err)
+
+			serveConfig.APIKeys = keys
+		}
+
+		if faultsFile != "" {
+			rules, err := service.ReadFaultRulesFile(faultsFile)
+			exitWithError(err)
+
+			serveConfig.Faults = rules
+		}
+
+		for _, violation := range violations {
+			serveConfig.Violations = append(serveConfig.Violations, service.Violation(violation))
+		}
+
+		err := service.Run(serveConfig)
+		exitWithError(err)
 	},
 }
 
-var dataFile string
+var (
+	serveConfig = service.DefaultConfig()
+	apiKeysFile string
+	faultsFile  string
+	violations  []string
+)
 
 func init() {
-	serveCmd.Flags().StringVar(&dataFile, "data", "", "Path to custom initial data file")
+	serveCmd.Flags().StringVar(&serveConfig.DataFile, "data", "", "Path to custom initial data file")
+	serveCmd.Flags().StringVar(
+		&serveConfig.StoreFile,
+		"store",
+		"",
+		"Path to a json file where data is persisted (loaded from it if it exists, created with initial data otherwise). If not set, data is stored in memory",
+	)
+	serveCmd.Flags().StringVar(&serveConfig.Host, "host", "", "Host on which the server listens (all interfaces by default)")
+	serveCmd.Flags().IntVar(&serveConfig.Port, "port", service.DefaultPort, "Port on which the server listens")
+	serveCmd.Flags().StringVar(&serveConfig.TLSCertFile, "tlsCert", "", "Path to a TLS certificate file, to serve over HTTPS (requires --tlsKey)")
+	serveCmd.Flags().StringVar(&serveConfig.TLSKeyFile, "tlsKey", "", "Path to the private key of the TLS certificate")
+	serveCmd.Flags().StringVar(&serveConfig.BasePath, "basePath", "", "Prefix of all API paths, e.g. /stdcov/v1")
+	serveCmd.Flags().StringVar(
+		&serveConfig.AdminKey,
+		"adminKey",
+		"",
+		"Key of the admin API (in the \"X-Admin-Key\" header), to manage data at runtime. If not set, the admin API is disabled",
+	)
+	serveCmd.Flags().StringVar(
+		&serveConfig.WebhookURL,
+		"webhook",
+		"",
+		"Server URL of a MaaS platform, notified of booking status changes on its POST /booking_events endpoint",
+	)
+	serveCmd.Flags().StringVar(&serveConfig.WebhookAPIKey, "webhookAPIKey", "", "API key sent in the \"X-API-Key\" header of webhook notifications")
+	serveCmd.Flags().StringVar(
+		&serveConfig.WebhookIDTokenSecret,
+		"webhookIdTokenSecret",
+		"",
+		"Shared secret signing the idToken of webhook notifications (HS256 JWT, with the driver's operator as audience). Required with --webhook",
+	)
+	serveCmd.Flags().StringVar(
+		&serveConfig.IDTokenSecret,
+		"idTokenSecret",
+		"",
+		"Shared secret verifying the idToken of booking events (HS256, HS384 or HS512 JWT)",
+	)
+	serveCmd.Flags().StringVar(
+		&serveConfig.IDTokenJWKS,
+		"idTokenJWKS",
+		"",
+		"Path or URL of a JWKS verifying the idToken of booking events (RS* or ES* JWT)",
+	)
+	serveCmd.Flags().StringVar(
+		&serveConfig.IDTokenAudience,
+		"idTokenAudience",
+		service.DefaultOperator,
+		"Audience expected in the idToken of booking events: the operator served by the server",
+	)
+	serveCmd.Flags().DurationVar(
+		&serveConfig.Automation.ConfirmAfter,
+		"autoConfirm",
+		0,
+		"Delay after which bookings created with POST /bookings are confirmed, e.g. 10s. If not set, bookings are not confirmed automatically",
+	)
+	serveCmd.Flags().BoolVar(
+		&serveConfig.Automation.Complete,
+		"autoComplete",
+		false,
+		"Move confirmed bookings to COMPLETED_PENDING_VALIDATION after passengerPickupDate + duration",
+	)
+	serveCmd.Flags().Float64Var(
+		&serveConfig.Automation.CancelRate,
+		"autoCancelRate",
+		0,
+		"Probability (between 0 and 1) that a booking created with POST /bookings is cancelled (after the --autoConfirm delay) instead of confirmed",
+	)
+	serveCmd.Flags().StringVar(
+		&apiKeysFile,
+		"apiKeys",
+		"",
+		"Path to a json file mapping valid API keys to their operator (\"\" for any operator). If not set, requests are not authenticated",
+	)
+
+	serveCmd.Flags().StringVar(
+		&faultsFile,
+		"faults",
+		"",
+		"Path to a json file with rules injecting faults in the responses of endpoints (latency, errors, dropped connections, truncated bodies, wrong content types, 429)",
+	)
+
+	serveCmd.Flags().StringSliceVar(
+		&violations,
+		"violate",
+		nil,
+		"Rules of the specification deliberately broken by the server, to self-test the assertions of \"test\" (comma separated, e.g. departureRadius,duplicateIds)",
+	)
 
 	rootCmd.AddCommand(serveCmd)
 }
@@ -0,0 +1,357 @@
+package service
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/service/db"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// headerXAdminKey is the header holding the admin key of a request
+const headerXAdminKey = "X-Admin-Key"
+
+// adminPath is the prefix of admin routes, relative to the base path
+const adminPath = "/admin"
+
+// adminServer implements the admin API, used to manage the data of the
+// server at runtime. It is not part of the standard.
+type adminServer struct {
+	server *StdCovServerImpl
+	faults *Faults
+}
+
+// registerAdminHandlers registers the routes of the admin API under
+// basePath + "/admin". Requests are rejected with code 401 if the
+// "X-Admin-Key" header does not hold the admin key.
+func registerAdminHandlers(e *echo.Echo, server *StdCovServerImpl, faults *Faults, basePath, adminKey string) {
+	s := adminServer{server, faults}
+	g := e.Group(basePath+adminPath, adminKeyAuth(adminKey))
+
+	g.GET("/data", s.GetData)
+	g.PUT("/data", s.PutData)
+	g.POST("/reset", s.PostReset)
+
+	g.POST("/driver_journeys", s.PostDriverJourney)
+	g.DELETE("/driver_journeys/:operator/:id", s.DeleteDriverJourney)
+	g.POST("/passenger_journeys", s.PostPassengerJourney)
+	g.DELETE("/passenger_journeys/:operator/:id", s.DeletePassengerJourney)
+	g.POST("/users", s.PostUser)
+	g.DELETE("/users/:operator/:id", s.DeleteUser)
+	g.POST("/bookings", s.PostBooking)
+	g.PATCH("/bookings/:id", s.PatchBooking)
+	g.DELETE("/bookings/:id", s.DeleteBooking)
+	g.GET("/bookings/:id/history", s.GetBookingHistory)
+	g.GET("/messages", s.GetMessages)
+	g.GET("/webhook/deliveries", s.GetWebhookDeliveries)
+	g.GET("/faults", s.GetFaults)
+	g.PUT("/faults", s.PutFaults)
+}
+
+// adminKeyAuth returns a middleware rejecting requests without the admin key
+// with code 401
+func adminKeyAuth(adminKey string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			key := ctx.Request().Header.Get(headerXAdminKey)
+
+			if subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) != 1 {
+				return ctx.NoContent(http.StatusUnauthorized)
+			}
+
+			return next(ctx)
+		}
+	}
+}
+
+// isAdminPath checks if a route path belongs to the admin API
+func isAdminPath(path, basePath string) bool {
+	return strings.HasPrefix(path, basePath+adminPath+"/")
+}
+
+// GetData returns a snapshot of all data, in the format of data files.
+// (GET /admin/data)
+func (s adminServer) GetData(ctx echo.Context) error {
+	var b bytes.Buffer
+
+	if err := db.WriteData(s.server.db, &b); err != nil {
+		return err
+	}
+
+	return ctx.JSONBlob(http.StatusOK, b.Bytes())
+}
+
+// PutData replaces all data with the data of the request body, in the format
+// of data files.
+// (PUT /admin/data)
+func (s adminServer) PutData(ctx echo.Context) error {
+	var data db.MockDBDataInterface
+
+	if err := ctx.Bind(&data); err != nil {
+		return ctx.JSON(http.StatusBadRequest, errorBody(err))
+	}
+
+	return s.setData(ctx, data)
+}
+
+// PostReset replaces all data with default data.
+// (POST /admin/reset)
+func (s adminServer) PostReset(ctx echo.Context) error {
+	var data db.MockDBDataInterface
+
+	if err := json.Unmarshal(db.DefaultData, &data); err != nil {
+		return err
+	}
+
+	return s.setData(ctx, data)
+}
+
+func (s adminServer) setData(ctx echo.Context, data db.MockDBDataInterface) error {
+	if err := s.server.db.SetData(data); err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// PostDriverJourney adds a driver journey.
+// (POST /admin/driver_journeys)
+func (s adminServer) PostDriverJourney(ctx echo.Context) error {
+	var journey api.DriverJourney
+
+	return s.add(ctx, &journey, func() error { return s.server.db.AddDriverJourney(journey) })
+}
+
+// DeleteDriverJourney removes a driver journey.
+// (DELETE /admin/driver_journeys/{operator}/{id})
+func (s adminServer) DeleteDriverJourney(ctx echo.Context) error {
+	return s.remove(ctx, s.server.db.RemoveDriverJourney(ctx.Param("operator"), ctx.Param("id")))
+}
+
+// PostPassengerJourney adds a passenger journey.
+// (POST /admin/passenger_journeys)
+func (s adminServer) PostPassengerJourney(ctx echo.Context) error {
+	var journey api.PassengerJourney
+
+	return s.add(ctx, &journey, func() error { return s.server.db.AddPassengerJourney(journey) })
+}
+
+// DeletePassengerJourney removes a passenger journey.
+// (DELETE /admin/passenger_journeys/{operator}/{id})
+func (s adminServer) DeletePassengerJourney(ctx echo.Context) error {
+	return s.remove(ctx, s.server.db.RemovePassengerJourney(ctx.Param("operator"), ctx.Param("id")))
+}
+
+// PostUser adds a user.
+// (POST /admin/users)
+func (s adminServer) PostUser(ctx echo.Context) error {
+	var user api.User
+
+	return s.add(ctx, &user, func() error { return s.server.db.AddUser(user) })
+}
+
+// DeleteUser removes a user.
+// (DELETE /admin/users/{operator}/{id})
+func (s adminServer) DeleteUser(ctx echo.Context) error {
+	return s.remove(ctx, s.server.db.RemoveUser(ctx.Param("operator"), ctx.Param("id")))
+}
+
+// PostBooking adds a booking, with any status.
+// (POST /admin/bookings)
+func (s adminServer) PostBooking(ctx echo.Context) error {
+	var booking api.Booking
+
+	return s.add(ctx, &booking, func() error { return s.server.db.AddBooking(booking) })
+}
+
+// PatchBooking updates the status of a booking, given in the "status" query
+// parameter, with an optional "message" explaining the change. Status
+// transitions are checked as with PATCH /bookings, and the MaaS platform is
+// notified if a webhook is configured.
+// (PATCH /admin/bookings/{id})
+func (s adminServer) PatchBooking(ctx echo.Context) error {
+	bookingID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, errorBody(err))
+	}
+
+	change := db.StatusChange{
+		Status: api.BookingStatus(ctx.QueryParam("status")),
+		Source: db.StatusChangeSourceAdmin,
+	}
+
+	if message := ctx.QueryParam("message"); message != "" {
+		change.Message = &message
+	}
+
+	err = UpdateBookingStatus(s.server.db, bookingID, change)
+
+	var (
+		missing           db.MissingBookingErr
+		statusAlreadySet  StatusAlreadySetErr
+		illegalTransition IllegalTransitionErr
+	)
+
+	switch {
+	case err == nil:
+		s.server.webhook.NotifyStatusChange(s.server.db, bookingID)
+		return ctx.NoContent(http.StatusOK)
+
+	case errors.As(err, &missing):
+		return ctx.JSON(http.StatusNotFound, errorBody(err))
+
+	case errors.As(err, &statusAlreadySet), errors.As(err, &illegalTransition):
+		return ctx.JSON(http.StatusConflict, errorBody(err))
+
+	default:
+		return ctx.JSON(http.StatusBadRequest, errorBody(err))
+	}
+}
+
+// DeleteBooking removes a booking.
+// (DELETE /admin/bookings/{id})
+func (s adminServer) DeleteBooking(ctx echo.Context) error {
+	bookingID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, errorBody(err))
+	}
+
+	return s.remove(ctx, s.server.db.RemoveBooking(bookingID))
+}
+
+// GetBookingHistory returns the status changes of a booking, oldest first.
+// (GET /admin/bookings/{id}/history)
+func (s adminServer) GetBookingHistory(ctx echo.Context) error {
+	bookingID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, errorBody(err))
+	}
+
+	history, err := s.server.db.GetBookingHistory(bookingID)
+
+	var missing db.MissingBookingErr
+
+	switch {
+	case err == nil:
+		return ctx.JSON(http.StatusOK, history)
+
+	case errors.As(err, &missing):
+		return ctx.JSON(http.StatusNotFound, errorBody(err))
+
+	default:
+		return ctx.JSON(http.StatusInternalServerError, errorBody(err))
+	}
+}
+
+// GetMessages lists the messages received through POST /messages. They can be
+// filtered with query parameters "bookingId", "driverJourneyId" and
+// "passengerJourneyId".
+// (GET /admin/messages)
+func (s adminServer) GetMessages(ctx echo.Context) error {
+	var (
+		bookingID          = ctx.QueryParam("bookingId")
+		driverJourneyID    = ctx.QueryParam("driverJourneyId")
+		passengerJourneyID = ctx.QueryParam("passengerJourneyId")
+	)
+
+	messages := []api.PostMessagesJSONBody{}
+
+	for _, message := range s.server.db.GetMessages() {
+		if linkedTo(message.BookingId, bookingID) &&
+			linkedTo(message.DriverJourneyId, driverJourneyID) &&
+			linkedTo(message.PassengerJourneyId, passengerJourneyID) {
+			messages = append(messages, message)
+		}
+	}
+
+	return ctx.JSON(http.StatusOK, messages)
+}
+
+// linkedTo checks if a message link (booking or journey ID) matches the
+// expected ID. An empty expected ID matches any link.
+func linkedTo[ID any](link *ID, expectedID string) bool {
+	if expectedID == "" {
+		return true
+	}
+
+	return link != nil && fmt.Sprint(*link) == expectedID
+}
+
+// GetWebhookDeliveries returns the log of booking events sent to the MaaS
+// platform, or an empty list if no webhook is configured.
+// (GET /admin/webhook/deliveries)
+func (s adminServer) GetWebhookDeliveries(ctx echo.Context) error {
+	deliveries := []Delivery{}
+
+	if s.server.webhook != nil {
+		deliveries = s.server.webhook.Deliveries()
+	}
+
+	return ctx.JSON(http.StatusOK, deliveries)
+}
+
+// add binds the request body to item, and adds it with addFunc. Returns code
+// 201 with the item on success, 400 if the body is invalid or the item
+// already exists.
+func (s adminServer) add(ctx echo.Context, item interface{}, addFunc func() error) error {
+	if err := ctx.Bind(item); err != nil {
+		return ctx.JSON(http.StatusBadRequest, errorBody(err))
+	}
+
+	if err := addFunc(); err != nil {
+		return ctx.JSON(http.StatusBadRequest, errorBody(err))
+	}
+
+	return ctx.JSON(http.StatusCreated, item)
+}
+
+// remove returns code 204 if removal is successful, 404 if the item is not
+// found.
+func (s adminServer) remove(ctx echo.Context, err error) error {
+	var (
+		missingJourney db.MissingJourneyErr
+		missingUser    db.MissingUserErr
+		missingBooking db.MissingBookingErr
+	)
+
+	switch {
+	case err == nil:
+		return ctx.NoContent(http.StatusNoContent)
+
+	case errors.As(err, &missingJourney), errors.As(err, &missingUser),
+		errors.As(err, &missingBooking):
+		return ctx.JSON(http.StatusNotFound, errorBody(err))
+
+	default:
+		return err
+	}
+}
+
+// GetFaults returns the fault rules of the server.
+// (GET /admin/faults)
+func (s adminServer) GetFaults(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, s.faults.Rules())
+}
+
+// PutFaults replaces the fault rules of the server with the rules of the
+// body. An empty list disables fault injection.
+// (PUT /admin/faults)
+func (s adminServer) PutFaults(ctx echo.Context) error {
+	rules, err := ReadFaultRules(ctx.Request().Body)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, errorBody(err))
+	}
+
+	if err := s.faults.SetRules(rules); err != nil {
+		return ctx.JSON(http.StatusBadRequest, errorBody(err))
+	}
+
+	return ctx.JSON(http.StatusOK, s.faults.Rules())
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/service/db"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
+)
+
+const adminKey = "admin-key"
+
+func adminRequest(t *testing.T, server *httptest.Server, method, path, key string, body interface{}) (int, []byte) {
+	t.Helper()
+
+	var reqBody io.Reader = http.NoBody
+
+	if body != nil {
+		b, err := json.Marshal(body)
+		util.PanicIf(err)
+
+		reqBody = bytes.NewReader(b)
+	}
+
+	request, err := http.NewRequest(method, server.URL+path, reqBody)
+	util.PanicIf(err)
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(headerXAdminKey, key)
+
+	response, err := http.DefaultClient.Do(request)
+	util.PanicIf(err)
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(response.Body)
+	util.PanicIf(err)
+
+	return response.StatusCode, responseBody
+}
+
+func TestAdminAPI(t *testing.T) {
+	mockDB := db.NewMockDB()
+	config := Config{AdminKey: adminKey, APIKeys: APIKeys{keyAnyOperator: ""}}
+
+	server := httptest.NewServer(newEcho(NewServerWithDB(mockDB), config))
+	defer server.Close()
+
+	var (
+		user             = makeUserWithOperator("user", "alias", operatorA)
+		booking          = makeBooking(repUUID(600))
+		driverJourney    = api.DriverJourney{}
+		passengerJourney = api.PassengerJourney{}
+		journeyID        = "journey"
+	)
+
+	driverJourney.Id = &journeyID
+	driverJourney.Operator = operatorA
+	passengerJourney.Id = &journeyID
+	passengerJourney.Operator = operatorA
+
+	testCases := []struct {
+		name         string
+		method       string
+		path         string
+		key          string
+		body         interface{}
+		expectedCode int
+	}{
+		{"missing admin key", http.MethodGet, "/admin/data", "", nil, http.StatusUnauthorized},
+		{"API key is not an admin key", http.MethodGet, "/admin/data", keyAnyOperator, nil, http.StatusUnauthorized},
+		{"add user", http.MethodPost, "/admin/users", adminKey, user, http.StatusCreated},
+		{"add existing user", http.MethodPost, "/admin/users", adminKey, user, http.StatusBadRequest},
+		{"add driver journey", http.MethodPost, "/admin/driver_journeys", adminKey, driverJourney, http.StatusCreated},
+		{"add existing driver journey", http.MethodPost, "/admin/driver_journeys", adminKey, driverJourney, http.StatusBadRequest},
+		{"add passenger journey", http.MethodPost, "/admin/passenger_journeys", adminKey, passengerJourney, http.StatusCreated},
+		{"add booking", http.MethodPost, "/admin/bookings", adminKey, booking, http.StatusCreated},
+		{"add invalid booking", http.MethodPost, "/admin/bookings", adminKey, "booking", http.StatusBadRequest},
+		{"remove user", http.MethodDelete, "/admin/users/" + operatorA + "/user", adminKey, nil, http.StatusNoContent},
+		{"remove missing user", http.MethodDelete, "/admin/users/" + operatorA + "/user", adminKey, nil, http.StatusNotFound},
+		{"remove driver journey", http.MethodDelete, "/admin/driver_journeys/" + operatorA + "/journey", adminKey, nil, http.StatusNoContent},
+		{"remove passenger journey of other operator", http.MethodDelete, "/admin/passenger_journeys/" + operatorB + "/journey", adminKey, nil, http.StatusNotFound},
+		{"remove booking with invalid id", http.MethodDelete, "/admin/bookings/1234", adminKey, nil, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, body := adminRequest(t, server, tc.method, tc.path, tc.key, tc.body)
+
+			if code != tc.expectedCode {
+				t.Errorf("expected status code %d, got %d (%s)", tc.expectedCode, code, body)
+			}
+		})
+	}
+
+	if len(mockDB.GetUsers()) != 0 || len(mockDB.GetDriverJourneys()) != 0 ||
+		len(mockDB.GetPassengerJourneys()) != 1 {
+		t.Errorf("unexpected data after admin requests: %+v", mockDB.Data())
+	}
+
+	// Added booking is served by the standard API
+	request, err := http.NewRequest(http.MethodGet, server.URL+"/bookings/"+booking.Id.String(), nil)
+	util.PanicIf(err)
+	request.Header.Set(api.HeaderXAPIKey, keyAnyOperator)
+
+	response, err := http.DefaultClient.Do(request)
+	util.PanicIf(err)
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("expected added booking to be served, got status code %d", response.StatusCode)
+	}
+}
+
+func TestAdminData(t *testing.T) {
+	mockDB := db.NewMockDB()
+
+	server := httptest.NewServer(newEcho(NewServerWithDB(mockDB), Config{AdminKey: adminKey}))
+	defer server.Close()
+
+	data := db.MockDBDataInterface{
+		Users:    []api.User{makeUser("user", "alias")},
+		Bookings: []*api.Booking{makeBooking(repUUID(601))},
+	}
+
+	if code, body := adminRequest(t, server, http.MethodPut, "/admin/data", adminKey, data); code != http.StatusNoContent {
+		t.Fatalf("upload: expected status code %d, got %d (%s)", http.StatusNoContent, code, body)
+	}
+
+	code, body := adminRequest(t, server, http.MethodGet, "/admin/data", adminKey, nil)
+	if code != http.StatusOK {
+		t.Fatalf("snapshot: expected status code %d, got %d", http.StatusOK, code)
+	}
+
+	var snapshot db.MockDBDataInterface
+	util.PanicIf(json.Unmarshal(body, &snapshot))
+
+	if len(snapshot.Users) != 1 || len(snapshot.Bookings) != 1 || len(snapshot.DriverJourneys) != 0 {
+		t.Errorf("snapshot does not match uploaded data: %s", body)
+	}
+
+	if code, _ := adminRequest(t, server, http.MethodPost, "/admin/reset", adminKey, nil); code != http.StatusNoContent {
+		t.Fatalf("reset: expected status code %d, got %d", http.StatusNoContent, code)
+	}
+
+	defaultDB := db.NewMockDBWithDefaultData()
+	if len(mockDB.GetDriverJourneys()) != len(defaultDB.GetDriverJourneys()) ||
+		len(mockDB.GetBookings()) != len(defaultDB.GetBookings()) {
+		t.Error("data should be reset to default data")
+	}
+}
+
+func TestAdminAPIDisabled(t *testing.T) {
+	server := httptest.NewServer(newEcho(NewServer(), Config{}))
+	defer server.Close()
+
+	if code, _ := adminRequest(t, server, http.MethodGet, "/admin/data", "", nil); code != http.StatusNotFound {
+		t.Errorf("admin API should not be served without admin key, got status code %d", code)
+	}
+}
+
+func TestAdminMessages(t *testing.T) {
+	var (
+		alice     = makeUser("1", "alice")
+		bob       = makeUser("2", "bob")
+		bookingID = repUUID(602)
+		journeyID = "journey"
+	)
+
+	mockDB := db.NewMockDB()
+	mockDB.Users = []api.User{alice, bob}
+
+	server := httptest.NewServer(newEcho(NewServerWithDB(mockDB), Config{AdminKey: adminKey}))
+	defer server.Close()
+
+	bookingMessage := makeMessage(alice, bob)
+	bookingMessage.BookingId = &bookingID
+
+	journeyMessage := makeMessage(bob, alice)
+	journeyMessage.DriverJourneyId = &journeyID
+
+	for _, message := range []api.PostMessagesJSONBody{bookingMessage, journeyMessage} {
+		if code, body := adminRequest(t, server, http.MethodPost, "/messages", "", message); code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d (%s)", http.StatusCreated, code, body)
+		}
+	}
+
+	testCases := []struct {
+		query            string
+		expectedMessages int
+	}{
+		{"", 2},
+		{"?bookingId=" + bookingID.String(), 1},
+		{"?driverJourneyId=" + journeyID, 1},
+		{"?passengerJourneyId=" + journeyID, 0},
+		{"?bookingId=" + bookingID.String() + "&driverJourneyId=" + journeyID, 0},
+	}
+
+	for _, tc := range testCases {
+		code, body := adminRequest(t, server, http.MethodGet, "/admin/messages"+tc.query, adminKey, nil)
+		if code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, code)
+		}
+
+		var messages []api.PostMessagesJSONBody
+		util.PanicIf(json.Unmarshal(body, &messages))
+
+		if len(messages) != tc.expectedMessages {
+			t.Errorf("query %q: expected %d messages, got %d", tc.query, tc.expectedMessages, len(messages))
+		}
+	}
+
+	if len(mockDB.Data().Messages) != 2 {
+		t.Error("messages should be included in data snapshots")
+	}
+}
+
+func TestAdminBookingHistory(t *testing.T) {
+	mockDB := db.NewMockDB()
+	mockDB.Bookings = NewBookingsByID(makeBooking(repUUID(603)))
+
+	server := httptest.NewServer(newEcho(NewServerWithDB(mockDB), Config{AdminKey: adminKey}))
+	defer server.Close()
+
+	bookingPath := "/bookings/" + repUUID(603).String()
+
+	statusChanges := []struct {
+		path string
+		key  string
+	}{
+		{bookingPath + "?status=CONFIRMED&message=Driver%20accepted", ""},
+		{"/admin" + bookingPath + "?status=CANCELLED&message=Passenger%20is%20sick", adminKey},
+	}
+
+	for _, change := range statusChanges {
+		if code, body := adminRequest(t, server, http.MethodPatch, change.path, change.key, nil); code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d (%s)", http.StatusOK, code, body)
+		}
+	}
+
+	code, body := adminRequest(t, server, http.MethodGet, "/admin"+bookingPath+"/history", adminKey, nil)
+	if code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d (%s)", http.StatusOK, code, body)
+	}
+
+	var history []db.StatusChange
+	util.PanicIf(json.Unmarshal(body, &history))
+
+	if len(history) != 2 {
+		t.Fatalf("expected 2 status changes, got %d", len(history))
+	}
+
+	if history[0].Source != db.StatusChangeSourcePatch ||
+		history[0].Message == nil || *history[0].Message != "Driver accepted" {
+		t.Errorf("unexpected first status change %+v", history[0])
+	}
+
+	if history[1].Source != db.StatusChangeSourceAdmin || history[1].From != api.BookingStatusCONFIRMED ||
+		history[1].Status != api.BookingStatusCANCELLED ||
+		history[1].Message == nil || *history[1].Message != "Passenger is sick" {
+		t.Errorf("unexpected second status change %+v", history[1])
+	}
+
+	for path, expectedCode := range map[string]int{
+		"/admin/bookings/" + repUUID(604).String() + "/history": http.StatusNotFound,
+		"/admin/bookings/1234/history":                          http.StatusBadRequest,
+	} {
+		if code, body := adminRequest(t, server, http.MethodGet, path, adminKey, nil); code != expectedCode {
+			t.Errorf("%s: expected status code %d, got %d (%s)", path, expectedCode, code, body)
+		}
+	}
+}
@@ -12,22 +12,34 @@ import (
 // StdCovServerImpl implements server.ServerInterface
 type StdCovServerImpl struct {
 	db db.DB
+
+	// webhook notifies the MaaS platform of booking status changes. Disabled
+	// if nil.
+	webhook *Webhook
+
+	// idTokenVerifier verifies the idToken of booking events. Disabled if
+	// nil.
+	idTokenVerifier *IDTokenVerifier
+
+	// automation changes the status of created bookings over time. Disabled
+	// if nil.
+	automation *Automation
 }
 
 func NewServer() *StdCovServerImpl {
-	server := StdCovServerImpl{db.NewMockDB()}
+	server := StdCovServerImpl{db: db.NewMockDB()}
 	return &server
 }
 
 func NewServerWithDB(mockDB db.DB) *StdCovServerImpl {
-	server := StdCovServerImpl{mockDB}
+	server := StdCovServerImpl{db: mockDB}
 	return &server
 }
 
 // NewDefaultServer returns a server, and populates the associated DB with
 // default data
 func NewDefaultServer() *StdCovServerImpl {
-	server := StdCovServerImpl{db.NewMockDBWithDefaultData()}
+	server := StdCovServerImpl{db: db.NewMockDBWithDefaultData()}
 	return &server
 }
 
@@ -54,21 +66,46 @@ func (s *StdCovServerImpl) PostBookingEvents(ctx echo.Context) error {
 		)
 	}
 
+	if err := checkBookingOperator(ctx, &newBooking); err != nil {
+		return ctx.JSON(http.StatusForbidden, errorBody(err))
+	}
+
+	if booking, err := s.db.GetBooking(newBooking.Id); err == nil {
+		if err := checkBookingOperator(ctx, booking); err != nil {
+			return ctx.JSON(http.StatusForbidden, errorBody(err))
+		}
+	}
+
+	if s.idTokenVerifier != nil {
+		err := s.idTokenVerifier.Verify(newEvent.IdToken)
+		if err != nil {
+			return ctx.JSON(http.StatusUnauthorized, errorBody(err))
+		}
+	}
+
 	// Try to add booking
 	alreadyExistsErr := s.db.AddBooking(newBooking)
 
 	// If booking exists, try to update status
 	if alreadyExistsErr != nil {
-		err := UpdateBookingStatus(s.db, newBooking.Id, newBooking.Status)
+		err := UpdateBookingStatus(s.db, newBooking.Id, db.StatusChange{
+			Status: newBooking.Status,
+			Source: db.StatusChangeSourceBookingEvent,
+		})
 
 		if err != nil {
 			var missing db.MissingBookingErr
+			var statusAlreadySet StatusAlreadySetErr
+			var illegalTransition IllegalTransitionErr
 
 			switch {
 			case errors.As(err, &missing):
 				// should not happen
 				return ctx.NoContent(http.StatusInternalServerError)
 
+			case errors.As(err, &statusAlreadySet), errors.As(err, &illegalTransition):
+				return ctx.JSON(http.StatusConflict, errorBody(err))
+
 			default:
 				return ctx.JSON(http.StatusBadRequest, errorBody(err))
 			}
@@ -89,11 +126,17 @@ func (s *StdCovServerImpl) PostBookings(ctx echo.Context) error {
 		return ctx.JSON(http.StatusBadRequest, errorBody(bodyUnmarshallingErr))
 	}
 
+	if err := checkBookingOperator(ctx, &newBooking); err != nil {
+		return ctx.JSON(http.StatusForbidden, errorBody(err))
+	}
+
 	alreadyExistsErr := s.db.AddBooking(newBooking)
 	if alreadyExistsErr != nil {
 		return ctx.JSON(http.StatusBadRequest, errorBody(alreadyExistsErr))
 	}
 
+	s.automation.BookingCreated(newBooking.Id)
+
 	return ctx.JSON(http.StatusCreated, newBooking)
 }
 
@@ -111,6 +154,10 @@ func (s *StdCovServerImpl) GetBookings(ctx echo.Context, bookingID api.BookingId
 		return ctx.JSON(http.StatusNotFound, errorBody(missingErr))
 	}
 
+	if err := checkBookingOperator(ctx, booking); err != nil {
+		return ctx.JSON(http.StatusForbidden, errorBody(err))
+	}
+
 	return ctx.JSON(http.StatusOK, booking)
 }
 
@@ -119,17 +166,28 @@ func (s *StdCovServerImpl) GetBookings(ctx echo.Context, bookingID api.BookingId
 func (s *StdCovServerImpl) PatchBookings(ctx echo.Context, bookingID api.BookingId,
 	params api.PatchBookingsParams) error {
 
-	err := UpdateBookingStatus(s.db, bookingID, params.Status)
+	if booking, err := s.db.GetBooking(bookingID); err == nil {
+		if err := checkBookingOperator(ctx, booking); err != nil {
+			return ctx.JSON(http.StatusForbidden, errorBody(err))
+		}
+	}
+
+	err := UpdateBookingStatus(s.db, bookingID, db.StatusChange{
+		Status:  params.Status,
+		Message: params.Message,
+		Source:  db.StatusChangeSourcePatch,
+	})
 
 	if err != nil {
 		var missing db.MissingBookingErr
 		var statusAlreadySet StatusAlreadySetErr
+		var illegalTransition IllegalTransitionErr
 
 		switch {
 		case errors.As(err, &missing):
 			return ctx.JSON(http.StatusNotFound, errorBody(err))
 
-		case errors.As(err, &statusAlreadySet):
+		case errors.As(err, &statusAlreadySet), errors.As(err, &illegalTransition):
 			return ctx.JSON(http.StatusConflict, errorBody(err))
 
 		default:
@@ -137,6 +195,8 @@ func (s *StdCovServerImpl) PatchBookings(ctx echo.Context, bookingID api.Booking
 		}
 	}
 
+	s.webhook.NotifyStatusChange(s.db, bookingID)
+
 	return ctx.NoContent(http.StatusOK)
 }
 
@@ -206,6 +266,10 @@ func (s *StdCovServerImpl) PostMessages(ctx echo.Context) error {
 		return ctx.JSON(http.StatusNotFound, errorBody(errors.New("missing_user")))
 	}
 
+	if err := s.db.AddMessage(message); err != nil {
+		return err
+	}
+
 	return ctx.NoContent(http.StatusCreated)
 }
 
@@ -2,10 +2,15 @@ package service
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
@@ -13,6 +18,7 @@ import (
 	"github.com/fabmob/playground-standard-covoiturage/cmd/test"
 	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
 	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
 )
 
 func init() {
@@ -313,6 +319,43 @@ func TestGetDriverRegularTrips(t *testing.T) {
 	}
 }
 
+func TestKeepScheduleAcrossMidnight(t *testing.T) {
+	var (
+		weekdays  = []string{"MON"}
+		timeDelta = 3600
+	)
+
+	params := &api.GetDriverRegularTripsParams{
+		DepartureTimeOfDay: "23:30:00",
+		DepartureWeekdays:  &weekdays,
+		TimeDelta:          &timeDelta,
+	}
+
+	testCases := []struct {
+		timeOfDay string
+		expected  bool
+	}{
+		{"23:00:00", true},
+		{"00:15:00", true},
+		{"00:30:00", true},
+		{"00:30:01", false},
+		{"12:00:00", false},
+	}
+
+	for _, tc := range testCases {
+		pickupDay := api.SchedulePassengerPickupDay("MON")
+		timeOfDay := tc.timeOfDay
+		schedule := api.Schedule{PassengerPickupDay: &pickupDay, PassengerPickupTimeOfDay: &timeOfDay}
+
+		keep, err := keepSchedule(params, schedule)
+		util.PanicIf(err)
+
+		if keep != tc.expected {
+			t.Errorf("schedule at %s: expected kept %t, got %t", tc.timeOfDay, tc.expected, keep)
+		}
+	}
+}
+
 func TestGetPassengerRegularTrips(t *testing.T) {
 	testCases := []passengerRegularTripsTestCase{}
 
@@ -473,29 +516,77 @@ func TestPatchBookings(t *testing.T) {
 		expectedStatus          api.BookingStatus
 	}{
 		{
-			"patching VALIDATED over WAITING_CONFIRMATION succeeds",
+			"patching VALIDATED over WAITING_CONFIRMATION fails with code 409",
 			repUUID(20),
 			api.BookingStatusVALIDATED,
 			NewBookingsByID(
 				makeBooking(repUUID(20)),
 			),
+			http.StatusConflict,
 			http.StatusOK,
-			http.StatusOK,
-			api.BookingStatusVALIDATED,
+			api.BookingStatusWAITINGCONFIRMATION,
 		},
 
 		{
-			"patching COMPLETED_PENDING_VALIDATION over WAITING_CONFIRMATION succeeds",
+			"patching COMPLETED_PENDING_VALIDATION over WAITING_CONFIRMATION fails with code 409",
 			repUUID(21),
 			api.BookingStatusCOMPLETEDPENDINGVALIDATION,
 			NewBookingsByID(
 				makeBooking(repUUID(21)),
 			),
+			http.StatusConflict,
+			http.StatusOK,
+			api.BookingStatusWAITINGCONFIRMATION,
+		},
+
+		{
+			"patching COMPLETED_PENDING_VALIDATION over CONFIRMED succeeds",
+			repUUID(26),
+			api.BookingStatusCOMPLETEDPENDINGVALIDATION,
+			NewBookingsByID(
+				makeBookingWithStatus(repUUID(26), api.BookingStatusCONFIRMED),
+			),
 			http.StatusOK,
 			http.StatusOK,
 			api.BookingStatusCOMPLETEDPENDINGVALIDATION,
 		},
 
+		{
+			"patching VALIDATED over COMPLETED_PENDING_VALIDATION succeeds",
+			repUUID(27),
+			api.BookingStatusVALIDATED,
+			NewBookingsByID(
+				makeBookingWithStatus(repUUID(27), api.BookingStatusCOMPLETEDPENDINGVALIDATION),
+			),
+			http.StatusOK,
+			http.StatusOK,
+			api.BookingStatusVALIDATED,
+		},
+
+		{
+			"patching CANCELLED over CONFIRMED succeeds",
+			repUUID(28),
+			api.BookingStatusCANCELLED,
+			NewBookingsByID(
+				makeBookingWithStatus(repUUID(28), api.BookingStatusCONFIRMED),
+			),
+			http.StatusOK,
+			http.StatusOK,
+			api.BookingStatusCANCELLED,
+		},
+
+		{
+			"patching CANCELLED over VALIDATED fails with code 409",
+			repUUID(29),
+			api.BookingStatusCANCELLED,
+			NewBookingsByID(
+				makeBookingWithStatus(repUUID(29), api.BookingStatusVALIDATED),
+			),
+			http.StatusConflict,
+			http.StatusOK,
+			api.BookingStatusVALIDATED,
+		},
+
 		{
 			"patching a non-existing booking returns code 404",
 			repUUID(22),
@@ -564,6 +655,161 @@ func TestPatchBookings(t *testing.T) {
 	}
 }
 
+func TestExpectTransitionsEnforced(t *testing.T) {
+	for _, violate := range []bool{false, true} {
+		mockDB := db.NewMockDB()
+		mockDB.Bookings = NewBookingsByID(makeBooking(repUUID(750)))
+
+		config := Config{}
+		if violate {
+			config.Violations = []Violation{ViolationTransitions}
+		}
+
+		server := httptest.NewServer(newEcho(NewServerWithDB(mockDB), config))
+		defer server.Close()
+
+		flags := test.NewFlags()
+		flags.ExpectTransitionsEnforced = true
+
+		query := test.NewQuery()
+		query.Params["status"] = string(api.BookingStatusCONFIRMED)
+
+		err := test.RunTest(http.MethodPatch, server.URL+"/bookings/"+repUUID(750).String(), query, nil,
+			false, "", flags)
+		if (err != nil) != violate {
+			t.Errorf("violated: %t, got error %v", violate, err)
+		}
+
+		// Illegal transitions are probed on a copy of the booking
+		booking, err := mockDB.GetBooking(repUUID(750))
+		util.PanicIf(err)
+
+		if booking.Status != api.BookingStatusCONFIRMED {
+			t.Errorf("expected status %s after probing illegal transitions, got %s",
+				api.BookingStatusCONFIRMED, booking.Status)
+		}
+
+		if len(mockDB.Bookings) != 2 {
+			t.Errorf("expected a copy of the booking, got %d booking(s)", len(mockDB.Bookings))
+		}
+	}
+}
+
+func TestBookingLifecycleScenario(t *testing.T) {
+	e := echo.New()
+	api.RegisterHandlers(e, NewServerWithDB(db.NewMockDB()))
+
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	suite, err := test.Scenario("booking_lifecycle")
+	util.PanicIf(err)
+
+	suite.Server = server.URL
+
+	if err := test.RunSuite(suite, false, test.ReportText); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	e := echo.New()
+	api.RegisterHandlers(e, NewServerWithDB(db.NewMockDBWithDefaultData()))
+
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	suite, err := test.ConformanceSuite()
+	util.PanicIf(err)
+
+	suite.Server = server.URL
+
+	if err := test.RunConformance(suite, false, test.ReportText); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConcurrentBookingRequests(t *testing.T) {
+	const n = 50
+
+	mockDB := db.NewMockDB()
+	bookingID := repUUID(400)
+	mockDB.Bookings = NewBookingsByID(makeBooking(bookingID))
+
+	server := httptest.NewServer(newEcho(NewServerWithDB(mockDB), Config{}))
+	defer server.Close()
+
+	var (
+		wg          sync.WaitGroup
+		patchCodes  = make(chan int, n)
+		patchURL    = fmt.Sprintf("%s/bookings/%s?status=%s", server.URL, bookingID, api.BookingStatusCONFIRMED)
+		requestDone = func(response *http.Response, err error) int {
+			util.PanicIf(err)
+			response.Body.Close()
+
+			return response.StatusCode
+		}
+	)
+
+	for i := 0; i < n; i++ {
+		wg.Add(3)
+
+		// repUUID is not safe for concurrent use
+		body, err := json.Marshal(makeBooking(repUUID(int64(500 + i))))
+		util.PanicIf(err)
+
+		go func() {
+			defer wg.Done()
+
+			code := requestDone(http.Post(server.URL+"/bookings", echo.MIMEApplicationJSON, bytes.NewReader(body)))
+			if code != http.StatusCreated {
+				t.Errorf("expected status code %d, got %d", http.StatusCreated, code)
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			req, err := http.NewRequest(http.MethodPatch, patchURL, nil)
+			util.PanicIf(err)
+
+			patchCodes <- requestDone(http.DefaultClient.Do(req))
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			code := requestDone(http.Get(fmt.Sprintf("%s/bookings/%s", server.URL, bookingID)))
+			if code != http.StatusOK {
+				t.Errorf("expected status code %d, got %d", http.StatusOK, code)
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(patchCodes)
+
+	var confirmed int
+
+	for code := range patchCodes {
+		switch code {
+		case http.StatusOK:
+			confirmed++
+		case http.StatusConflict:
+		default:
+			t.Errorf("unexpected status code %d", code)
+		}
+	}
+
+	if confirmed != 1 {
+		t.Errorf("expected a single successful status update, got %d", confirmed)
+	}
+
+	if got := len(mockDB.GetBookings()); got != n+1 {
+		t.Errorf("expected %d bookings, got %d", n+1, got)
+	}
+}
+
 func TestPostBookingEvents(t *testing.T) {
 
 	testCases := []struct {
@@ -596,24 +842,34 @@ func TestPostBookingEvents(t *testing.T) {
 		},
 
 		{
-			"posting a bookingEvent on existing booking (status CONFIRMED over CONFIRMED) fails with code 400",
+			"posting a bookingEvent on existing booking (status CONFIRMED over CONFIRMED) fails with code 409",
 			repUUID(34),
 			makeCarpoolBookingEventWithStatus(repUUID(35), repUUID(34), api.BookingStatusCONFIRMED),
 			NewBookingsByID(makeBookingWithStatus(repUUID(34), api.BookingStatusCONFIRMED)),
-			http.StatusBadRequest,
+			http.StatusConflict,
 			http.StatusOK,
 			api.BookingStatusCONFIRMED,
 		},
 
 		{
-			"posting a bookingEvent on existing booking (status CONFIRMED over CANCELLED) fails with code 400",
+			"posting a bookingEvent on existing booking (status CONFIRMED over CANCELLED) fails with code 409",
 			repUUID(36),
 			makeCarpoolBookingEventWithStatus(repUUID(37), repUUID(36), api.BookingStatusCONFIRMED),
 			NewBookingsByID(makeBookingWithStatus(repUUID(36), api.BookingStatusCANCELLED)),
-			http.StatusBadRequest,
+			http.StatusConflict,
 			http.StatusOK,
 			api.BookingStatusCANCELLED,
 		},
+
+		{
+			"posting a bookingEvent on existing booking (status VALIDATED over WAITING_CONFIRMATION) fails with code 409",
+			repUUID(38),
+			makeCarpoolBookingEventWithStatus(repUUID(39), repUUID(38), api.BookingStatusVALIDATED),
+			NewBookingsByID(makeBooking(repUUID(38))),
+			http.StatusConflict,
+			http.StatusOK,
+			api.BookingStatusWAITINGCONFIRMATION,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -683,6 +939,11 @@ func TestPostMessage(t *testing.T) {
 			flags.ExpectedResponseCode = tc.expectedStatusCode
 
 			TestPostMessagesHelper(t, mockDB, tc.message, flags)
+
+			expectStored := tc.expectedStatusCode == http.StatusCreated
+			if stored := len(mockDB.GetMessages()) == 1; stored != expectStored {
+				t.Errorf("expected message stored: %t, got %t", expectStored, stored)
+			}
 		})
 	}
 }
@@ -704,6 +965,15 @@ func TestGeneration(t *testing.T) {
 
 		err = os.WriteFile(generatedTestCommandsFile, []byte(commandsFile.String()), 0644)
 		util.PanicIf(err)
+
+		var suiteFile strings.Builder
+
+		fmt.Fprint(&suiteFile, "# Generated programmatically - DO NOT EDIT\n\n")
+		err = test.WriteSuite(&generatedSuite, &suiteFile)
+		util.PanicIf(err)
+
+		err = os.WriteFile(generatedTestSuiteFile, []byte(suiteFile.String()), 0644)
+		util.PanicIf(err)
 	}
 	generateTestData = false
 }
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/labstack/echo/v4"
+)
+
+// operatorContextKey is the key of the echo context where the operator bound
+// to the API key of the request is stored
+const operatorContextKey = "operator"
+
+// APIKeys maps valid API keys to the operator they are bound to. An empty
+// operator means that the key is valid for any operator.
+type APIKeys map[string]string
+
+// ReadAPIKeys reads API keys in json format, e.g.
+//
+//	{"key1": "carpool.mycity.com", "key2": ""}
+//
+// Empty keys are rejected.
+func ReadAPIKeys(r io.Reader) (APIKeys, error) {
+	var keys APIKeys
+
+	if err := json.NewDecoder(r).Decode(&keys); err != nil {
+		return nil, fmt.Errorf("invalid API keys: %w", err)
+	}
+
+	if _, ok := keys[""]; ok {
+		return nil, errors.New("invalid API keys: empty key")
+	}
+
+	return keys, nil
+}
+
+// ReadAPIKeysFile reads API keys from a json file, see `ReadAPIKeys`
+func ReadAPIKeysFile(path string) (APIKeys, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadAPIKeys(file)
+}
+
+// apiKeyAuth returns a middleware rejecting requests with missing or invalid
+// API keys with code 401. The operator bound to the API key is stored in the
+// context. GET /status does not require authentication, and the admin API
+// has its own authentication.
+//
+// If there is no API key, authentication is disabled.
+func apiKeyAuth(keys APIKeys, basePath string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if len(keys) == 0 || ctx.Path() == basePath+"/status" ||
+				isAdminPath(ctx.Path(), basePath) {
+				return next(ctx)
+			}
+
+			apiKey := ctx.Request().Header.Get(api.HeaderXAPIKey)
+			if apiKey == "" {
+				return ctx.NoContent(http.StatusUnauthorized)
+			}
+
+			operator, ok := keys[apiKey]
+			if !ok {
+				return ctx.NoContent(http.StatusUnauthorized)
+			}
+
+			ctx.Set(operatorContextKey, operator)
+
+			return next(ctx)
+		}
+	}
+}
+
+// ForbiddenErr is returned when a booking belongs to another operator than
+// the one bound to the API key
+type ForbiddenErr struct{}
+
+func (err ForbiddenErr) Error() string {
+	return "forbidden"
+}
+
+// checkBookingOperator returns a ForbiddenErr if neither the driver nor the
+// passenger of the booking belong to the operator bound to the API key of the
+// request.
+func checkBookingOperator(ctx echo.Context, booking *api.Booking) error {
+	operator, _ := ctx.Get(operatorContextKey).(string)
+
+	if operator == "" ||
+		booking.Driver.Operator == operator ||
+		booking.Passenger.Operator == operator {
+		return nil
+	}
+
+	return ForbiddenErr{}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/service/db"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/test"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
+)
+
+const (
+	keyAnyOperator = "key-any"
+	keyOperatorA   = "key-a"
+	operatorA      = "a.example.com"
+	operatorB      = "b.example.com"
+)
+
+func setupAuthTestServer(mockDB *db.Mock) *httptest.Server {
+	// The empty key must not authenticate requests without API key
+	config := Config{APIKeys: APIKeys{
+		"":             operatorA,
+		keyAnyOperator: "",
+		keyOperatorA:   operatorA,
+	}}
+
+	return httptest.NewServer(newEcho(NewServerWithDB(mockDB), config))
+}
+
+func makeBookingWithOperator(seed int64, operator string) *api.Booking {
+	booking := makeBooking(repUUID(seed))
+	booking.Driver.Operator = operator
+	booking.Passenger.Operator = operator
+
+	return booking
+}
+
+func TestReadAPIKeys(t *testing.T) {
+	keys, err := ReadAPIKeys(strings.NewReader(`{"key1": "a.example.com", "key2": ""}`))
+	util.PanicIf(err)
+
+	if len(keys) != 2 || keys["key1"] != "a.example.com" || keys["key2"] != "" {
+		t.Errorf("wrong API keys: %v", keys)
+	}
+
+	if _, err := ReadAPIKeys(strings.NewReader(`["key1"]`)); err == nil {
+		t.Error("expected an error on invalid API keys")
+	}
+
+	if _, err := ReadAPIKeys(strings.NewReader(`{"": "a.example.com"}`)); err == nil {
+		t.Error("expected an error on empty API key")
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	mockDB := db.NewMockDB()
+	mockDB.Bookings = NewBookingsByID(
+		makeBookingWithOperator(100, operatorA),
+		makeBookingWithOperator(101, operatorB),
+	)
+
+	server := setupAuthTestServer(mockDB)
+	defer server.Close()
+
+	newBookingBody := func(seed int64, operator string) []byte {
+		body, err := json.Marshal(makeBookingWithOperator(seed, operator))
+		util.PanicIf(err)
+
+		return body
+	}
+
+	newBookingEventBody := func(seed int64, operator string) []byte {
+		booking := makeBookingWithOperator(seed, operator)
+		booking.Status = api.BookingStatusCONFIRMED
+
+		data := api.CarpoolBookingEvent_Data{}
+		util.PanicIf(data.FromDriverCarpoolBooking(*booking.ToDriverCarpoolBooking()))
+
+		body, err := json.Marshal(api.CarpoolBookingEvent{Id: repUUID(seed + 100), Data: data})
+		util.PanicIf(err)
+
+		return body
+	}
+
+	testCases := []struct {
+		name         string
+		method       string
+		path         string
+		apiKey       string
+		body         []byte
+		expectedCode int
+	}{
+		{"missing key", http.MethodGet, "/bookings/" + repUUID(100).String(), "", nil, http.StatusUnauthorized},
+		{"missing key on search", http.MethodGet, "/driver_journeys", "", nil, http.StatusUnauthorized},
+		{"invalid key", http.MethodGet, "/bookings/" + repUUID(100).String(), "invalid", nil, http.StatusUnauthorized},
+		{"status without key", http.MethodGet, "/status", "", nil, http.StatusOK},
+		{"key for any operator", http.MethodGet, "/bookings/" + repUUID(101).String(), keyAnyOperator, nil, http.StatusOK},
+		{"booking of key operator", http.MethodGet, "/bookings/" + repUUID(100).String(), keyOperatorA, nil, http.StatusOK},
+		{"booking of other operator", http.MethodGet, "/bookings/" + repUUID(101).String(), keyOperatorA, nil, http.StatusForbidden},
+		{"patch booking of other operator", http.MethodPatch, "/bookings/" + repUUID(101).String() + "?status=CONFIRMED", keyOperatorA, nil, http.StatusForbidden},
+		{"patch booking of key operator", http.MethodPatch, "/bookings/" + repUUID(100).String() + "?status=CONFIRMED", keyOperatorA, nil, http.StatusOK},
+		{"post booking of other operator", http.MethodPost, "/bookings", keyOperatorA, newBookingBody(102, operatorB), http.StatusForbidden},
+		{"post booking of key operator", http.MethodPost, "/bookings", keyOperatorA, newBookingBody(103, operatorA), http.StatusCreated},
+		{"booking event on booking of other operator", http.MethodPost, "/booking_events", keyOperatorA, newBookingEventBody(101, operatorA), http.StatusForbidden},
+		{"booking event of other operator", http.MethodPost, "/booking_events", keyOperatorA, newBookingEventBody(104, operatorB), http.StatusForbidden},
+		{"booking event of key operator", http.MethodPost, "/booking_events", keyOperatorA, newBookingEventBody(105, operatorA), http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request, err := http.NewRequest(tc.method, server.URL+tc.path, bytes.NewReader(tc.body))
+			util.PanicIf(err)
+
+			request.Header.Set("Content-Type", "application/json")
+
+			if tc.apiKey != "" {
+				request.Header.Set(api.HeaderXAPIKey, tc.apiKey)
+			}
+
+			response, err := http.DefaultClient.Do(request)
+			util.PanicIf(err)
+			response.Body.Close()
+
+			if response.StatusCode != tc.expectedCode {
+				t.Errorf("expected status code %d, got %d", tc.expectedCode, response.StatusCode)
+			}
+		})
+	}
+
+	if mockDB.Bookings[repUUID(101)].Status != api.BookingStatusWAITINGCONFIRMATION {
+		t.Error("booking of other operator should not be updated")
+	}
+
+	for _, seed := range []int64{102, 104} {
+		if _, err := mockDB.GetBooking(repUUID(seed)); err == nil {
+			t.Error("booking of other operator should not be created")
+		}
+	}
+}
+
+func TestExpectAuthRequired(t *testing.T) {
+	testCases := []struct {
+		name        string
+		config      Config
+		expectError bool
+	}{
+		{"authentication enabled", Config{APIKeys: APIKeys{keyAnyOperator: ""}}, false},
+		{"authentication disabled", Config{}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(newEcho(NewServer(), tc.config))
+			defer server.Close()
+
+			flags := test.NewFlags()
+			flags.ExpectAuthRequired = true
+
+			query := test.NewQuery()
+			query.SetParam("departureLat", "0")
+			query.SetParam("departureLng", "0")
+			query.SetParam("arrivalLat", "0")
+			query.SetParam("arrivalLng", "0")
+			query.SetParam("departureDate", "0")
+
+			err := test.RunTest(http.MethodGet, server.URL+"/driver_journeys", query, nil,
+				false, keyAnyOperator, flags)
+			if (err != nil) != tc.expectError {
+				t.Errorf("expected error: %t, got %s", tc.expectError, err)
+			}
+		})
+	}
+}
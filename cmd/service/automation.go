@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/service/db"
+	"github.com/labstack/echo/v4"
+)
+
+// automationInterval is the interval between two applications of automation
+// rules
+const automationInterval = time.Second
+
+// AutomationRules are opt-in rules changing the status of bookings over
+// time, as a real operator would. The zero value disables automation.
+type AutomationRules struct {
+	// ConfirmAfter is the delay after which a booking created with POST
+	// /bookings is confirmed. If 0, bookings are not confirmed automatically.
+	ConfirmAfter time.Duration
+
+	// Complete moves confirmed bookings to COMPLETED_PENDING_VALIDATION once
+	// passengerPickupDate + duration is past.
+	Complete bool
+
+	// CancelRate is the probability (between 0 and 1) that a booking created
+	// with POST /bookings is cancelled after ConfirmAfter, instead of being
+	// confirmed.
+	CancelRate float64
+}
+
+// Enabled checks if any automation rule is set
+func (r AutomationRules) Enabled() bool {
+	return r.ConfirmAfter > 0 || r.Complete || r.CancelRate > 0
+}
+
+// Automation applies automation rules to the bookings of a DB. Every status
+// change goes through `UpdateBookingStatus`, and is reported to onChange.
+type Automation struct {
+	rules    AutomationRules
+	db       db.DB
+	onChange func(bookingID api.BookingId)
+	logger   echo.Logger
+
+	mu        sync.Mutex
+	random    *rand.Rand
+	scheduled map[api.BookingId]scheduledStatus
+}
+
+// scheduledStatus is a status to be set on a booking once due
+type scheduledStatus struct {
+	due    time.Time
+	status api.BookingStatus
+}
+
+// NewAutomation returns an automation applying rules to the bookings of d.
+// onChange, if not nil, is called after each status change.
+func NewAutomation(rules AutomationRules, d db.DB, onChange func(bookingID api.BookingId)) *Automation {
+	return &Automation{
+		rules:     rules,
+		db:        d,
+		onChange:  onChange,
+		random:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		scheduled: map[api.BookingId]scheduledStatus{},
+	}
+}
+
+// BookingCreated schedules the confirmation or cancellation of a new
+// booking. A nil automation does nothing.
+func (a *Automation) BookingCreated(bookingID api.BookingId) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	due := time.Now().Add(a.rules.ConfirmAfter)
+
+	switch {
+	case a.random.Float64() < a.rules.CancelRate:
+		a.scheduled[bookingID] = scheduledStatus{due, api.BookingStatusCANCELLED}
+
+	case a.rules.ConfirmAfter > 0:
+		a.scheduled[bookingID] = scheduledStatus{due, api.BookingStatusCONFIRMED}
+	}
+}
+
+// Run applies automation rules every second, until the context is done
+func (a *Automation) Run(ctx context.Context) {
+	ticker := time.NewTicker(automationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case now := <-ticker.C:
+			a.apply(now)
+		}
+	}
+}
+
+// apply applies automation rules at a given time
+func (a *Automation) apply(now time.Time) {
+	for bookingID, status := range a.dueStatuses(now) {
+		a.setStatus(bookingID, status)
+	}
+
+	if !a.rules.Complete {
+		return
+	}
+
+	for bookingID, booking := range a.db.GetBookings() {
+		if booking.Status == api.BookingStatusCONFIRMED && !now.Before(arrivalTime(booking)) {
+			a.setStatus(bookingID, api.BookingStatusCOMPLETEDPENDINGVALIDATION)
+		}
+	}
+}
+
+// dueStatuses returns the scheduled statuses due at a given time, and
+// unschedules them
+func (a *Automation) dueStatuses(now time.Time) map[api.BookingId]api.BookingStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	due := map[api.BookingId]api.BookingStatus{}
+
+	for bookingID, scheduled := range a.scheduled {
+		if !now.Before(scheduled.due) {
+			due[bookingID] = scheduled.status
+			delete(a.scheduled, bookingID)
+		}
+	}
+
+	return due
+}
+
+// setStatus updates the status of a booking. The update is skipped if the
+// status has been changed in the meantime (e.g. the booking has been
+// cancelled through PATCH /bookings).
+func (a *Automation) setStatus(bookingID api.BookingId, status api.BookingStatus) {
+	change := db.StatusChange{Status: status, Source: db.StatusChangeSourceAutomation}
+
+	if err := UpdateBookingStatus(a.db, bookingID, change); err != nil {
+		a.log("automation: booking %s not updated to %s: %s", bookingID, status, err)
+		return
+	}
+
+	a.log("automation: booking %s updated to %s", bookingID, status)
+
+	if a.onChange != nil {
+		a.onChange(bookingID)
+	}
+}
+
+func (a *Automation) log(format string, args ...interface{}) {
+	if a.logger != nil {
+		a.logger.Infof(format, args...)
+	}
+}
+
+// arrivalTime returns the time at which the passenger is dropped off:
+// passengerPickupDate + duration
+func arrivalTime(booking *api.Booking) time.Time {
+	arrival := time.Unix(booking.PassengerPickupDate, 0)
+
+	if booking.Duration != nil {
+		arrival = arrival.Add(time.Duration(*booking.Duration) * time.Second)
+	}
+
+	return arrival
+}
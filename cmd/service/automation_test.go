@@ -0,0 +1,142 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/service/db"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
+)
+
+func TestAutomation(t *testing.T) {
+	var (
+		delay     = 10 * time.Second
+		inAnHour  = time.Now().Add(time.Hour).Unix()
+		anHourAgo = time.Now().Add(-time.Hour).Unix()
+	)
+
+	testCases := []struct {
+		name           string
+		rules          AutomationRules
+		status         api.BookingStatus
+		pickupDate     int64
+		created        bool
+		humanStatus    api.BookingStatus
+		expectedStatus api.BookingStatus
+	}{
+		{"no rule", AutomationRules{}, api.BookingStatusWAITINGCONFIRMATION, anHourAgo, true, "",
+			api.BookingStatusWAITINGCONFIRMATION},
+		{"created booking is confirmed", AutomationRules{ConfirmAfter: delay},
+			api.BookingStatusWAITINGCONFIRMATION, inAnHour, true, "", api.BookingStatusCONFIRMED},
+		{"existing booking is not confirmed", AutomationRules{ConfirmAfter: delay},
+			api.BookingStatusWAITINGCONFIRMATION, inAnHour, false, "", api.BookingStatusWAITINGCONFIRMATION},
+		{"created booking is cancelled", AutomationRules{ConfirmAfter: delay, CancelRate: 1},
+			api.BookingStatusWAITINGCONFIRMATION, inAnHour, true, "", api.BookingStatusCANCELLED},
+		{"booking cancelled by a human is not confirmed", AutomationRules{ConfirmAfter: delay},
+			api.BookingStatusWAITINGCONFIRMATION, inAnHour, true, api.BookingStatusCANCELLED,
+			api.BookingStatusCANCELLED},
+		{"past confirmed booking is completed", AutomationRules{Complete: true},
+			api.BookingStatusCONFIRMED, anHourAgo, false, "", api.BookingStatusCOMPLETEDPENDINGVALIDATION},
+		{"future confirmed booking is not completed", AutomationRules{Complete: true},
+			api.BookingStatusCONFIRMED, inAnHour, false, "", api.BookingStatusCONFIRMED},
+		{"past booking waiting for confirmation is not completed", AutomationRules{Complete: true},
+			api.BookingStatusWAITINGCONFIRMATION, anHourAgo, false, "", api.BookingStatusWAITINGCONFIRMATION},
+		{"created booking is confirmed then completed", AutomationRules{ConfirmAfter: delay, Complete: true},
+			api.BookingStatusWAITINGCONFIRMATION, anHourAgo, true, "", api.BookingStatusCOMPLETEDPENDINGVALIDATION},
+	}
+
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			booking := makeBookingWithStatus(repUUID(int64(730+i)), tc.status)
+			booking.PassengerPickupDate = tc.pickupDate
+
+			mockDB := db.NewMockDB()
+			mockDB.Bookings = NewBookingsByID(booking)
+
+			var notified []api.BookingId
+
+			automation := NewAutomation(tc.rules, mockDB, func(bookingID api.BookingId) {
+				notified = append(notified, bookingID)
+			})
+
+			if tc.created {
+				automation.BookingCreated(booking.Id)
+			}
+
+			// Nothing is due before the delay
+			automation.apply(time.Now())
+
+			if tc.humanStatus != "" {
+				util.PanicIf(UpdateBookingStatus(mockDB, booking.Id,
+					db.StatusChange{Status: tc.humanStatus, Source: db.StatusChangeSourcePatch}))
+			}
+
+			automation.apply(time.Now().Add(delay))
+			automation.apply(time.Now().Add(delay))
+
+			updated, err := mockDB.GetBooking(booking.Id)
+			util.PanicIf(err)
+
+			if updated.Status != tc.expectedStatus {
+				t.Errorf("expected status %s, got %s", tc.expectedStatus, updated.Status)
+			}
+
+			expectedNotifications := statusDistance(tc.status, tc.expectedStatus)
+			if tc.humanStatus != "" {
+				expectedNotifications = 0
+			}
+
+			if len(notified) != expectedNotifications {
+				t.Errorf("expected %d notification(s), got %d", expectedNotifications, len(notified))
+			}
+		})
+	}
+}
+
+// statusDistance returns the number of automated transitions from a status
+// to another
+func statusDistance(from, to api.BookingStatus) int {
+	switch {
+	case from == to:
+		return 0
+	case from == api.BookingStatusWAITINGCONFIRMATION && to == api.BookingStatusCOMPLETEDPENDINGVALIDATION:
+		return 2
+	default:
+		return 1
+	}
+}
+
+func TestAutomationWithPostBookings(t *testing.T) {
+	mockDB := db.NewMockDB()
+
+	handler := NewServerWithDB(mockDB)
+	handler.automation = NewAutomation(AutomationRules{ConfirmAfter: time.Minute}, mockDB, nil)
+
+	server := httptest.NewServer(newEcho(handler, Config{}))
+	defer server.Close()
+
+	booking := makeBooking(repUUID(740))
+
+	if code, body := adminRequest(t, server, http.MethodPost, "/bookings", "", booking); code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d (%s)", http.StatusCreated, code, body)
+	}
+
+	handler.automation.apply(time.Now().Add(time.Minute))
+
+	created, err := mockDB.GetBooking(booking.Id)
+	util.PanicIf(err)
+
+	if created.Status != api.BookingStatusCONFIRMED {
+		t.Errorf("expected booking created with POST /bookings to be confirmed, got %s", created.Status)
+	}
+
+	history, err := mockDB.GetBookingHistory(booking.Id)
+	util.PanicIf(err)
+
+	if len(history) != 1 || history[0].Source != db.StatusChangeSourceAutomation {
+		t.Errorf("expected status change by automation to be recorded, got %+v", history)
+	}
+}
@@ -18,9 +18,11 @@ var (
 	generateTestData bool
 	generatedData    = db.NewMockDB()
 	commandsFile     = strings.Builder{}
+	generatedSuite   = test.Suite{Server: localServer}
 
 	generatedTestDataFile     = "./db/data/testData.gen.json"
 	generatedTestCommandsFile = "../test/commands/testCommands.gen.sh"
+	generatedTestSuiteFile    = "../test/commands/testSuite.gen.yaml"
 
 	serverEnvVar = "SERVER"
 	authEnvVar   = "API_TOKEN"
@@ -49,14 +51,19 @@ func appendDataIfGenerated(t *testing.T, mockDB *db.Mock) {
 	}
 }
 
-// appendCmdIfGenerated is used to populate the `commands` string, if
-// -generate flag is provided
+// appendCmdIfGenerated is used to populate the `commands` string and the
+// `generatedSuite` steps, if -generate flag is provided
 func appendCmdIfGenerated(t *testing.T, request *http.Request, flags test.Flags, body []byte) {
 	if generateTestData {
 		fmt.Fprint(
 			&commandsFile,
 			GenerateCommandStr(t, request, flags, body),
 		)
+
+		step, err := test.NewStep(t.Name(), request, flags, body)
+		util.PanicIf(err)
+
+		generatedSuite.Steps = append(generatedSuite.Steps, step)
 	}
 }
 
@@ -149,7 +156,10 @@ func shiftToNextWeek() {
 func setJourneyDatesForGeneration(schedule *api.JourneySchedule) {
 	if generateTestData {
 		if schedule.DriverDepartureDate != nil {
-			*schedule.DriverDepartureDate += unixEpochCounter
+			// The date may be shared with other journeys, and is not updated in
+			// place
+			driverDepartureDate := *schedule.DriverDepartureDate + unixEpochCounter
+			schedule.DriverDepartureDate = &driverDepartureDate
 		}
 		schedule.PassengerPickupDate += unixEpochCounter
 	}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultPort is the port on which the server listens by default
+const DefaultPort = 1323
+
+// DefaultOperator is the operator served by default, as in default data
+const DefaultOperator = "operator.example.org"
+
+// Config holds the configuration of the server
+type Config struct {
+	// DataFile is the path to a data file (json format). If empty, default
+	// data is loaded.
+	DataFile string
+
+	// StoreFile is the path to a json file where data is persisted. If it
+	// exists, data is loaded from it instead of the data file. If empty, data
+	// is stored in memory only.
+	StoreFile string
+
+	// Host and Port on which the server listens. An empty host listens on all
+	// interfaces.
+	Host string
+	Port int
+
+	// TLSCertFile and TLSKeyFile are the paths to a certificate and its
+	// private key. If set, the server is served over HTTPS.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// BasePath is a prefix of all API paths, e.g. "/stdcov/v1"
+	BasePath string
+
+	// APIKeys are the valid API keys. If empty, authentication is disabled.
+	APIKeys APIKeys
+
+	// AdminKey is the key of the admin API, in the "X-Admin-Key" header. If
+	// empty, the admin API is disabled.
+	AdminKey string
+
+	// WebhookURL is the server URL of a MaaS platform, notified of booking
+	// status changes on its POST /booking_events endpoint. If empty, no
+	// notification is sent. WebhookAPIKey is sent in the "X-API-Key" header
+	// of notifications, if not empty. WebhookIDTokenSecret signs the idToken
+	// of notifications (HS256), and is required with a webhook.
+	WebhookURL           string
+	WebhookAPIKey        string
+	WebhookIDTokenSecret string
+
+	// IDTokenSecret and IDTokenJWKS (path or URL of a JWKS) are used to verify
+	// the signature of the idToken of booking events, as a JWT. If both are
+	// empty, idTokens are not verified. IDTokenAudience is the audience
+	// expected in idTokens: the operator served by the server.
+	IDTokenSecret   string
+	IDTokenJWKS     string
+	IDTokenAudience string
+
+	// Automation are rules changing the status of bookings over time. They
+	// are disabled by default.
+	Automation AutomationRules
+
+	// Faults are rules injecting faults (latency, errors, dropped
+	// connections...) in the responses of the API. They can be changed at
+	// runtime through the admin API.
+	Faults []FaultRule
+
+	// Violations are rules of the specification that the server deliberately
+	// breaks, to check that the test suite detects them. None by default.
+	Violations []Violation
+}
+
+// DefaultConfig returns the default configuration of the server
+func DefaultConfig() Config {
+	return Config{Port: DefaultPort, IDTokenAudience: DefaultOperator}
+}
+
+// VerifyIDToken checks if the idToken of booking events is verified
+func (c Config) VerifyIDToken() bool {
+	return c.IDTokenSecret != "" || c.IDTokenJWKS != ""
+}
+
+// Address returns the address on which the server listens
+func (c Config) Address() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// UseTLS checks if the server is served over HTTPS
+func (c Config) UseTLS() bool {
+	return c.TLSCertFile != ""
+}
+
+// NormalizedBasePath returns the base path with a leading slash and without
+// trailing slash, or "" if there is no base path.
+func (c Config) NormalizedBasePath() string {
+	basePath := strings.Trim(c.BasePath, "/")
+	if basePath == "" {
+		return ""
+	}
+
+	return "/" + basePath
+}
+
+// Validate checks that the configuration is consistent
+func (c Config) Validate() error {
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("both TLS certificate and key files are required to serve over HTTPS")
+	}
+
+	if c.Port < 0 || c.Port > 65535 {
+		return errors.New("port must be between 0 and 65535")
+	}
+
+	if c.Automation.CancelRate < 0 || c.Automation.CancelRate > 1 {
+		return errors.New("automatic cancellation rate must be between 0 and 1")
+	}
+
+	if c.Automation.ConfirmAfter < 0 {
+		return errors.New("automatic confirmation delay must be positive")
+	}
+
+	for _, rule := range c.Faults {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, violation := range c.Violations {
+		if err := violation.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.VerifyIDToken() && c.IDTokenAudience == "" {
+		return errors.New("an idToken audience is required to verify idTokens")
+	}
+
+	if c.WebhookURL != "" {
+		u, err := url.Parse(c.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("webhook URL must be an absolute http(s) URL")
+		}
+
+		if c.WebhookIDTokenSecret == "" {
+			return errors.New("a secret signing the idToken of webhook notifications is required")
+		}
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@
 //
 // It exports type `Mock` used to store data in memory, but it can be replaced
 // with another storage with the interface `DB` (which `Mock` implements).
+// Type `File` is such a storage, which persists the data in a json file.
 //
 // A MockDB can be initialized with data, given the data is in json format as
 // expected by `MockDBDataInterface`. It can also write its data in json
@@ -10,19 +11,29 @@ package db
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
 	"github.com/google/uuid"
 )
 
+// DB is the storage of the server. Implementations must be safe for
+// concurrent use.
 type DB interface {
-	// Getters should never return nil.
+	// Getters should never return nil. Returned data should not be modified.
 	GetDriverJourneys() []api.DriverJourney
 	GetPassengerJourneys() []api.PassengerJourney
 	GetDriverRegularTrips() []api.DriverRegularTrip
 	GetPassengerRegularTrips() []api.PassengerRegularTrip
 
 	GetUsers() []api.User
+	GetMessages() []api.PostMessagesJSONBody
+
+	// AddMessage stores a message sent through the API
+	AddMessage(api.PostMessagesJSONBody) error
+
+	// GetBookings and GetBooking return copies of the stored bookings
 	GetBookings() BookingsByID
 
 	// GetBooking should return a MissingBookingErr if not found
@@ -31,9 +42,37 @@ type DB interface {
 	// AddBooking adds a booking to the db, but fails if a booking with same ID
 	// already exists
 	AddBooking(api.Booking) error
+
+	// CompareAndSetBookingStatus atomically sets the status of a booking to
+	// `change.Status`, if its current status is `oldStatus`, and appends the
+	// change to the status history of the booking. It should return a
+	// MissingBookingErr if not found, and a StatusChangedErr if the current
+	// status is not `oldStatus`.
+	CompareAndSetBookingStatus(bookingID api.BookingId, oldStatus api.BookingStatus, change StatusChange) error
+
+	// GetBookingHistory returns the status changes of a booking, oldest
+	// first. It should return a MissingBookingErr if not found.
+	GetBookingHistory(api.BookingId) ([]StatusChange, error)
+
+	// Data returns a snapshot of all data, and SetData replaces all data
+	Data() MockDBDataInterface
+	SetData(MockDBDataInterface) error
+
+	// Add methods fail if an item with same ID (and operator) already exists.
+	// Remove methods should return a MissingJourneyErr, MissingUserErr or
+	// MissingBookingErr if not found.
+	AddDriverJourney(api.DriverJourney) error
+	RemoveDriverJourney(operator, id string) error
+	AddPassengerJourney(api.PassengerJourney) error
+	RemovePassengerJourney(operator, id string) error
+	AddUser(api.User) error
+	RemoveUser(operator, id string) error
+	RemoveBooking(api.BookingId) error
 }
 
-// Mock stores the data of the server in memory
+// Mock stores the data of the server in memory. It is safe for concurrent use
+// through its methods, but exported fields should not be accessed directly
+// while it is in use.
 type Mock struct {
 	DriverJourneys        []api.DriverJourney
 	PassengerJourneys     []api.PassengerJourney
@@ -41,10 +80,33 @@ type Mock struct {
 	PassengerRegularTrips []api.PassengerRegularTrip
 	Bookings              BookingsByID
 	Users                 []api.User
+	Messages              []api.PostMessagesJSONBody
+	BookingHistory        map[api.BookingId][]StatusChange
+
+	mu sync.Mutex
 }
 
 type BookingsByID map[api.BookingId]*api.Booking
 
+// StatusChangeSource is the origin of a booking status change
+type StatusChangeSource string
+
+const (
+	StatusChangeSourcePatch        StatusChangeSource = "PATCH"
+	StatusChangeSourceBookingEvent StatusChangeSource = "booking_event"
+	StatusChangeSourceAutomation   StatusChangeSource = "automation"
+	StatusChangeSourceAdmin        StatusChangeSource = "admin"
+)
+
+// StatusChange is an entry of the status history of a booking
+type StatusChange struct {
+	Time    time.Time          `json:"time"`
+	From    api.BookingStatus  `json:"from"`
+	Status  api.BookingStatus  `json:"status"`
+	Message *string            `json:"message,omitempty"`
+	Source  StatusChangeSource `json:"source"`
+}
+
 // NewMockDB initiates a MockDB with no data
 func NewMockDB() *Mock {
 	m := Mock{}
@@ -54,11 +116,16 @@ func NewMockDB() *Mock {
 	m.PassengerRegularTrips = []api.PassengerRegularTrip{}
 	m.Bookings = BookingsByID{}
 	m.Users = []api.User{}
+	m.Messages = []api.PostMessagesJSONBody{}
+	m.BookingHistory = map[api.BookingId][]StatusChange{}
 
 	return &m
 }
 
 func (m *Mock) GetDriverJourneys() []api.DriverJourney {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if m.DriverJourneys == nil {
 		m.DriverJourneys = []api.DriverJourney{}
 	}
@@ -67,6 +134,9 @@ func (m *Mock) GetDriverJourneys() []api.DriverJourney {
 }
 
 func (m *Mock) GetPassengerJourneys() []api.PassengerJourney {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if m.PassengerJourneys == nil {
 		m.PassengerJourneys = []api.PassengerJourney{}
 	}
@@ -75,6 +145,9 @@ func (m *Mock) GetPassengerJourneys() []api.PassengerJourney {
 }
 
 func (m *Mock) GetDriverRegularTrips() []api.DriverRegularTrip {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if m.DriverRegularTrips == nil {
 		m.DriverRegularTrips = []api.DriverRegularTrip{}
 	}
@@ -83,6 +156,9 @@ func (m *Mock) GetDriverRegularTrips() []api.DriverRegularTrip {
 }
 
 func (m *Mock) GetPassengerRegularTrips() []api.PassengerRegularTrip {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if m.PassengerRegularTrips == nil {
 		m.PassengerRegularTrips = []api.PassengerRegularTrip{}
 	}
@@ -90,15 +166,25 @@ func (m *Mock) GetPassengerRegularTrips() []api.PassengerRegularTrip {
 	return m.PassengerRegularTrips
 }
 
+// GetBookings returns a copy of all bookings
 func (m *Mock) GetBookings() BookingsByID {
-	if m.Bookings == nil {
-		m.Bookings = BookingsByID{}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bookings := make(BookingsByID, len(m.bookings()))
+
+	for id, booking := range m.bookings() {
+		bookingCopy := *booking
+		bookings[id] = &bookingCopy
 	}
 
-	return m.Bookings
+	return bookings
 }
 
 func (m *Mock) GetUsers() []api.User {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if m.Users == nil {
 		m.Users = []api.User{}
 	}
@@ -106,21 +192,49 @@ func (m *Mock) GetUsers() []api.User {
 	return m.Users
 }
 
+func (m *Mock) GetMessages() []api.PostMessagesJSONBody {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Messages == nil {
+		m.Messages = []api.PostMessagesJSONBody{}
+	}
+
+	return m.Messages
+}
+
+// AddMessage stores a message
+func (m *Mock) AddMessage(message api.PostMessagesJSONBody) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Messages = appendCopy(m.Messages, message)
+
+	return nil
+}
+
+// GetBooking returns a copy of a booking, or a MissingBookingErr if not found
 func (m *Mock) GetBooking(bookingID uuid.UUID) (*api.Booking, error) {
-	bookings := m.GetBookings()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	booking, ok := bookings[bookingID]
+	booking, ok := m.bookings()[bookingID]
 	if !ok {
 		return nil, MissingBookingErr{}
 	}
 
-	return booking, nil
+	bookingCopy := *booking
+
+	return &bookingCopy, nil
 }
 
 // AddBooking adds a new booking to the data. Returns an error if a booking
 // with same ID already exists
 func (m *Mock) AddBooking(booking api.Booking) error {
-	bookings := m.GetBookings()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bookings := m.bookings()
 
 	if _, bookingExists := bookings[booking.Id]; bookingExists {
 		return fmt.Errorf("booking already exists (ID: %s)", booking.Id)
@@ -131,8 +245,89 @@ func (m *Mock) AddBooking(booking api.Booking) error {
 	return nil
 }
 
+// CompareAndSetBookingStatus atomically sets the status of an existing
+// booking to `change.Status`, if its current status is `oldStatus`, and
+// appends the change to the history of the booking. `change.From` is set to
+// `oldStatus`, and `change.Time` to the current time if not set. Returns a
+// MissingBookingErr if the booking is not found, and a StatusChangedErr if its
+// status is not `oldStatus`.
+func (m *Mock) CompareAndSetBookingStatus(bookingID api.BookingId, oldStatus api.BookingStatus, change StatusChange) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	booking, ok := m.bookings()[bookingID]
+	if !ok {
+		return MissingBookingErr{}
+	}
+
+	if booking.Status != oldStatus {
+		return StatusChangedErr{Expected: oldStatus, Current: booking.Status}
+	}
+
+	booking.Status = change.Status
+
+	change.From = oldStatus
+	if change.Time.IsZero() {
+		change.Time = time.Now()
+	}
+
+	history := m.bookingHistory()
+	history[bookingID] = appendCopy(history[bookingID], change)
+
+	return nil
+}
+
+// GetBookingHistory returns the status changes of a booking, oldest first, or
+// a MissingBookingErr if the booking is not found
+func (m *Mock) GetBookingHistory(bookingID api.BookingId) ([]StatusChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.bookings()[bookingID]; !ok {
+		return nil, MissingBookingErr{}
+	}
+
+	history := m.bookingHistory()[bookingID]
+	if history == nil {
+		history = []StatusChange{}
+	}
+
+	return history, nil
+}
+
+// bookings returns the bookings map, initialized if needed. The lock must be
+// held.
+func (m *Mock) bookings() BookingsByID {
+	if m.Bookings == nil {
+		m.Bookings = BookingsByID{}
+	}
+
+	return m.Bookings
+}
+
+// bookingHistory returns the booking history map, initialized if needed. The
+// lock must be held.
+func (m *Mock) bookingHistory() map[api.BookingId][]StatusChange {
+	if m.BookingHistory == nil {
+		m.BookingHistory = map[api.BookingId][]StatusChange{}
+	}
+
+	return m.BookingHistory
+}
+
 type MissingBookingErr struct{}
 
 func (err MissingBookingErr) Error() string {
 	return "missing_booking"
 }
+
+// StatusChangedErr is returned by a compare-and-set on a booking status, when
+// the booking does not have the expected status
+type StatusChangedErr struct {
+	Expected api.BookingStatus
+	Current  api.BookingStatus
+}
+
+func (err StatusChangedErr) Error() string {
+	return fmt.Sprintf("booking status is %s, expected %s", err.Current, err.Expected)
+}
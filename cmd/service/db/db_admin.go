@@ -0,0 +1,214 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+)
+
+// Data returns a snapshot of all data
+func (m *Mock) Data() MockDBDataInterface {
+	return toOutputData(m)
+}
+
+// SetData replaces all data
+func (m *Mock) SetData(data MockDBDataInterface) error {
+	newData := fromInputData(data)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.DriverJourneys = newData.DriverJourneys
+	m.PassengerJourneys = newData.PassengerJourneys
+	m.DriverRegularTrips = newData.DriverRegularTrips
+	m.PassengerRegularTrips = newData.PassengerRegularTrips
+	m.Bookings = newData.Bookings
+	m.Users = newData.Users
+	m.Messages = newData.Messages
+	m.BookingHistory = newData.BookingHistory
+
+	return nil
+}
+
+// AddDriverJourney adds a driver journey. Returns an error if a journey with
+// same ID and operator already exists.
+func (m *Mock) AddDriverJourney(journey api.DriverJourney) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	match := journeyMatcher[api.DriverJourney](journey.Operator, journey.Id)
+	if journey.Id != nil && indexOf(m.DriverJourneys, match) >= 0 {
+		return fmt.Errorf("driver journey already exists (ID: %s)", *journey.Id)
+	}
+
+	m.DriverJourneys = appendCopy(m.DriverJourneys, journey)
+
+	return nil
+}
+
+// RemoveDriverJourney removes a driver journey. Returns a MissingJourneyErr
+// if not found.
+func (m *Mock) RemoveDriverJourney(operator, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	journeys, ok := removeCopy(m.DriverJourneys, journeyMatcher[api.DriverJourney](operator, &id))
+	if !ok {
+		return MissingJourneyErr{}
+	}
+
+	m.DriverJourneys = journeys
+
+	return nil
+}
+
+// AddPassengerJourney adds a passenger journey. Returns an error if a journey
+// with same ID and operator already exists.
+func (m *Mock) AddPassengerJourney(journey api.PassengerJourney) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	match := journeyMatcher[api.PassengerJourney](journey.Operator, journey.Id)
+	if journey.Id != nil && indexOf(m.PassengerJourneys, match) >= 0 {
+		return fmt.Errorf("passenger journey already exists (ID: %s)", *journey.Id)
+	}
+
+	m.PassengerJourneys = appendCopy(m.PassengerJourneys, journey)
+
+	return nil
+}
+
+// RemovePassengerJourney removes a passenger journey. Returns a
+// MissingJourneyErr if not found.
+func (m *Mock) RemovePassengerJourney(operator, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	journeys, ok := removeCopy(m.PassengerJourneys, journeyMatcher[api.PassengerJourney](operator, &id))
+	if !ok {
+		return MissingJourneyErr{}
+	}
+
+	m.PassengerJourneys = journeys
+
+	return nil
+}
+
+// AddUser adds a user. Returns an error if a user with same ID and operator
+// already exists.
+func (m *Mock) AddUser(user api.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if indexOf(m.Users, userMatcher(user.Operator, user.Id)) >= 0 {
+		return fmt.Errorf("user already exists (ID: %s)", user.Id)
+	}
+
+	m.Users = appendCopy(m.Users, user)
+
+	return nil
+}
+
+// RemoveUser removes a user. Returns a MissingUserErr if not found.
+func (m *Mock) RemoveUser(operator, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users, ok := removeCopy(m.Users, userMatcher(operator, id))
+	if !ok {
+		return MissingUserErr{}
+	}
+
+	m.Users = users
+
+	return nil
+}
+
+// RemoveBooking removes a booking. Returns a MissingBookingErr if not found.
+func (m *Mock) RemoveBooking(bookingID api.BookingId) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.bookings()[bookingID]; !ok {
+		return MissingBookingErr{}
+	}
+
+	delete(m.Bookings, bookingID)
+	delete(m.bookingHistory(), bookingID)
+
+	return nil
+}
+
+type MissingJourneyErr struct{}
+
+func (err MissingJourneyErr) Error() string {
+	return "missing_journey"
+}
+
+type MissingUserErr struct{}
+
+func (err MissingUserErr) Error() string {
+	return "missing_user"
+}
+
+// journey is implemented by driver and passenger journeys
+type journey interface {
+	api.DriverJourney | api.PassengerJourney
+}
+
+// journeyMatcher matches journeys with given operator and ID. A nil ID
+// matches no journey.
+func journeyMatcher[J journey](operator string, id *string) func(J) bool {
+	return func(j J) bool {
+		var (
+			jOperator string
+			jID       *string
+		)
+
+		switch j := any(j).(type) {
+		case api.DriverJourney:
+			jOperator, jID = j.Operator, j.Id
+		case api.PassengerJourney:
+			jOperator, jID = j.Operator, j.Id
+		}
+
+		return id != nil && jID != nil && *jID == *id && jOperator == operator
+	}
+}
+
+func userMatcher(operator, id string) func(api.User) bool {
+	return func(u api.User) bool {
+		return u.Id == id && u.Operator == operator
+	}
+}
+
+func indexOf[T any](slice []T, match func(T) bool) int {
+	for i, item := range slice {
+		if match(item) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// appendCopy appends an item to a copy of the slice, so that slices returned
+// by getters are never modified.
+func appendCopy[T any](slice []T, item T) []T {
+	newSlice := make([]T, 0, len(slice)+1)
+
+	return append(append(newSlice, slice...), item)
+}
+
+// removeCopy returns a copy of the slice without the first matching item, and
+// whether an item has been removed.
+func removeCopy[T any](slice []T, match func(T) bool) ([]T, bool) {
+	i := indexOf(slice, match)
+	if i < 0 {
+		return slice, false
+	}
+
+	newSlice := make([]T, 0, len(slice)-1)
+
+	return append(append(newSlice, slice[:i]...), slice[i+1:]...), true
+}
@@ -19,9 +19,15 @@ type MockDBDataInterface struct {
 	Bookings              []*api.Booking             `json:"bookings"`
 	Users                 []api.User                 `json:"users"`
 	Messages              []api.PostMessagesJSONBody `json:"messages"`
+
+	// BookingHistory holds the status changes of bookings, by booking ID
+	BookingHistory map[api.BookingId][]StatusChange `json:"bookingHistory,omitempty"`
 }
 
 func toOutputData(m *Mock) MockDBDataInterface {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	outputData := MockDBDataInterface{}
 
 	outputData.DriverJourneys = m.DriverJourneys
@@ -29,17 +35,27 @@ func toOutputData(m *Mock) MockDBDataInterface {
 	outputData.DriverRegularTrips = m.DriverRegularTrips
 	outputData.PassengerRegularTrips = m.PassengerRegularTrips
 	outputData.Users = m.Users
+	outputData.Messages = m.Messages
+
+	if len(m.BookingHistory) > 0 {
+		outputData.BookingHistory = make(map[api.BookingId][]StatusChange, len(m.BookingHistory))
+		for id, history := range m.BookingHistory {
+			outputData.BookingHistory[id] = history
+		}
+	}
 
 	outputData.Bookings = make([]*api.Booking, 0, len(m.Bookings))
 	for _, booking := range m.Bookings {
-		outputData.Bookings = append(outputData.Bookings, booking)
+		bookingCopy := *booking
+		outputData.Bookings = append(outputData.Bookings, &bookingCopy)
 	}
 
 	return outputData
 }
 
-func WriteData(m *Mock, w io.Writer) error {
-	outputData := toOutputData(m)
+// WriteData writes a snapshot of all data of a DB in json format
+func WriteData(d DB, w io.Writer) error {
+	outputData := d.Data()
 
 	jsonData, err := json.MarshalIndent(outputData, "", "  ")
 	if err != nil {
@@ -63,6 +79,14 @@ func fromInputData(inputData MockDBDataInterface) *Mock {
 	m.PassengerRegularTrips = inputData.PassengerRegularTrips
 	m.Users = inputData.Users
 
+	if inputData.Messages != nil {
+		m.Messages = inputData.Messages
+	}
+
+	if inputData.BookingHistory != nil {
+		m.BookingHistory = inputData.BookingHistory
+	}
+
 	m.Bookings = make(BookingsByID, len(inputData.Bookings))
 
 	for _, booking := range inputData.Bookings {
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
@@ -90,3 +92,134 @@ func TestNewMockDBWithData(t *testing.T) {
 	_, ok := mockDB.Bookings[id]
 	assert.True(t, ok)
 }
+
+func TestMockDB_ConcurrentAccess(t *testing.T) {
+	const n = 100
+
+	mockDB := NewMockDB()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		wg.Add(3)
+
+		go func() {
+			defer wg.Done()
+
+			id := uuid.New()
+			util.PanicIf(mockDB.AddBooking(api.Booking{Id: id, Status: api.BookingStatusWAITINGCONFIRMATION}))
+			util.PanicIf(mockDB.CompareAndSetBookingStatus(id, api.BookingStatusWAITINGCONFIRMATION,
+				StatusChange{Status: api.BookingStatusCONFIRMED}))
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			for _, booking := range mockDB.GetBookings() {
+				_ = booking.Status
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			util.PanicIf(WriteData(mockDB, io.Discard))
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Len(t, mockDB.GetBookings(), n)
+}
+
+func TestMockDB_CompareAndSetBookingStatus(t *testing.T) {
+	const n = 100
+
+	var (
+		mockDB    = NewMockDB()
+		id        = uuid.New()
+		successes int32
+		wg        sync.WaitGroup
+	)
+
+	util.PanicIf(mockDB.AddBooking(api.Booking{Id: id, Status: api.BookingStatusWAITINGCONFIRMATION}))
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			err := mockDB.CompareAndSetBookingStatus(id, api.BookingStatusWAITINGCONFIRMATION,
+				StatusChange{Status: api.BookingStatusCONFIRMED})
+
+			switch err.(type) {
+			case nil:
+				atomic.AddInt32(&successes, 1)
+			case StatusChangedErr:
+			default:
+				t.Errorf("unexpected error %s", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int32(1), successes, "a single compare-and-set should succeed")
+
+	err := mockDB.CompareAndSetBookingStatus(uuid.New(), api.BookingStatusCONFIRMED, StatusChange{Status: api.BookingStatusVALIDATED})
+	assert.IsType(t, MissingBookingErr{}, err)
+}
+
+func TestMockDB_BookingHistory(t *testing.T) {
+	var (
+		mockDB  = NewMockDB()
+		id      = uuid.New()
+		message = "passenger is sick"
+	)
+
+	util.PanicIf(mockDB.AddBooking(api.Booking{Id: id, Status: api.BookingStatusWAITINGCONFIRMATION}))
+
+	history, err := mockDB.GetBookingHistory(id)
+	util.PanicIf(err)
+	assert.Empty(t, history)
+	assert.NotNil(t, history, "GetBookingHistory should never return nil")
+
+	util.PanicIf(mockDB.CompareAndSetBookingStatus(id, api.BookingStatusWAITINGCONFIRMATION,
+		StatusChange{Status: api.BookingStatusCONFIRMED, Source: StatusChangeSourceAutomation}))
+	util.PanicIf(mockDB.CompareAndSetBookingStatus(id, api.BookingStatusCONFIRMED,
+		StatusChange{Status: api.BookingStatusCANCELLED, Source: StatusChangeSourcePatch, Message: &message}))
+
+	// Failed compare-and-set is not recorded
+	assert.NotNil(t, mockDB.CompareAndSetBookingStatus(id, api.BookingStatusCONFIRMED,
+		StatusChange{Status: api.BookingStatusCANCELLED}))
+
+	history, err = mockDB.GetBookingHistory(id)
+	util.PanicIf(err)
+
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, api.BookingStatusWAITINGCONFIRMATION, history[0].From)
+		assert.Equal(t, api.BookingStatusCONFIRMED, history[0].Status)
+		assert.Equal(t, StatusChangeSourceAutomation, history[0].Source)
+		assert.False(t, history[0].Time.IsZero(), "time of change should be set")
+		assert.Nil(t, history[0].Message)
+
+		assert.Equal(t, api.BookingStatusCONFIRMED, history[1].From)
+		assert.Equal(t, &message, history[1].Message)
+	}
+
+	var b bytes.Buffer
+	util.PanicIf(WriteData(mockDB, &b))
+
+	reloaded, err := NewMockDBWithData(&b)
+	util.PanicIf(err)
+
+	reloadedHistory, err := reloaded.GetBookingHistory(id)
+	util.PanicIf(err)
+	assert.Len(t, reloadedHistory, 2, "history should be exported by WriteData")
+
+	util.PanicIf(mockDB.RemoveBooking(id))
+
+	_, err = mockDB.GetBookingHistory(id)
+	assert.IsType(t, MissingBookingErr{}, err)
+}
@@ -0,0 +1,217 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+)
+
+// File stores the data of the server in memory, and persists it in a json
+// file (format of `MockDBDataInterface`) after each modification.
+//
+// Writes are crash-safe: data is written to a temporary file, which is
+// synced to disk before replacing the previous file. The data file is then
+// either in its previous or its new state. If it cannot be written, the
+// modification is rolled back in memory as well.
+type File struct {
+	*Mock
+	path string
+
+	// saved is the content of the data file, restored if a modification
+	// cannot be saved
+	saved []byte
+
+	// write writes the data file, see `writeFileAtomic`
+	write func(path string, data []byte) error
+
+	// mu serializes modifications, so that the data file is written in the
+	// same order as data is modified
+	mu sync.Mutex
+}
+
+// NewFile returns a DB persisted in the file at `path`. If the file exists,
+// data is loaded from it. Otherwise the file is created with data of
+// `initial`.
+func NewFile(path string, initial *Mock) (*File, error) {
+	data, err := os.ReadFile(path)
+
+	switch {
+	case err == nil:
+		m, err := NewMockDBWithData(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+
+		return &File{Mock: m, path: path, saved: data, write: writeFileAtomic}, nil
+
+	case errors.Is(err, fs.ErrNotExist):
+		f := &File{Mock: initial, path: path, write: writeFileAtomic}
+		if err := f.save(); err != nil {
+			return nil, err
+		}
+
+		return f, nil
+
+	default:
+		return nil, err
+	}
+}
+
+// AddBooking adds a new booking to the data and persists it. Returns an
+// error if a booking with same ID already exists.
+func (f *File) AddBooking(booking api.Booking) error {
+	return f.persist(func() error { return f.Mock.AddBooking(booking) })
+}
+
+// CompareAndSetBookingStatus atomically sets the status of an existing
+// booking if its current status is `oldStatus`, and persists it with its
+// history. See `Mock.CompareAndSetBookingStatus`.
+func (f *File) CompareAndSetBookingStatus(bookingID api.BookingId, oldStatus api.BookingStatus, change StatusChange) error {
+	return f.persist(func() error {
+		return f.Mock.CompareAndSetBookingStatus(bookingID, oldStatus, change)
+	})
+}
+
+// AddMessage stores a message and persists it
+func (f *File) AddMessage(message api.PostMessagesJSONBody) error {
+	return f.persist(func() error { return f.Mock.AddMessage(message) })
+}
+
+// SetData replaces all data and persists it
+func (f *File) SetData(data MockDBDataInterface) error {
+	return f.persist(func() error { return f.Mock.SetData(data) })
+}
+
+func (f *File) AddDriverJourney(journey api.DriverJourney) error {
+	return f.persist(func() error { return f.Mock.AddDriverJourney(journey) })
+}
+
+func (f *File) RemoveDriverJourney(operator, id string) error {
+	return f.persist(func() error { return f.Mock.RemoveDriverJourney(operator, id) })
+}
+
+func (f *File) AddPassengerJourney(journey api.PassengerJourney) error {
+	return f.persist(func() error { return f.Mock.AddPassengerJourney(journey) })
+}
+
+func (f *File) RemovePassengerJourney(operator, id string) error {
+	return f.persist(func() error { return f.Mock.RemovePassengerJourney(operator, id) })
+}
+
+func (f *File) AddUser(user api.User) error {
+	return f.persist(func() error { return f.Mock.AddUser(user) })
+}
+
+func (f *File) RemoveUser(operator, id string) error {
+	return f.persist(func() error { return f.Mock.RemoveUser(operator, id) })
+}
+
+func (f *File) RemoveBooking(bookingID api.BookingId) error {
+	return f.persist(func() error { return f.Mock.RemoveBooking(bookingID) })
+}
+
+// persist applies a modification to the data, and saves the data if the
+// modification is successful. If the data cannot be saved, the modification
+// is rolled back, so that data in memory is the data of the file.
+func (f *File) persist(modify func() error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := modify(); err != nil {
+		return err
+	}
+
+	if err := f.save(); err != nil {
+		return f.rollback(err)
+	}
+
+	return nil
+}
+
+// save writes all data to the data file. f.mu must be held.
+func (f *File) save() error {
+	var b bytes.Buffer
+
+	if err := WriteData(f.Mock, &b); err != nil {
+		return err
+	}
+
+	if err := f.write(f.path, b.Bytes()); err != nil {
+		return err
+	}
+
+	f.saved = b.Bytes()
+
+	return nil
+}
+
+// rollback restores the data last saved, after a failed save with error
+// `saveErr`, which is returned. f.mu must be held.
+func (f *File) rollback(saveErr error) error {
+	var data MockDBDataInterface
+
+	if err := json.Unmarshal(f.saved, &data); err != nil {
+		return fmt.Errorf("%w (rollback failed: %s)", saveErr, err)
+	}
+
+	if err := f.Mock.SetData(data); err != nil {
+		return fmt.Errorf("%w (rollback failed: %s)", saveErr, err)
+	}
+
+	return saveErr
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory as
+// `path`, syncs it to disk and renames it to `path`.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	// No effect once the file has been renamed
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// syncDir syncs a directory, so that a rename in this directory is persisted.
+// This is best effort, as some platforms do not support syncing directories.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	_ = d.Sync()
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	initial := NewMockDB()
+	initial.Users = []api.User{{Id: "user", Operator: "operator.example.com"}}
+	initial.Messages = []api.PostMessagesJSONBody{{Message: "hello"}}
+
+	f, err := NewFile(path, initial)
+	util.PanicIf(err)
+
+	_, err = os.Stat(path)
+	assert.Nil(t, err, "store file should be created with initial data")
+
+	id := uuid.New()
+	util.PanicIf(f.AddBooking(api.Booking{Id: id, Status: api.BookingStatusWAITINGCONFIRMATION}))
+	util.PanicIf(f.CompareAndSetBookingStatus(id, api.BookingStatusWAITINGCONFIRMATION, StatusChange{Status: api.BookingStatusCONFIRMED}))
+
+	assert.IsType(t, MissingBookingErr{},
+		f.CompareAndSetBookingStatus(uuid.New(), api.BookingStatusWAITINGCONFIRMATION, StatusChange{Status: api.BookingStatusCONFIRMED}))
+	assert.NotNil(t, f.AddBooking(api.Booking{Id: id}))
+	util.PanicIf(f.AddUser(api.User{Id: "other", Operator: "operator.example.com"}))
+	util.PanicIf(f.RemoveUser("operator.example.com", "other"))
+
+	// Initial data is ignored if the store file exists
+	reloaded, err := NewFile(path, NewMockDB())
+	util.PanicIf(err)
+
+	booking, err := reloaded.GetBooking(id)
+	util.PanicIf(err)
+	assert.Equal(t, api.BookingStatusCONFIRMED, booking.Status)
+
+	history, err := reloaded.GetBookingHistory(id)
+	util.PanicIf(err)
+	assert.Len(t, history, 1, "status history should be persisted")
+	assert.Equal(t, initial.Users, reloaded.GetUsers())
+	assert.Equal(t, initial.Messages, reloaded.Messages)
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	util.PanicIf(err)
+	assert.Len(t, entries, 1, "temporary files should be removed")
+}
+
+func TestNewFileWithInvalidData(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	util.PanicIf(os.WriteFile(path, []byte("not json"), 0o600))
+
+	_, err := NewFile(path, NewMockDB())
+	assert.NotNil(t, err)
+}
+
+func TestFileWriteFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	f, err := NewFile(path, NewMockDB())
+	util.PanicIf(err)
+
+	id := uuid.New()
+	util.PanicIf(f.AddBooking(api.Booking{Id: id, Status: api.BookingStatusWAITINGCONFIRMATION}))
+
+	writeErr := errors.New("disk full")
+	f.write = func(string, []byte) error { return writeErr }
+
+	assert.ErrorIs(t, f.CompareAndSetBookingStatus(id, api.BookingStatusWAITINGCONFIRMATION, StatusChange{Status: api.BookingStatusCONFIRMED}), writeErr)
+	assert.ErrorIs(t, f.AddBooking(api.Booking{Id: uuid.New()}), writeErr)
+
+	booking, err := f.GetBooking(id)
+	util.PanicIf(err)
+	assert.Equal(t, api.BookingStatusWAITINGCONFIRMATION, booking.Status, "failed modification should be rolled back")
+	assert.Len(t, f.Data().Bookings, 1, "failed modification should be rolled back")
+
+	history, err := f.GetBookingHistory(id)
+	util.PanicIf(err)
+	assert.Empty(t, history, "failed modification should be rolled back")
+
+	// Data in memory is the data of the file
+	reloaded, err := NewFile(path, NewMockDB())
+	util.PanicIf(err)
+	assert.Equal(t, reloaded.Data(), f.Data())
+}
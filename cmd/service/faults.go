@@ -0,0 +1,364 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// FaultRule injects faults in the responses of an endpoint, to test the
+// resilience of clients. Rates are probabilities, between 0 and 1, drawn
+// independently for each request.
+type FaultRule struct {
+	// Endpoint is the method and path of the endpoint, as in the
+	// specification, e.g. "GET /driver_journeys" or "PATCH
+	// /bookings/{bookingId}". Without method, e.g. "/bookings/{bookingId}",
+	// any method matches. If empty, any endpoint matches.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Latency is added before each response
+	Latency Duration `json:"latency,omitempty"`
+
+	// DropRate is the rate of requests whose connection is closed without
+	// response
+	DropRate float64 `json:"dropRate,omitempty"`
+
+	// RateLimitRate is the rate of requests rejected with code 429 and a
+	// "Retry-After" header of RetryAfter seconds (1 by default)
+	RateLimitRate float64 `json:"rateLimitRate,omitempty"`
+	RetryAfter    int     `json:"retryAfter,omitempty"`
+
+	// ErrorRate is the rate of requests answered with code 500 or 503
+	ErrorRate float64 `json:"errorRate,omitempty"`
+
+	// TruncateRate is the rate of responses whose body is cut in half
+	TruncateRate float64 `json:"truncateRate,omitempty"`
+
+	// WrongContentTypeRate is the rate of responses sent with a "text/plain"
+	// content type
+	WrongContentTypeRate float64 `json:"wrongContentTypeRate,omitempty"`
+}
+
+// endpointRegexp matches the endpoint of a fault rule
+var endpointRegexp = regexp.MustCompile(`^(?:([A-Z]+) )?(/\S*)$`)
+
+// Validate checks that the rule is consistent
+func (r FaultRule) Validate() error {
+	if r.Endpoint != "" && !endpointRegexp.MatchString(r.Endpoint) {
+		return fmt.Errorf("invalid fault endpoint %q, expected e.g. \"GET /driver_journeys\"", r.Endpoint)
+	}
+
+	if r.Latency < 0 || r.RetryAfter < 0 {
+		return fmt.Errorf("fault latency and retryAfter must be positive (endpoint %q)", r.Endpoint)
+	}
+
+	for _, rate := range []float64{
+		r.DropRate, r.RateLimitRate, r.ErrorRate, r.TruncateRate, r.WrongContentTypeRate,
+	} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("fault rates must be between 0 and 1 (endpoint %q)", r.Endpoint)
+		}
+	}
+
+	return nil
+}
+
+// matches checks if the rule applies to a request on a route, given with
+// its path in the specification format (e.g. "/bookings/{bookingId}")
+func (r FaultRule) matches(method, routePath string) bool {
+	if r.Endpoint == "" {
+		return true
+	}
+
+	submatches := endpointRegexp.FindStringSubmatch(r.Endpoint)
+
+	return submatches != nil &&
+		(submatches[1] == "" || submatches[1] == method) &&
+		submatches[2] == routePath
+}
+
+// ReadFaultRules reads fault rules in json format, e.g.
+//
+//	[{"endpoint": "GET /driver_journeys", "latency": "2s", "errorRate": 0.1}]
+func ReadFaultRules(r io.Reader) ([]FaultRule, error) {
+	var rules []FaultRule
+
+	if err := json.NewDecoder(r).Decode(&rules); err != nil {
+		return nil, fmt.Errorf("invalid fault rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// ReadFaultRulesFile reads fault rules from a json file, see
+// `ReadFaultRules`
+func ReadFaultRulesFile(path string) ([]FaultRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadFaultRules(file)
+}
+
+// Duration is a time.Duration, in the format of `time.ParseDuration` in json
+// (e.g. "500ms")
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+
+	return nil
+}
+
+// Faults holds the fault rules of a server, which can be changed at runtime.
+// It is safe for concurrent use.
+type Faults struct {
+	mu     sync.Mutex
+	rules  []FaultRule
+	random *rand.Rand
+}
+
+// NewFaults returns faults with given rules. Rules are not validated.
+func NewFaults(rules []FaultRule) *Faults {
+	return &Faults{
+		rules:  rules,
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Rules returns the current fault rules
+func (f *Faults) Rules() []FaultRule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rules := make([]FaultRule, len(f.rules))
+	copy(rules, f.rules)
+
+	return rules
+}
+
+// SetRules replaces the fault rules, if they are all valid
+func (f *Faults) SetRules(rules []FaultRule) error {
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rules = rules
+
+	return nil
+}
+
+// draw returns the faults to inject in the response of a request, drawn from
+// the first rule matching the request. ok is false if no rule matches.
+func (f *Faults) draw(method, routePath string) (faults injectedFaults, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, rule := range f.rules {
+		if !rule.matches(method, routePath) {
+			continue
+		}
+
+		faults = injectedFaults{
+			latency:          time.Duration(rule.Latency),
+			drop:             f.random.Float64() < rule.DropRate,
+			rateLimit:        f.random.Float64() < rule.RateLimitRate,
+			retryAfter:       rule.RetryAfter,
+			error:            f.random.Float64() < rule.ErrorRate,
+			truncate:         f.random.Float64() < rule.TruncateRate,
+			wrongContentType: f.random.Float64() < rule.WrongContentTypeRate,
+			errorStatus:      http.StatusInternalServerError,
+		}
+
+		if f.random.Intn(2) == 0 {
+			faults.errorStatus = http.StatusServiceUnavailable
+		}
+
+		if faults.retryAfter == 0 {
+			faults.retryAfter = 1
+		}
+
+		return faults, true
+	}
+
+	return injectedFaults{}, false
+}
+
+// injectedFaults are the faults injected in the response of a single request
+type injectedFaults struct {
+	latency          time.Duration
+	drop             bool
+	rateLimit        bool
+	retryAfter       int
+	error            bool
+	errorStatus      int
+	truncate         bool
+	wrongContentType bool
+}
+
+// errInjectedFault is the error in the body of injected error responses
+var errInjectedFault = errors.New("injected fault")
+
+// faultInjector returns a middleware injecting faults in the responses of the
+// API, following the rules of `faults`. The admin API is left untouched.
+func faultInjector(faults *Faults, basePath string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if isAdminPath(ctx.Path(), basePath) {
+				return next(ctx)
+			}
+
+			injected, ok := faults.draw(ctx.Request().Method, specPath(ctx.Path(), basePath))
+			if !ok {
+				return next(ctx)
+			}
+
+			if injected.latency > 0 {
+				select {
+				case <-time.After(injected.latency):
+				case <-ctx.Request().Context().Done():
+					return nil
+				}
+			}
+
+			switch {
+			case injected.drop:
+				dropConnection(ctx)
+				return nil
+
+			case injected.rateLimit:
+				ctx.Response().Header().Set("Retry-After", strconv.Itoa(injected.retryAfter))
+				return ctx.JSON(http.StatusTooManyRequests, errorBody(errInjectedFault))
+
+			case injected.error:
+				return ctx.JSON(injected.errorStatus, errorBody(errInjectedFault))
+
+			case injected.truncate || injected.wrongContentType:
+				return alterResponse(ctx, next, injected)
+
+			default:
+				return next(ctx)
+			}
+		}
+	}
+}
+
+// specPath converts an echo route path (e.g. "/stdcov/bookings/:bookingId")
+// to the path of the specification (e.g. "/bookings/{bookingId}")
+func specPath(routePath, basePath string) string {
+	segments := strings.Split(strings.TrimPrefix(routePath, basePath), "/")
+
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// dropConnection closes the connection of the request without response
+func dropConnection(ctx echo.Context) {
+	conn, _, err := ctx.Response().Hijack()
+	if err != nil {
+		// e.g. HTTP/2, the server closes the stream
+		panic(http.ErrAbortHandler)
+	}
+
+	conn.Close()
+}
+
+// alterResponse buffers the response of the handler, and sends it truncated
+// and/or with a wrong content type
+func alterResponse(ctx echo.Context, next echo.HandlerFunc, injected injectedFaults) error {
+	return rewriteResponse(ctx, func() error {
+		return next(ctx)
+	}, func(status int, body []byte) (int, []byte) {
+		if injected.truncate {
+			body = body[:len(body)/2]
+		}
+
+		if injected.wrongContentType {
+			ctx.Response().Header().Set(echo.HeaderContentType, echo.MIMETextPlainCharsetUTF8)
+		}
+
+		return status, body
+	})
+}
+
+// rewriteResponse buffers the response written by handle, and sends it with
+// the status code and body returned by rewrite. Headers may be changed in
+// rewrite.
+func rewriteResponse(
+	ctx echo.Context,
+	handle func() error,
+	rewrite func(status int, body []byte) (int, []byte),
+) error {
+	response := ctx.Response()
+	writer := &bufferedWriter{ResponseWriter: response.Writer, status: http.StatusOK}
+	response.Writer = writer
+
+	err := handle()
+	if err != nil {
+		ctx.Error(err)
+	}
+
+	response.Writer = writer.ResponseWriter
+
+	status, body := rewrite(writer.status, writer.body.Bytes())
+
+	response.Header().Del(echo.HeaderContentLength)
+	response.Writer.WriteHeader(status)
+	_, err = response.Writer.Write(body)
+
+	return err
+}
+
+// bufferedWriter holds the status code and body of a response, instead of
+// writing them
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
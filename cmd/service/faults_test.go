@@ -0,0 +1,221 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/service/db"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
+)
+
+func TestFaultInjection(t *testing.T) {
+	var (
+		basePath           = "/stdcov"
+		latency            = 100 * time.Millisecond
+		getBooking         = "GET /bookings/{bookingId}"
+		bookingPath        = "/bookings/" + repUUID(800).String()
+		missingBookingPath = "/bookings/" + repUUID(801).String()
+	)
+
+	testCases := []struct {
+		name                string
+		rule                FaultRule
+		path                string
+		expectDropped       bool
+		expectedStatusCodes []int
+		expectedContentType string
+		expectValidJSON     bool
+		expectedRetryAfter  string
+	}{
+		{"no fault", FaultRule{Endpoint: getBooking},
+			bookingPath, false, []int{http.StatusOK}, "application/json", true, ""},
+		{"latency", FaultRule{Endpoint: getBooking, Latency: Duration(latency)},
+			bookingPath, false, []int{http.StatusOK}, "application/json", true, ""},
+		{"dropped connection", FaultRule{Endpoint: getBooking, DropRate: 1},
+			bookingPath, true, nil, "", false, ""},
+		{"rate limit", FaultRule{Endpoint: getBooking, RateLimitRate: 1, RetryAfter: 5},
+			bookingPath, false, []int{http.StatusTooManyRequests}, "application/json", true, "5"},
+		{"rate limit with default Retry-After", FaultRule{Endpoint: getBooking, RateLimitRate: 1},
+			bookingPath, false, []int{http.StatusTooManyRequests}, "application/json", true, "1"},
+		{"server error", FaultRule{Endpoint: getBooking, ErrorRate: 1},
+			bookingPath, false, []int{http.StatusInternalServerError, http.StatusServiceUnavailable},
+			"application/json", true, ""},
+		{"truncated body", FaultRule{Endpoint: getBooking, TruncateRate: 1},
+			bookingPath, false, []int{http.StatusOK}, "application/json", false, ""},
+		{"wrong content type", FaultRule{Endpoint: getBooking, WrongContentTypeRate: 1},
+			bookingPath, false, []int{http.StatusOK}, "text/plain", true, ""},
+		{"truncated error response", FaultRule{Endpoint: getBooking, TruncateRate: 1},
+			missingBookingPath, false, []int{http.StatusNotFound}, "application/json", false, ""},
+		{"any method", FaultRule{Endpoint: "/bookings/{bookingId}", ErrorRate: 1},
+			bookingPath, false, []int{http.StatusInternalServerError, http.StatusServiceUnavailable},
+			"application/json", true, ""},
+		{"any endpoint", FaultRule{RateLimitRate: 1},
+			"/status", false, []int{http.StatusTooManyRequests}, "application/json", true, "1"},
+		{"other endpoint", FaultRule{Endpoint: "GET /status", ErrorRate: 1},
+			bookingPath, false, []int{http.StatusOK}, "application/json", true, ""},
+		{"other method", FaultRule{Endpoint: "PATCH /bookings/{bookingId}", ErrorRate: 1},
+			bookingPath, false, []int{http.StatusOK}, "application/json", true, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := Config{BasePath: basePath, Faults: []FaultRule{tc.rule}}
+
+			mockDB := db.NewMockDB()
+			mockDB.Bookings = NewBookingsByID(makeBooking(repUUID(800)))
+
+			server := httptest.NewServer(newEcho(NewServerWithDB(mockDB), config))
+			defer server.Close()
+
+			start := time.Now()
+
+			response, err := http.Get(server.URL + basePath + tc.path)
+			if tc.expectDropped {
+				if err == nil {
+					response.Body.Close()
+					t.Error("expected connection to be dropped")
+				}
+
+				return
+			}
+
+			util.PanicIf(err)
+			defer response.Body.Close()
+
+			if time.Since(start) < time.Duration(tc.rule.Latency) {
+				t.Errorf("expected latency of at least %s", time.Duration(tc.rule.Latency))
+			}
+
+			if !containsInt(tc.expectedStatusCodes, response.StatusCode) {
+				t.Errorf("expected status code in %v, got %d", tc.expectedStatusCodes, response.StatusCode)
+			}
+
+			contentType := response.Header.Get("Content-Type")
+			if tc.expectedContentType != "" && !strings.HasPrefix(contentType, tc.expectedContentType) {
+				t.Errorf("expected content type %s, got %s", tc.expectedContentType, contentType)
+			}
+
+			var body interface{}
+			if validJSON := json.NewDecoder(response.Body).Decode(&body) == nil; tc.expectValidJSON && !validJSON {
+				t.Error("expected a valid json body")
+			} else if !tc.expectValidJSON && validJSON {
+				t.Error("expected an invalid json body")
+			}
+
+			if got := response.Header.Get("Retry-After"); got != tc.expectedRetryAfter {
+				t.Errorf("expected Retry-After header %q, got %q", tc.expectedRetryAfter, got)
+			}
+		})
+	}
+}
+
+func containsInt(slice []int, i int) bool {
+	for _, item := range slice {
+		if item == i {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestFaultRuleValidate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		rule        FaultRule
+		expectError bool
+	}{
+		{"empty rule", FaultRule{}, false},
+		{"endpoint with method", FaultRule{Endpoint: "GET /driver_journeys"}, false},
+		{"endpoint without method", FaultRule{Endpoint: "/bookings/{bookingId}"}, false},
+		{"invalid endpoint", FaultRule{Endpoint: "driver_journeys"}, true},
+		{"lower case method", FaultRule{Endpoint: "get /driver_journeys"}, true},
+		{"rate above 1", FaultRule{ErrorRate: 1.5}, true},
+		{"negative rate", FaultRule{DropRate: -0.1}, true},
+		{"negative latency", FaultRule{Latency: Duration(-time.Second)}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.rule.Validate(); (err != nil) != tc.expectError {
+				t.Errorf("expected error: %t, got %v", tc.expectError, err)
+			}
+		})
+	}
+}
+
+func TestReadFaultRules(t *testing.T) {
+	rules, err := ReadFaultRules(strings.NewReader(
+		`[{"endpoint": "GET /driver_journeys", "latency": "500ms", "errorRate": 0.1}]`,
+	))
+	util.PanicIf(err)
+
+	expected := FaultRule{Endpoint: "GET /driver_journeys", Latency: Duration(500 * time.Millisecond), ErrorRate: 0.1}
+	if len(rules) != 1 || rules[0] != expected {
+		t.Errorf("expected rules %+v, got %+v", []FaultRule{expected}, rules)
+	}
+
+	if _, err := ReadFaultRules(strings.NewReader(`[{"latency": "soon"}]`)); err == nil {
+		t.Error("expected an error on invalid latency")
+	}
+}
+
+func TestAdminFaults(t *testing.T) {
+	server := httptest.NewServer(newEcho(NewServerWithDB(db.NewMockDB()), Config{AdminKey: adminKey}))
+	defer server.Close()
+
+	getStatus := func() int {
+		response, err := http.Get(server.URL + "/status")
+		util.PanicIf(err)
+		response.Body.Close()
+
+		return response.StatusCode
+	}
+
+	rules := []FaultRule{{Endpoint: "GET /status", RateLimitRate: 1}}
+
+	if code, body := adminRequest(t, server, http.MethodPut, "/admin/faults", adminKey, rules); code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d (%s)", http.StatusOK, code, body)
+	}
+
+	if code := getStatus(); code != http.StatusTooManyRequests {
+		t.Errorf("expected fault to be injected at runtime, got status code %d", code)
+	}
+
+	code, body := adminRequest(t, server, http.MethodGet, "/admin/faults", adminKey, nil)
+	if code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d (%s)", http.StatusOK, code, body)
+	}
+
+	var current []FaultRule
+	util.PanicIf(json.Unmarshal(body, &current))
+
+	if len(current) != 1 || current[0] != rules[0] {
+		t.Errorf("expected rules %+v, got %+v", rules, current)
+	}
+
+	invalidRules := []FaultRule{{ErrorRate: 2}}
+	if code, _ := adminRequest(t, server, http.MethodPut, "/admin/faults", adminKey, invalidRules); code != http.StatusBadRequest {
+		t.Errorf("expected invalid rules to be rejected with code %d, got %d", http.StatusBadRequest, code)
+	}
+
+	if code, _ := adminRequest(t, server, http.MethodPut, "/admin/faults", adminKey, []FaultRule{}); code != http.StatusOK {
+		t.Errorf("expected status code %d, got %d", http.StatusOK, code)
+	}
+
+	if code := getStatus(); code != http.StatusOK {
+		t.Errorf("expected faults to be disabled, got status code %d", code)
+	}
+
+	// The admin API is not affected by faults
+	allEndpoints := []FaultRule{{ErrorRate: 1}}
+	adminRequest(t, server, http.MethodPut, "/admin/faults", adminKey, allEndpoints)
+
+	if code, _ := adminRequest(t, server, http.MethodGet, "/admin/faults", adminKey, nil); code != http.StatusOK {
+		t.Errorf("expected admin API to be unaffected by faults, got status code %d", code)
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"time"
@@ -21,65 +22,61 @@ func keepNFirst[K any](slice []K, n int) []K {
 	return slice
 }
 
-var statusToIntMap = map[api.BookingStatus]int{
-	api.BookingStatusWAITINGCONFIRMATION:        0,
-	api.BookingStatusCONFIRMED:                  1,
-	api.BookingStatusCOMPLETEDPENDINGVALIDATION: 2,
-	api.BookingStatusVALIDATED:                  3,
-	api.BookingStatusCANCELLED:                  4,
-}
-
-// statusIsAfter checks if status1 is strictly after status2
-func statusIsAfter(status1, status2 api.BookingStatus) (bool, error) {
-	status1Rank, err := statusRank(status1)
-	if err != nil {
-		return false, err
-	}
-
-	status2Rank, err := statusRank(status2)
-	if err != nil {
-		return false, err
-	}
-
-	return status1Rank > status2Rank, nil
-}
-
 type StatusAlreadySetErr struct{}
 
 func (err StatusAlreadySetErr) Error() string {
 	return "status_already_set"
 }
 
-// UpdateBookingStatus updates the status of a booking. Status can only be
-// updated for a higher ranked status. If this is not the case, or if the
-// booking is not found, returns an error
-func UpdateBookingStatus(m db.DB, bookingID uuid.UUID, newStatus api.BookingStatus) error {
-	booking, err := m.GetBooking(bookingID)
-	if err != nil {
-		return err
-	}
+// IllegalTransitionErr is returned when a booking status update is not
+// allowed by the booking state machine
+type IllegalTransitionErr struct {
+	From api.BookingStatus
+	To   api.BookingStatus
+}
 
-	statusAfter, err := statusIsAfter(newStatus, booking.Status)
-	if err != nil {
-		return err
-	}
+func (err IllegalTransitionErr) Error() string {
+	return fmt.Sprintf("illegal_transition: booking status cannot change from %s to %s",
+		err.From, err.To)
+}
+
+// UpdateBookingStatus updates the status of a booking to `change.Status`,
+// following the booking state machine (see `api.BookingStatus.CanTransitionTo`),
+// and records the change in the status history of the booking. Returns
+// StatusAlreadySetErr if the booking already has the new status,
+// IllegalTransitionErr if the transition is not allowed, or an error if the
+// status is invalid or the booking is not found.
+//
+// The update is an atomic compare-and-set: if the status is concurrently
+// changed, the transition is checked again against the new status.
+func UpdateBookingStatus(m db.DB, bookingID uuid.UUID, change db.StatusChange) error {
+	newStatus := change.Status
 
-	if !statusAfter {
-		return StatusAlreadySetErr{}
+	if !newStatus.IsValid() {
+		return fmt.Errorf("%s is not a valid status", newStatus)
 	}
 
-	booking.Status = newStatus
+	for {
+		booking, err := m.GetBooking(bookingID)
+		if err != nil {
+			return err
+		}
 
-	return nil
-}
+		if booking.Status == newStatus {
+			return StatusAlreadySetErr{}
+		}
 
-func statusRank(status api.BookingStatus) (int, error) {
-	statusRank, ok2 := statusToIntMap[status]
-	if !ok2 {
-		return 0, fmt.Errorf("%s is not a valid status", status)
-	}
+		if !booking.Status.CanTransitionTo(newStatus) {
+			return IllegalTransitionErr{From: booking.Status, To: newStatus}
+		}
 
-	return statusRank, nil
+		err = m.CompareAndSetBookingStatus(bookingID, booking.Status, change)
+
+		var statusChanged db.StatusChangedErr
+		if !errors.As(err, &statusChanged) {
+			return err
+		}
+	}
 }
 
 // errorBody creates an api.BadRequest body from a go error
@@ -202,8 +199,8 @@ func anyJourneyScheduleInMinMax(journeySchedules []api.JourneySchedule, min, max
 	return false
 }
 
-// durationBetweenTimeOfDays returns the duration between two partial times,
-// considering them on the same day.
+// durationBetweenTimeOfDays returns the duration in seconds between two
+// partial times, modulo 24h (e.g. 23:30:00 and 00:15:00 are 45 minutes apart).
 func durationBetweenTimeOfDays(t1, t2 string) (float64, error) {
 	time1, err := time.Parse("15:04:05", t1)
 	if err != nil {
@@ -215,7 +212,12 @@ func durationBetweenTimeOfDays(t1, t2 string) (float64, error) {
 		return 0, err
 	}
 
-	return time1.Sub(time2).Abs().Seconds(), nil
+	d := time1.Sub(time2).Abs()
+	if d > 12*time.Hour {
+		d = 24*time.Hour - d
+	}
+
+	return d.Seconds(), nil
 }
 
 // keepTrip checks if a trip object is compliant with the query parameters
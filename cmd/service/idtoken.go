@@ -0,0 +1,342 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // registers SHA-256 for crypto.Hash
+	_ "crypto/sha512" // registers SHA-384 and SHA-512 for crypto.Hash
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// idTokenLifetime is the validity of the idTokens signed by the server
+const idTokenLifetime = time.Hour
+
+// InvalidIDTokenErr is returned when the idToken of a booking event is
+// rejected
+type InvalidIDTokenErr struct {
+	Reason string
+}
+
+func (err InvalidIDTokenErr) Error() string {
+	return "invalid idToken: " + err.Reason
+}
+
+func invalidIDToken(format string, a ...interface{}) InvalidIDTokenErr {
+	return InvalidIDTokenErr{fmt.Sprintf(format, a...)}
+}
+
+// IDTokenVerifier verifies the idToken of booking events, as a JWT. Tokens
+// signed with HMAC (HS256, HS384, HS512) are verified with a shared secret,
+// tokens signed with RSA (RS256, RS384, RS512) or ECDSA (ES256, ES384, ES512)
+// with the public keys of a JWKS. Their audience must include the operator
+// served by the server.
+type IDTokenVerifier struct {
+	audience string
+	secret   []byte
+	// keys of the JWKS, by key ID
+	keys map[string]crypto.PublicKey
+	now  func() time.Time
+}
+
+// NewIDTokenVerifier returns a verifier expecting an audience, with a shared
+// secret and a JWKS, either of which may be empty.
+func NewIDTokenVerifier(audience, secret string, jwks []byte) (*IDTokenVerifier, error) {
+	v := &IDTokenVerifier{
+		audience: audience,
+		secret:   []byte(secret),
+		keys:     map[string]crypto.PublicKey{},
+		now:      time.Now,
+	}
+
+	if len(jwks) == 0 {
+		return v, nil
+	}
+
+	var keySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := json.Unmarshal(jwks, &keySet); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	for _, jwk := range keySet.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS key %q: %w", jwk.Kid, err)
+		}
+
+		v.keys[jwk.Kid] = key
+	}
+
+	return v, nil
+}
+
+// ReadJWKS reads a JWKS from a file path, or from an http(s) URL
+func ReadJWKS(pathOrURL string) ([]byte, error) {
+	if !strings.HasPrefix(pathOrURL, "http://") && !strings.HasPrefix(pathOrURL, "https://") {
+		return os.ReadFile(pathOrURL)
+	}
+
+	response, err := http.Get(pathOrURL)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: status code %d", response.StatusCode)
+	}
+
+	return io.ReadAll(response.Body)
+}
+
+// Verify checks the signature and expiry of an idToken, and that its
+// audience includes the expected audience. It returns an InvalidIDTokenErr if
+// the token is rejected.
+func (v *IDTokenVerifier) Verify(token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return invalidIDToken("not a JWT")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return invalidIDToken("malformed header")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return invalidIDToken("malformed signature")
+	}
+
+	if err := v.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], signature); err != nil {
+		return err
+	}
+
+	var claims struct {
+		Exp *float64 `json:"exp"`
+		Nbf *float64 `json:"nbf"`
+		Aud audience `json:"aud"`
+	}
+
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return invalidIDToken("malformed claims")
+	}
+
+	now := v.now()
+
+	if claims.Exp == nil {
+		return invalidIDToken("missing expiry")
+	}
+
+	if exp := time.Unix(int64(*claims.Exp), 0); !now.Before(exp) {
+		return invalidIDToken("expired at %s", exp.UTC().Format(time.RFC3339))
+	}
+
+	if claims.Nbf != nil && now.Before(time.Unix(int64(*claims.Nbf), 0)) {
+		return invalidIDToken("not valid yet")
+	}
+
+	for _, aud := range claims.Aud {
+		if aud == v.audience {
+			return nil
+		}
+	}
+
+	return invalidIDToken("audience %v does not match operator %s", []string(claims.Aud), v.audience)
+}
+
+func (v *IDTokenVerifier) verifySignature(alg, kid, signingInput string, signature []byte) error {
+	if len(alg) != 5 {
+		return invalidIDToken("unsupported algorithm %q", alg)
+	}
+
+	hash, ok := map[string]crypto.Hash{
+		"256": crypto.SHA256,
+		"384": crypto.SHA384,
+		"512": crypto.SHA512,
+	}[alg[2:]]
+	if !ok {
+		return invalidIDToken("unsupported algorithm %q", alg)
+	}
+
+	digest := hash.New()
+	digest.Write([]byte(signingInput))
+
+	switch alg[:2] {
+	case "HS":
+		if len(v.secret) == 0 {
+			return invalidIDToken("no shared secret to verify %s signature", alg)
+		}
+
+		mac := hmac.New(hash.New, v.secret)
+		mac.Write([]byte(signingInput))
+
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return invalidIDToken("invalid signature")
+		}
+
+		return nil
+
+	case "RS":
+		key, ok := v.keys[kid].(*rsa.PublicKey)
+		if !ok {
+			return invalidIDToken("unknown RSA key %q", kid)
+		}
+
+		if rsa.VerifyPKCS1v15(key, hash, digest.Sum(nil), signature) != nil {
+			return invalidIDToken("invalid signature")
+		}
+
+		return nil
+
+	case "ES":
+		key, ok := v.keys[kid].(*ecdsa.PublicKey)
+		if !ok {
+			return invalidIDToken("unknown EC key %q", kid)
+		}
+
+		size := len(signature) / 2
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+
+		if !ecdsa.Verify(key, digest.Sum(nil), r, s) {
+			return invalidIDToken("invalid signature")
+		}
+
+		return nil
+
+	default:
+		return invalidIDToken("unsupported algorithm %q", alg)
+	}
+}
+
+// signIDToken returns an idToken for a user, as a JWT signed with a shared
+// secret (HS256), for an operator audience
+func signIDToken(secret []byte, subject, audience string, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]interface{}{
+		"sub": subject,
+		"aud": audience,
+		"iat": now.Unix(),
+		"exp": now.Add(idTokenLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(claims)
+
+	mac := hmac.New(crypto.SHA256.New, secret)
+	mac.Write([]byte(signingInput))
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// audience is the "aud" claim, either a single string or an array of
+// strings
+type audience []string
+
+func (aud *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*aud = audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(b, &multiple); err != nil {
+		return err
+	}
+
+	*aud = multiple
+
+	return nil
+}
+
+// jsonWebKey is a public key of a JWKS, as in RFC 7517
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	// RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC keys
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+
+		if errN != nil || errE != nil || len(e) == 0 {
+			return nil, errors.New("malformed RSA key")
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+
+	case "EC":
+		curve, ok := map[string]elliptic.Curve{
+			"P-256": elliptic.P256(),
+			"P-384": elliptic.P384(),
+			"P-521": elliptic.P521(),
+		}[jwk.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+
+		x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+		y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+
+		if errX != nil || errY != nil {
+			return nil, errors.New("malformed EC key")
+		}
+
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
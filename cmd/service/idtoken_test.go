@@ -0,0 +1,246 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/service/db"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/test"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
+)
+
+const idTokenSecret = "id-token-secret"
+
+// signJWT returns a JWT with given claims, signed with a shared secret
+// ([]byte), or a RSA or ECDSA private key
+func signJWT(alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	util.PanicIf(err)
+
+	payload, err := json.Marshal(claims)
+	util.PanicIf(err)
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(signingInput))
+
+	var signature []byte
+
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(crypto.SHA256.New, k)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest.Sum(nil))
+		util.PanicIf(err)
+
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest.Sum(nil))
+		util.PanicIf(err)
+
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func makeClaims(aud interface{}, exp time.Time) map[string]interface{} {
+	return map[string]interface{}{"sub": "user", "aud": aud, "exp": exp.Unix()}
+}
+
+func makeJWKS(rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) []byte {
+	encode := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+
+	jwks, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": "rsa-key",
+				"n":   encode(rsaKey.N),
+				"e":   encode(big.NewInt(int64(rsaKey.E))),
+			},
+			{
+				"kty": "EC",
+				"kid": "ec-key",
+				"crv": "P-256",
+				"x":   encode(ecKey.X),
+				"y":   encode(ecKey.Y),
+			},
+		},
+	})
+	util.PanicIf(err)
+
+	return jwks
+}
+
+// withDriverOperator returns booking event data with a driver of given
+// operator
+func withDriverOperator(data api.CarpoolBookingEvent_Data, operator string) api.CarpoolBookingEvent_Data {
+	booking, err := data.AsDriverCarpoolBooking()
+	util.PanicIf(err)
+
+	booking.Driver = makeUserWithOperator("driver", "driver", operator)
+	util.PanicIf(data.FromDriverCarpoolBooking(booking))
+
+	return data
+}
+
+func TestIDTokenVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	util.PanicIf(err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	util.PanicIf(err)
+
+	otherRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	util.PanicIf(err)
+
+	verifier, err := NewIDTokenVerifier(operatorA, idTokenSecret, makeJWKS(rsaKey, ecKey))
+	util.PanicIf(err)
+
+	var (
+		secret  = []byte(idTokenSecret)
+		valid   = makeClaims(operatorA, time.Now().Add(time.Hour))
+		expired = makeClaims(operatorA, time.Now().Add(-time.Hour))
+	)
+
+	testCases := []struct {
+		name        string
+		token       string
+		expectError bool
+	}{
+		{"valid HS256 token", signJWT("HS256", "", secret, valid), false},
+		{"valid RS256 token", signJWT("RS256", "rsa-key", rsaKey, valid), false},
+		{"valid ES256 token", signJWT("ES256", "ec-key", ecKey, valid), false},
+		{"audience in array", signJWT("HS256", "", secret,
+			makeClaims([]string{operatorB, operatorA}, time.Now().Add(time.Hour))), false},
+		{"not a JWT", "token", true},
+		{"empty token", "", true},
+		{"forged HS256 token", signJWT("HS256", "", []byte("forged"), valid), true},
+		{"forged RS256 token", signJWT("RS256", "rsa-key", otherRSAKey, valid), true},
+		{"unknown key", signJWT("RS256", "other-key", rsaKey, valid), true},
+		{"unsigned token", signJWT("none", "", nil, valid), true},
+		{"expired token", signJWT("HS256", "", secret, expired), true},
+		{"missing expiry", signJWT("HS256", "", secret, map[string]interface{}{"aud": operatorA}), true},
+		{"wrong audience", signJWT("HS256", "", secret, makeClaims(operatorB, time.Now().Add(time.Hour))), true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifier.Verify(tc.token)
+
+			if (err != nil) != tc.expectError {
+				t.Errorf("expected error: %t, got %v", tc.expectError, err)
+			}
+
+			var invalidErr InvalidIDTokenErr
+			if err != nil && !errors.As(err, &invalidErr) {
+				t.Errorf("expected an InvalidIDTokenErr, got %T", err)
+			}
+		})
+	}
+}
+
+func TestPostBookingEventsWithIDToken(t *testing.T) {
+	handler := NewServerWithDB(db.NewMockDB())
+	handler.idTokenVerifier, _ = NewIDTokenVerifier(operatorA, idTokenSecret, nil)
+
+	server := httptest.NewServer(newEcho(handler, Config{}))
+	defer server.Close()
+
+	var (
+		secret    = []byte(idTokenSecret)
+		inOneHour = time.Now().Add(time.Hour)
+	)
+
+	testCases := []struct {
+		name           string
+		idToken        string
+		driverOperator string
+		expectedCode   int
+	}{
+		{"forged idToken", signJWT("HS256", "", []byte("forged"), makeClaims(operatorA, inOneHour)), operatorA, http.StatusUnauthorized},
+		{"expired idToken", signJWT("HS256", "", secret, makeClaims(operatorA, time.Now())), operatorA, http.StatusUnauthorized},
+		{"audience of another operator", signJWT("HS256", "", secret, makeClaims(operatorB, inOneHour)), operatorA, http.StatusUnauthorized},
+		{"audience of the operator in the event", signJWT("HS256", "", secret, makeClaims(operatorB, inOneHour)), operatorB, http.StatusUnauthorized},
+		{"valid idToken", signJWT("HS256", "", secret, makeClaims(operatorA, inOneHour)), operatorB, http.StatusOK},
+	}
+
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			event := makeCarpoolBookingEvent(repUUID(int64(710+2*i)), repUUID(int64(711+2*i)))
+			event.IdToken = tc.idToken
+
+			event.Data = withDriverOperator(event.Data, tc.driverOperator)
+
+			code, body := adminRequest(t, server, http.MethodPost, "/booking_events", "", event)
+
+			if code != tc.expectedCode {
+				t.Errorf("expected status code %d, got %d (%s)", tc.expectedCode, code, body)
+			}
+		})
+	}
+}
+
+func TestExpectIDTokenVerified(t *testing.T) {
+	testCases := []struct {
+		name        string
+		verifier    bool
+		expectError bool
+	}{
+		{"idToken verified", true, false},
+		{"idToken not verified", false, true},
+	}
+
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := NewServerWithDB(db.NewMockDB())
+			if tc.verifier {
+				handler.idTokenVerifier, _ = NewIDTokenVerifier(operatorA, idTokenSecret, nil)
+			}
+
+			server := httptest.NewServer(newEcho(handler, Config{}))
+			defer server.Close()
+
+			event := makeCarpoolBookingEvent(repUUID(int64(720+2*i)), repUUID(int64(721+2*i)))
+			event.Data = withDriverOperator(event.Data, operatorA)
+			event.IdToken = signJWT("HS256", "", []byte(idTokenSecret),
+				makeClaims(operatorA, time.Now().Add(time.Hour)))
+
+			body, err := json.Marshal(event)
+			util.PanicIf(err)
+
+			flags := test.NewFlags()
+			flags.ExpectIDTokenVerified = true
+			flags.IDTokenSecret = idTokenSecret
+			flags.IDTokenAudience = operatorA
+
+			err = test.RunTest(http.MethodPost, server.URL+"/booking_events", test.NewQuery(), body,
+				false, "", flags)
+			if (err != nil) != tc.expectError {
+				t.Errorf("expected error: %t, got %s", tc.expectError, err)
+			}
+		})
+	}
+}
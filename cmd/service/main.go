@@ -1,46 +1,211 @@
 // Package service serves a fake API complying with standard covoiturage
 // specification.
 //
-// The server is launched wih the `Run` function, which optionally accepts the
-// path to a data file (json format). See Package db documentation for more
-// information about the data format. If an empty path is provided, then
-// default data is loaded.
+// The server is launched wih the `Run` function, which accepts a `Config`.
+// The config optionally holds the path to a data file (json format). See
+// Package db documentation for more information about the data format. If an
+// empty path is provided, then default data is loaded. Data is stored in
+// memory, unless the config holds the path to a store file, where data is
+// persisted.
 package service
 
 import (
+	"context"
+	"errors"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
 	"github.com/fabmob/playground-standard-covoiturage/cmd/service/db"
 	"github.com/labstack/echo/v4"
 )
 
+// shutdownTimeout is the time given to pending requests to complete on
+// shutdown
+const shutdownTimeout = 10 * time.Second
+
 // Run serves a server with an implementation of the API enforcing the
-// "standard-covoiturage" specification
-func Run(dataFile string) {
-	e := echo.New()
+// "standard-covoiturage" specification. It stops gracefully on SIGINT or
+// SIGTERM.
+func Run(config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	handler, err := newHandler(config)
+	if err != nil {
+		return err
+	}
+
+	e := newEcho(handler, config)
+
+	if config.WebhookURL != "" {
+		webhook, err := NewWebhook(config.WebhookURL, config.WebhookAPIKey, config.WebhookIDTokenSecret)
+		if err != nil {
+			return err
+		}
+
+		webhook.logger = e.Logger
+		handler.webhook = webhook
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if config.Automation.Enabled() {
+		handler.automation = NewAutomation(config.Automation, handler.db,
+			func(bookingID api.BookingId) {
+				handler.webhook.NotifyStatusChange(handler.db, bookingID)
+			},
+		)
+		handler.automation.logger = e.Logger
+
+		go handler.automation.Run(ctx)
+	}
+
+	err = serve(ctx, e, config)
+
+	if handler.webhook != nil {
+		// Notifications of the last requests are delivered before exiting
+		closeCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if closeErr := handler.webhook.Close(closeCtx); err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+func newHandler(config Config) (*StdCovServerImpl, error) {
+	mockDB, err := readData(config.DataFile)
+	if err != nil {
+		return nil, err
+	}
 
 	var handler *StdCovServerImpl
 
-	if dataFile == "" {
-		handler = NewDefaultServer()
+	if config.StoreFile == "" {
+		handler = NewServerWithDB(mockDB)
 	} else {
-		fileReader, err := os.Open(dataFile)
-		exitIfErr(err, e)
+		fileDB, err := db.NewFile(config.StoreFile, mockDB)
+		if err != nil {
+			return nil, err
+		}
 
-		mockDB, err := db.NewMockDBWithData(fileReader)
-		exitIfErr(err, e)
+		handler = NewServerWithDB(fileDB)
+	}
 
-		handler = NewServerWithDB(mockDB)
+	if config.VerifyIDToken() {
+		handler.idTokenVerifier, err = newIDTokenVerifier(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return handler, nil
+}
+
+func newIDTokenVerifier(config Config) (*IDTokenVerifier, error) {
+	var jwks []byte
+
+	if config.IDTokenJWKS != "" {
+		var err error
+
+		jwks, err = ReadJWKS(config.IDTokenJWKS)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	api.RegisterHandlers(e, handler)
-	e.Logger.Fatal(e.Start(":1323"))
+	return NewIDTokenVerifier(config.IDTokenAudience, config.IDTokenSecret, jwks)
 }
 
-func exitIfErr(err error, e *echo.Echo) {
+// readData reads initial data from a data file, or default data if dataFile
+// is empty
+func readData(dataFile string) (*db.Mock, error) {
+	if dataFile == "" {
+		return db.NewMockDBWithDefaultData(), nil
+	}
+
+	fileReader, err := os.Open(dataFile)
 	if err != nil {
-		e.Logger.Fatal(err)
-		os.Exit(1)
+		return nil, err
+	}
+	defer fileReader.Close()
+
+	return db.NewMockDBWithData(fileReader)
+}
+
+// newEcho returns an echo instance serving the API under the base path of the
+// config, with the fault rules and violations of the config, and the admin
+// API if an admin key is set
+func newEcho(handler *StdCovServerImpl, config Config) *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = badRequestErrorHandler(e)
+	basePath := config.NormalizedBasePath()
+	faults := NewFaults(config.Faults)
+
+	e.Use(faultInjector(faults, basePath))
+
+	if !violates(config.Violations, ViolationAuthentication) {
+		e.Use(apiKeyAuth(config.APIKeys, basePath))
+	}
+
+	e.Use(requestValidator(basePath))
+
+	if len(config.Violations) > 0 {
+		api.RegisterHandlersWithBaseURL(e, newViolatingServer(handler, config.Violations), basePath)
+	} else {
+		api.RegisterHandlersWithBaseURL(e, handler, basePath)
+	}
+
+	if config.AdminKey != "" {
+		registerAdminHandlers(e, handler, faults, basePath, config.AdminKey)
+	}
+
+	return e
+}
+
+// serve starts the server, and shuts it down gracefully when the context is
+// done.
+func serve(ctx context.Context, e *echo.Echo, config Config) error {
+	startErr := make(chan error, 1)
+
+	go func() {
+		var err error
+
+		if config.UseTLS() {
+			err = e.StartTLS(config.Address(), config.TLSCertFile, config.TLSKeyFile)
+		} else {
+			err = e.Start(config.Address())
+		}
+
+		startErr <- err
+	}()
+
+	select {
+	case err := <-startErr:
+		return err
+
+	case <-ctx.Done():
+		e.Logger.Info("shutting down the server")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := e.Shutdown(shutdownCtx); err != nil {
+			return err
+		}
+
+		if err := <-startErr; !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+
+		return nil
 	}
 }
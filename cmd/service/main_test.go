@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/service/db"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/test"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
+)
+
+func TestConfig(t *testing.T) {
+	testCases := []struct {
+		name             string
+		config           Config
+		expectedAddress  string
+		expectedBasePath string
+		expectError      bool
+	}{
+		{
+			"default config",
+			DefaultConfig(),
+			":1323",
+			"",
+			false,
+		},
+		{
+			"host, port and base path",
+			Config{Host: "127.0.0.1", Port: 8080, BasePath: "stdcov/v1/"},
+			"127.0.0.1:8080",
+			"/stdcov/v1",
+			false,
+		},
+		{
+			"TLS certificate without key",
+			Config{Port: 443, TLSCertFile: "cert.pem"},
+			":443",
+			"",
+			true,
+		},
+		{
+			"TLS certificate with key",
+			Config{Port: 443, TLSCertFile: "cert.pem", TLSKeyFile: "key.pem", BasePath: "/"},
+			":443",
+			"",
+			false,
+		},
+		{
+			"invalid webhook URL",
+			Config{Port: 80, WebhookURL: "localhost:8080"},
+			":80",
+			"",
+			true,
+		},
+		{
+			"idToken verification without audience",
+			Config{Port: 80, IDTokenSecret: "secret"},
+			":80",
+			"",
+			true,
+		},
+		{
+			"idToken verification with audience",
+			Config{Port: 80, IDTokenSecret: "secret", IDTokenAudience: DefaultOperator},
+			":80",
+			"",
+			false,
+		},
+		{
+			"webhook without idToken secret",
+			Config{Port: 80, WebhookURL: "http://localhost:8080"},
+			":80",
+			"",
+			true,
+		},
+		{
+			"webhook with idToken secret",
+			Config{Port: 80, WebhookURL: "http://localhost:8080", WebhookIDTokenSecret: "secret"},
+			":80",
+			"",
+			false,
+		},
+		{
+			"invalid automatic cancellation rate",
+			Config{Port: 80, Automation: AutomationRules{CancelRate: 1.5}},
+			":80",
+			"",
+			true,
+		},
+		{
+			"invalid fault rule",
+			Config{Port: 80, Faults: []FaultRule{{Endpoint: "GET /status", ErrorRate: 2}}},
+			":80",
+			"",
+			true,
+		},
+		{
+			"unknown violation",
+			Config{Port: 80, Violations: []Violation{"everything"}},
+			":80",
+			"",
+			true,
+		},
+		{
+			"invalid port",
+			Config{Port: 70000},
+			":70000",
+			"",
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.config.Address(); got != tc.expectedAddress {
+				t.Errorf("expected address %s, got %s", tc.expectedAddress, got)
+			}
+
+			if got := tc.config.NormalizedBasePath(); got != tc.expectedBasePath {
+				t.Errorf("expected base path %q, got %q", tc.expectedBasePath, got)
+			}
+
+			if err := tc.config.Validate(); (err != nil) != tc.expectError {
+				t.Errorf("expected error: %t, got %s", tc.expectError, err)
+			}
+		})
+	}
+}
+
+func TestServeWithBasePathAndShutdown(t *testing.T) {
+	config := Config{Host: "127.0.0.1", Port: 0, BasePath: "/stdcov/v1"}
+	e := newEcho(NewDefaultServer(), config)
+	e.HideBanner = true
+	e.HidePort = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+
+	go func() {
+		serveErr <- serve(ctx, e, config)
+	}()
+
+	// Wait for the server to listen
+	for i := 0; e.ListenerAddr() == nil; i++ {
+		if i > 100 {
+			t.Fatal("server did not start")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	server := fmt.Sprintf("http://%s%s", e.ListenerAddr(), config.BasePath)
+
+	err := test.RunTest(http.MethodGet, server+"/status", test.NewQuery(), nil,
+		false, "", test.NewFlags())
+	if err != nil {
+		t.Error(err)
+	}
+
+	response, err := http.Get(fmt.Sprintf("http://%s/status", e.ListenerAddr()))
+	util.PanicIf(err)
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusNotFound {
+		t.Errorf("paths without base path should not be served, got status %d", response.StatusCode)
+	}
+
+	cancel()
+
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			t.Errorf("expected graceful shutdown, got %s", err)
+		}
+
+	case <-time.After(shutdownTimeout):
+		t.Error("server did not shut down")
+	}
+}
+
+func TestNewHandlerWithStore(t *testing.T) {
+	config := Config{StoreFile: filepath.Join(t.TempDir(), "store.json")}
+
+	handler, err := newHandler(config)
+	util.PanicIf(err)
+
+	booking := makeBooking(repUUID(300))
+	util.PanicIf(handler.db.AddBooking(*booking))
+	util.PanicIf(UpdateBookingStatus(handler.db, booking.Id,
+		db.StatusChange{Status: api.BookingStatusCONFIRMED}))
+
+	restarted, err := newHandler(config)
+	util.PanicIf(err)
+
+	persisted, err := restarted.db.GetBooking(booking.Id)
+	if err != nil {
+		t.Fatalf("booking should be persisted across restarts: %s", err)
+	}
+
+	if persisted.Status != api.BookingStatusCONFIRMED {
+		t.Errorf("expected persisted status %s, got %s", api.BookingStatusCONFIRMED, persisted.Status)
+	}
+}
+
+func TestNewHandlerWithIDTokenVerification(t *testing.T) {
+	dir := t.TempDir()
+
+	jwksFile := filepath.Join(dir, "jwks.json")
+	util.PanicIf(os.WriteFile(jwksFile, []byte(`{"keys": []}`), 0o600))
+
+	invalidJWKSFile := filepath.Join(dir, "invalid.json")
+	util.PanicIf(os.WriteFile(invalidJWKSFile, []byte(`{"keys": [{"kty": "oct"}]}`), 0o600))
+
+	testCases := []struct {
+		name           string
+		config         Config
+		expectError    bool
+		expectVerified bool
+	}{
+		{"no verification", Config{}, false, false},
+		{"shared secret", Config{IDTokenSecret: "secret"}, false, true},
+		{"JWKS file", Config{IDTokenJWKS: jwksFile}, false, true},
+		{"missing JWKS file", Config{IDTokenJWKS: filepath.Join(dir, "missing.json")}, true, false},
+		{"invalid JWKS", Config{IDTokenJWKS: invalidJWKSFile}, true, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler, err := newHandler(tc.config)
+			if (err != nil) != tc.expectError {
+				t.Fatalf("expected error: %t, got %v", tc.expectError, err)
+			}
+
+			if err == nil && (handler.idTokenVerifier != nil) != tc.expectVerified {
+				t.Errorf("expected idToken verification: %t", tc.expectVerified)
+			}
+		})
+	}
+}
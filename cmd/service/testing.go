@@ -47,10 +47,16 @@ func makeNTrips(n int) []api.Trip {
 	return trips
 }
 
+// tripSpeed is the average speed, in km/h, of trips made at given coordinates
+const tripSpeed = 50
+
 func makeTripAtCoords(coordPickup, coordDrop util.Coord) api.Trip {
 	t := api.NewTrip()
 	updateTripCoords(&t, coordPickup, coordDrop)
 
+	// The duration needs to be plausible for the distance between coordinates
+	t.Duration += int(util.Distance(coordPickup, coordDrop) * 3600 / tripSpeed)
+
 	return t
 }
 
@@ -139,8 +145,21 @@ func makeBooking(bookingID uuid.UUID) *api.Booking {
 	return makeBookingWithStatus(bookingID, api.BookingStatusWAITINGCONFIRMATION)
 }
 
+// makeBookingWithStatus returns a booking by API, which is PAYING, between
+// users of the default operator
 func makeBookingWithStatus(bookingID uuid.UUID, status api.BookingStatus) *api.Booking {
-	return &api.Booking{Id: bookingID, Status: status}
+	var (
+		paying = api.PAYING
+		amount = float32(5)
+	)
+
+	return &api.Booking{
+		Id:        bookingID,
+		Status:    status,
+		Driver:    makeUser("driver", "driver"),
+		Passenger: makeUser("passenger", "passenger"),
+		Price:     api.Price{Type: &paying, Amount: &amount},
+	}
 }
 
 func makeCarpoolBookingEvent(eventID, bookingID uuid.UUID) *api.CarpoolBookingEvent {
@@ -173,8 +192,10 @@ func makeMessage(from api.User, to api.User) api.PostMessagesJSONBody {
 	}
 }
 
+// defaultOperator is the operator of users made with makeUser
+const defaultOperator = "default.operator.com"
+
 func makeUser(id, alias string) api.User {
-	defaultOperator := "default.operator.com"
 	return makeUserWithOperator(id, alias, defaultOperator)
 }
 
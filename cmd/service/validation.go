@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
+	"github.com/fabmob/playground-standard-covoiturage/spec"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/labstack/echo/v4"
+)
+
+// requestValidator returns a middleware validating requests against the
+// openapi specification. Invalid requests are rejected with code 400 and a
+// body explaining the failing field. Requests on routes unknown to the
+// specification are left untouched.
+func requestValidator(basePath string) echo.MiddlewareFunc {
+	router := specRouter(basePath)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+
+			route, pathParams, err := router.FindRoute(req)
+			if err != nil {
+				return next(ctx)
+			}
+
+			validationInput := &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: pathParams,
+				Route:      route,
+			}
+
+			err = openapi3filter.ValidateRequest(req.Context(), validationInput)
+			if err != nil {
+				return ctx.JSON(http.StatusBadRequest, errorBody(validationErr(err)))
+			}
+
+			return next(ctx)
+		}
+	}
+}
+
+// badRequestErrorHandler returns an echo error handler that formats "bad
+// request" errors raised by echo (e.g. failing parameter binding) as
+// specified by the standard. Other errors are handled by the default handler.
+func badRequestErrorHandler(e *echo.Echo) echo.HTTPErrorHandler {
+	return func(err error, ctx echo.Context) {
+		var httpErr *echo.HTTPError
+		if !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest ||
+			ctx.Response().Committed {
+			e.DefaultHTTPErrorHandler(err, ctx)
+			return
+		}
+
+		body := errorBody(fmt.Errorf("%v", httpErr.Message))
+		if jsonErr := ctx.JSON(http.StatusBadRequest, body); jsonErr != nil {
+			e.Logger.Error(jsonErr)
+		}
+	}
+}
+
+// specRouter returns a router on the routes of the openapi specification,
+// served under basePath
+func specRouter(basePath string) routers.Router {
+	doc, err := openapi3.NewLoader().LoadFromData(spec.OpenAPISpec)
+	util.PanicIf(err) // Error only if problem with module internals
+
+	doc.Servers = nil
+	if basePath != "" {
+		doc.Servers = openapi3.Servers{&openapi3.Server{URL: basePath}}
+	}
+
+	util.PanicIf(doc.Validate(context.Background()))
+
+	router, err := gorillamux.NewRouter(doc)
+	util.PanicIf(err)
+
+	return router
+}
+
+// validationErr rewords request validation errors, so that the failing
+// field is explicit
+func validationErr(err error) error {
+	var requestErr *openapi3filter.RequestError
+	if !errors.As(err, &requestErr) {
+		return errors.New(firstLine(err.Error()))
+	}
+
+	var location string
+
+	switch {
+	case requestErr.Parameter != nil:
+		location = fmt.Sprintf("%s parameter %q", requestErr.Parameter.In,
+			requestErr.Parameter.Name)
+
+	case requestErr.RequestBody != nil:
+		location = "request body"
+
+	default:
+		return errors.New(firstLine(requestErr.Error()))
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if errors.As(requestErr.Err, &schemaErr) {
+		if pointer := schemaErr.JSONPointer(); len(pointer) > 0 {
+			location += fmt.Sprintf(", field %q", strings.Join(pointer, "."))
+		}
+
+		return fmt.Errorf("invalid %s: %s", location, schemaErr.Reason)
+	}
+
+	reason := requestErr.Reason
+	if requestErr.Err != nil {
+		reason = requestErr.Err.Error()
+	}
+
+	return fmt.Errorf("invalid %s: %s", location, firstLine(reason))
+}
+
+func firstLine(s string) string {
+	return strings.SplitN(s, "\n", 2)[0]
+}
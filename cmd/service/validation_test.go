@@ -0,0 +1,72 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/service/db"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
+	"github.com/labstack/echo/v4"
+)
+
+func TestRequestValidator(t *testing.T) {
+	validQuery := "departureLat=47.46&departureLng=1.06&arrivalLat=48.84&arrivalLng=2.39&departureDate=1665579951"
+
+	mockDB := db.NewMockDB()
+	mockDB.Bookings = NewBookingsByID(makeBooking(repUUID(200)))
+
+	validBooking, err := json.Marshal(makeBooking(repUUID(201)))
+	util.PanicIf(err)
+
+	testCases := []struct {
+		name          string
+		basePath      string
+		method        string
+		path          string
+		body          string
+		expectedCode  int
+		expectedField string
+	}{
+		{"valid search", "", http.MethodGet, "/driver_journeys?" + validQuery, "", http.StatusOK, ""},
+		{"missing parameter", "", http.MethodGet, "/driver_journeys?departureLat=47.46", "", http.StatusBadRequest, `"departureLng"`},
+		{"invalid parameter", "", http.MethodGet, "/passenger_journeys?" + strings.Replace(validQuery, "departureLat=47.46", "departureLat=north", 1), "", http.StatusBadRequest, `"departureLat"`},
+		{"invalid path parameter", "", http.MethodGet, "/bookings/not-a-uuid", "", http.StatusBadRequest, "bookingId"},
+		{"invalid body field", "", http.MethodPost, "/bookings", `{"id": "not-a-uuid"}`, http.StatusBadRequest, "request body"},
+		{"valid body", "", http.MethodPost, "/bookings", string(validBooking), http.StatusCreated, ""},
+		{"with base path", "/v1", http.MethodGet, "/v1/driver_journeys?departureLat=47.46", "", http.StatusBadRequest, `"departureLng"`},
+		{"unknown route", "", http.MethodGet, "/unknown", "", http.StatusNotFound, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newEcho(NewServerWithDB(mockDB), Config{BasePath: tc.basePath})
+
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.body != "" {
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			}
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedCode {
+				t.Fatalf("expected code %d, got %d (%s)", tc.expectedCode, rec.Code, rec.Body)
+			}
+
+			if tc.expectedCode != http.StatusBadRequest {
+				return
+			}
+
+			var body api.BadRequest
+			util.PanicIf(json.Unmarshal(rec.Body.Bytes(), &body))
+
+			if body.Error == nil || !strings.Contains(*body.Error, tc.expectedField) {
+				t.Errorf("expected error body mentioning %s, got %s", tc.expectedField, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/service/db"
+	"github.com/labstack/echo/v4"
+)
+
+// Violation is a rule of the specification that the server deliberately
+// breaks, to check that the test suite detects it
+type Violation string
+
+const (
+	// ViolationDepartureRadius ignores the departureRadius of searches
+	ViolationDepartureRadius Violation = "departureRadius"
+	// ViolationArrivalRadius ignores the arrivalRadius of searches
+	ViolationArrivalRadius Violation = "arrivalRadius"
+	// ViolationTimeDelta ignores the timeDelta of searches
+	ViolationTimeDelta Violation = "timeDelta"
+	// ViolationCount ignores the count of searches
+	ViolationCount Violation = "count"
+	// ViolationDuplicateIDs duplicates the first result of searches
+	ViolationDuplicateIDs Violation = "duplicateIds"
+	// ViolationOperatorFormat sends search results with an operator which is
+	// not a domain name
+	ViolationOperatorFormat Violation = "operatorFormat"
+	// ViolationMissingFields removes the required "duration" of search
+	// results
+	ViolationMissingFields Violation = "missingFields"
+	// ViolationContentType sends search results as "text/plain"
+	ViolationContentType Violation = "contentType"
+	// ViolationStatusCode answers POST /bookings with code 200 instead of 201
+	ViolationStatusCode Violation = "statusCode"
+	// ViolationAuthentication accepts requests without a valid API key
+	ViolationAuthentication Violation = "authentication"
+	// ViolationIDToken accepts booking events without verifying their
+	// idToken
+	ViolationIDToken Violation = "idToken"
+	// ViolationTransitions accepts any change of booking status with PATCH
+	// /bookings
+	ViolationTransitions Violation = "transitions"
+)
+
+// violationDescriptions describes the known violations
+var violationDescriptions = map[Violation]string{
+	ViolationDepartureRadius: "ignore the departureRadius of searches",
+	ViolationArrivalRadius:   "ignore the arrivalRadius of searches",
+	ViolationTimeDelta:       "ignore the timeDelta of searches",
+	ViolationCount:           "ignore the count of searches",
+	ViolationDuplicateIDs:    "duplicate the first result of searches",
+	ViolationOperatorFormat:  "send search results with an invalid operator",
+	ViolationMissingFields:   "remove the required \"duration\" of search results",
+	ViolationContentType:     "send search results as \"text/plain\"",
+	ViolationStatusCode:      "answer POST /bookings with code 200 instead of 201",
+	ViolationAuthentication:  "accept requests without a valid API key",
+	ViolationIDToken:         "accept booking events without verifying their idToken",
+	ViolationTransitions:     "accept any change of booking status with PATCH /bookings",
+}
+
+// Violations returns the known violations, sorted by name
+func Violations() []Violation {
+	violations := make([]Violation, 0, len(violationDescriptions))
+	for violation := range violationDescriptions {
+		violations = append(violations, violation)
+	}
+
+	sort.Slice(violations, func(i, j int) bool { return violations[i] < violations[j] })
+
+	return violations
+}
+
+// Validate checks that the violation is known
+func (v Violation) Validate() error {
+	if _, ok := violationDescriptions[v]; !ok {
+		return fmt.Errorf("unknown violation %q, expected one of %v", v, Violations())
+	}
+
+	return nil
+}
+
+// Describe describes the behavior of the server breaking the rule
+func (v Violation) Describe() string {
+	return violationDescriptions[v]
+}
+
+// invalidOperator is the operator of search results with the
+// "operatorFormat" violation
+const invalidOperator = "not an operator"
+
+// violatingServer wraps a server to break some rules of the specification.
+// Handlers which are not affected by violations are those of the wrapped
+// server.
+type violatingServer struct {
+	*StdCovServerImpl
+	violations map[Violation]bool
+}
+
+func newViolatingServer(handler *StdCovServerImpl, violations []Violation) *violatingServer {
+	s := &violatingServer{handler, map[Violation]bool{}}
+	for _, violation := range violations {
+		s.violations[violation] = true
+	}
+
+	return s
+}
+
+func violates(violations []Violation, violation Violation) bool {
+	for _, v := range violations {
+		if v == violation {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetDriverJourneys breaks search rules on GET /driver_journeys
+func (s *violatingServer) GetDriverJourneys(ctx echo.Context, params api.GetDriverJourneysParams) error {
+	s.ignoreSearchParams(&params.DepartureRadius, &params.ArrivalRadius, &params.TimeDelta, &params.Count)
+
+	return s.alterSearchResults(ctx, func() error {
+		return s.StdCovServerImpl.GetDriverJourneys(ctx, params)
+	})
+}
+
+// GetPassengerJourneys breaks search rules on GET /passenger_journeys
+func (s *violatingServer) GetPassengerJourneys(ctx echo.Context, params api.GetPassengerJourneysParams) error {
+	s.ignoreSearchParams(&params.DepartureRadius, &params.ArrivalRadius, &params.TimeDelta, &params.Count)
+
+	return s.alterSearchResults(ctx, func() error {
+		return s.StdCovServerImpl.GetPassengerJourneys(ctx, params)
+	})
+}
+
+// GetDriverRegularTrips breaks search rules on GET /driver_regular_trips
+func (s *violatingServer) GetDriverRegularTrips(ctx echo.Context, params api.GetDriverRegularTripsParams) error {
+	s.ignoreSearchParams(&params.DepartureRadius, &params.ArrivalRadius, &params.TimeDelta, &params.Count)
+
+	return s.alterSearchResults(ctx, func() error {
+		return s.StdCovServerImpl.GetDriverRegularTrips(ctx, params)
+	})
+}
+
+// GetPassengerRegularTrips breaks search rules on GET
+// /passenger_regular_trips
+func (s *violatingServer) GetPassengerRegularTrips(ctx echo.Context, params api.GetPassengerRegularTripsParams) error {
+	s.ignoreSearchParams(&params.DepartureRadius, &params.ArrivalRadius, &params.TimeDelta, &params.Count)
+
+	return s.alterSearchResults(ctx, func() error {
+		return s.StdCovServerImpl.GetPassengerRegularTrips(ctx, params)
+	})
+}
+
+// PostBookings answers with a wrong status code with the "statusCode"
+// violation
+func (s *violatingServer) PostBookings(ctx echo.Context) error {
+	if !s.violations[ViolationStatusCode] {
+		return s.StdCovServerImpl.PostBookings(ctx)
+	}
+
+	return rewriteResponse(ctx, func() error {
+		return s.StdCovServerImpl.PostBookings(ctx)
+	}, func(status int, body []byte) (int, []byte) {
+		if status == http.StatusCreated {
+			status = http.StatusOK
+		}
+
+		return status, body
+	})
+}
+
+// PostBookingEvents skips the verification of idTokens with the "idToken"
+// violation
+func (s *violatingServer) PostBookingEvents(ctx echo.Context) error {
+	if !s.violations[ViolationIDToken] {
+		return s.StdCovServerImpl.PostBookingEvents(ctx)
+	}
+
+	withoutVerifier := *s.StdCovServerImpl
+	withoutVerifier.idTokenVerifier = nil
+
+	return withoutVerifier.PostBookingEvents(ctx)
+}
+
+// PatchBookings accepts any status change with the "transitions" violation
+func (s *violatingServer) PatchBookings(ctx echo.Context, bookingID api.BookingId,
+	params api.PatchBookingsParams) error {
+
+	if !s.violations[ViolationTransitions] {
+		return s.StdCovServerImpl.PatchBookings(ctx, bookingID, params)
+	}
+
+	booking, err := s.db.GetBooking(bookingID)
+	if err != nil || !params.Status.IsValid() || booking.Status == params.Status ||
+		booking.Status.CanTransitionTo(params.Status) ||
+		checkBookingOperator(ctx, booking) != nil {
+		return s.StdCovServerImpl.PatchBookings(ctx, bookingID, params)
+	}
+
+	err = s.db.CompareAndSetBookingStatus(bookingID, booking.Status, db.StatusChange{
+		Status:  params.Status,
+		Message: params.Message,
+		Source:  db.StatusChangeSourcePatch,
+	})
+	if err != nil {
+		return ctx.JSON(http.StatusConflict, errorBody(err))
+	}
+
+	s.webhook.NotifyStatusChange(s.db, bookingID)
+
+	return ctx.NoContent(http.StatusOK)
+}
+
+// ignoreSearchParams overrides the search parameters ignored by violations
+func (s *violatingServer) ignoreSearchParams(departureRadius, arrivalRadius **float32, timeDelta, count **int) {
+	var (
+		anyRadius    = float32(math.MaxFloat32)
+		anyTimeDelta = math.MaxInt32
+	)
+
+	if s.violations[ViolationDepartureRadius] {
+		*departureRadius = &anyRadius
+	}
+
+	if s.violations[ViolationArrivalRadius] {
+		*arrivalRadius = &anyRadius
+	}
+
+	if s.violations[ViolationTimeDelta] {
+		*timeDelta = &anyTimeDelta
+	}
+
+	if s.violations[ViolationCount] {
+		*count = nil
+	}
+}
+
+// alterSearchResults sends the results of a search altered by the
+// violations. Error responses are left untouched.
+func (s *violatingServer) alterSearchResults(ctx echo.Context, search func() error) error {
+	if !s.violations[ViolationOperatorFormat] && !s.violations[ViolationMissingFields] &&
+		!s.violations[ViolationDuplicateIDs] && !s.violations[ViolationContentType] {
+		return search()
+	}
+
+	return rewriteResponse(ctx, search, func(status int, body []byte) (int, []byte) {
+		var results []map[string]interface{}
+
+		if status != http.StatusOK || json.Unmarshal(body, &results) != nil {
+			return status, body
+		}
+
+		for _, result := range results {
+			if s.violations[ViolationOperatorFormat] {
+				result["operator"] = invalidOperator
+			}
+
+			if s.violations[ViolationMissingFields] {
+				delete(result, "duration")
+			}
+		}
+
+		if s.violations[ViolationDuplicateIDs] && len(results) > 0 {
+			results = append(results, results[0])
+		}
+
+		if s.violations[ViolationContentType] {
+			ctx.Response().Header().Set(echo.HeaderContentType, echo.MIMETextPlainCharsetUTF8)
+		}
+
+		altered, err := json.Marshal(results)
+		if err != nil {
+			return status, body
+		}
+
+		return status, altered
+	})
+}
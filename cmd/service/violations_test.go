@@ -0,0 +1,214 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/service/db"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/test"
+	testassert "github.com/fabmob/playground-standard-covoiturage/cmd/test/assert"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
+)
+
+// TestViolations checks that each violation is caught by the assertion
+// targeting it, and only when the server breaks the rule
+func TestViolations(t *testing.T) {
+	var (
+		departure = util.Coord{Lat: 46, Lon: 1}
+		arrival   = util.Coord{Lat: 46.5, Lon: 1}
+		elsewhere = util.Coord{Lat: 46.2, Lon: 1}
+		date      = 1700000000
+	)
+
+	one := 1
+
+	searchFlags := test.NewFlags()
+	searchFlags.ExpectNonEmpty = true
+
+	authFlags := test.NewFlags()
+	authFlags.ExpectAuthRequired = true
+
+	postBookingsFlags := test.NewFlags()
+	postBookingsFlags.ExpectedResponseCode = http.StatusCreated
+
+	patchBookingsFlags := test.NewFlags()
+	patchBookingsFlags.ExpectTransitionsEnforced = true
+
+	idTokenFlags := test.NewFlags()
+	idTokenFlags.ExpectIDTokenVerified = true
+	idTokenFlags.IDTokenSecret = idTokenSecret
+	idTokenFlags.IDTokenAudience = operatorA
+
+	search := func(count *int) func(string) *http.Request {
+		return func(server string) *http.Request {
+			params := api.NewGetDriverJourneysParams(departure, arrival, date)
+			params.Count = count
+
+			request, err := api.NewGetDriverJourneysRequest(server, params)
+			util.PanicIf(err)
+
+			return request
+		}
+	}
+
+	postBooking := func(server string) *http.Request {
+		request, err := api.NewPostBookingsRequest(server, *makeBooking(repUUID(761)))
+		util.PanicIf(err)
+
+		return request
+	}
+
+	patchBooking := func(server string) *http.Request {
+		params := &api.PatchBookingsParams{Status: api.BookingStatusCANCELLED}
+		request, err := api.NewPatchBookingsRequest(server, repUUID(760), params)
+		util.PanicIf(err)
+
+		return request
+	}
+
+	postBookingEvent := func(server string) *http.Request {
+		event := makeCarpoolBookingEvent(repUUID(762), repUUID(763))
+		event.Data = withDriverOperator(event.Data, operatorA)
+		event.IdToken = signJWT("HS256", "", []byte(idTokenSecret),
+			makeClaims(operatorA, time.Now().Add(time.Hour)))
+
+		request, err := api.NewPostBookingEventsRequest(server, *event)
+		util.PanicIf(err)
+
+		return request
+	}
+
+	testCases := []struct {
+		violation           Violation
+		request             func(server string) *http.Request
+		testFun             test.ResponseTestFun
+		flags               test.Flags
+		expectedFailedCheck string
+	}{
+		{ViolationDepartureRadius, search(nil), test.TestGetDriverJourneysResponse, searchFlags,
+			"assert query parameter \"departureRadius\""},
+		{ViolationArrivalRadius, search(nil), test.TestGetDriverJourneysResponse, searchFlags,
+			"assert query parameter \"arrivalRadius\""},
+		{ViolationTimeDelta, search(nil), test.TestGetDriverJourneysResponse, searchFlags,
+			"assert query parameter \"timeDelta\""},
+		{ViolationCount, search(&one), test.TestGetDriverJourneysResponse, searchFlags,
+			"assert query parameter \"count\""},
+		{ViolationDuplicateIDs, search(nil), test.TestGetDriverJourneysResponse, searchFlags,
+			"assert unique ids"},
+		{ViolationOperatorFormat, search(nil), test.TestGetDriverJourneysResponse, searchFlags,
+			"assert response property \"operator\""},
+		{ViolationMissingFields, search(nil), test.TestGetDriverJourneysResponse, searchFlags,
+			"assert format"},
+		{ViolationContentType, search(nil), test.TestGetDriverJourneysResponse, searchFlags,
+			"assert format"},
+		{ViolationStatusCode, postBooking, test.TestPostBookingsResponse, postBookingsFlags,
+			"assert format"},
+		{ViolationAuthentication, search(nil), test.TestGetDriverJourneysResponse, authFlags,
+			"assert unauthenticated request is rejected"},
+		{ViolationIDToken, postBookingEvent, test.TestPostBookingEventsResponse, idTokenFlags,
+			"assert invalid idToken is rejected"},
+		{ViolationTransitions, patchBooking, test.TestPatchBookingsResponse, patchBookingsFlags,
+			"assert illegal status transitions are rejected"},
+	}
+
+	for _, tc := range testCases {
+		for _, violate := range []bool{false, true} {
+			name := string(tc.violation)
+			if !violate {
+				name += " not violated"
+			}
+
+			t.Run(name, func(t *testing.T) {
+				mockDB := db.NewMockDB()
+				mockDB.DriverJourneys = []api.DriverJourney{
+					makeDriverJourney("far from departure", elsewhere, arrival, date),
+					makeDriverJourney("far from arrival", departure, elsewhere, date),
+					makeDriverJourney("too late", departure, arrival, date+3600),
+					makeDriverJourney("matching", departure, arrival, date),
+					makeDriverJourney("also matching", departure, arrival, date+60),
+				}
+				mockDB.Bookings = NewBookingsByID(
+					makeBookingWithStatus(repUUID(760), api.BookingStatusCONFIRMED),
+				)
+
+				handler := NewServerWithDB(mockDB)
+				handler.idTokenVerifier, _ = NewIDTokenVerifier(operatorA, idTokenSecret, nil)
+
+				config := Config{APIKeys: APIKeys{keyAnyOperator: ""}}
+				if violate {
+					config.Violations = []Violation{tc.violation}
+				}
+
+				server := httptest.NewServer(newEcho(handler, config))
+				defer server.Close()
+
+				request, err := test.AddEndpointContext(tc.request(server.URL))
+				util.PanicIf(err)
+				request.Header.Set(api.HeaderXAPIKey, keyAnyOperator)
+
+				response, err := http.DefaultClient.Do(request)
+				util.PanicIf(err)
+				defer response.Body.Close()
+
+				// the request body is read again by assertions
+				if request.GetBody != nil {
+					request.Body, err = request.GetBody()
+					util.PanicIf(err)
+				}
+
+				results := tc.testFun(request, response, tc.flags)
+
+				for _, result := range results {
+					failed := result.Err != nil
+					targeted := result.AssertionDescription == tc.expectedFailedCheck
+
+					if failed && (!violate || !targeted) {
+						t.Errorf("unexpected failure of %q: %s", result.AssertionDescription, result.Err)
+					}
+
+					if targeted && violate && !failed {
+						t.Errorf("expected %q to fail", result.AssertionDescription)
+					}
+				}
+
+				if violate && !containsDescription(results, tc.expectedFailedCheck) {
+					t.Errorf("expected %q to be checked", tc.expectedFailedCheck)
+				}
+			})
+		}
+	}
+}
+
+func makeDriverJourney(id string, departure, arrival util.Coord, date int) api.DriverJourney {
+	dj := api.NewDriverJourney()
+	dj.Trip = makeTripAtCoords(departure, arrival)
+	dj.JourneySchedule = makeJourneyScheduleAtDate(int64(date))
+	dj.Id = &id
+
+	return dj
+}
+
+func containsDescription(results []testassert.Result, description string) bool {
+	for _, result := range results {
+		if result.AssertionDescription == description {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestViolationValidate(t *testing.T) {
+	for _, violation := range Violations() {
+		if err := violation.Validate(); err != nil {
+			t.Errorf("expected known violation %q to be valid, got %s", violation, err)
+		}
+	}
+
+	if err := Violation("everything").Validate(); err == nil {
+		t.Error("expected an error on unknown violation")
+	}
+}
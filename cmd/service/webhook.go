@@ -0,0 +1,275 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/service/db"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// webhookMaxAttempts is the maximum number of attempts to deliver an event
+	webhookMaxAttempts = 5
+	// webhookRetryDelay is the delay before the first retry. It doubles at
+	// each retry.
+	webhookRetryDelay = time.Second
+	// webhookQueueSize is the maximum number of events waiting for delivery
+	webhookQueueSize = 1000
+)
+
+// Webhook notifies a MaaS platform of booking status changes, by sending
+// `CarpoolBookingEvent`s to its POST /booking_events endpoint. Events are
+// delivered in order, with retries, and each delivery is logged.
+type Webhook struct {
+	client        api.ClientInterface
+	idTokenSecret []byte
+	maxAttempts   int
+	retryDelay    time.Duration
+	logger        echo.Logger
+
+	queue   chan api.CarpoolBookingEvent
+	pending sync.WaitGroup
+
+	// mu guards closed and deliveries
+	mu         sync.Mutex
+	closed     bool
+	deliveries []Delivery
+}
+
+// Delivery is the log of the delivery of an event
+type Delivery struct {
+	EventID   uuid.UUID         `json:"eventId"`
+	BookingID api.BookingId     `json:"bookingId"`
+	Status    api.BookingStatus `json:"status"`
+	Delivered bool              `json:"delivered"`
+	Attempts  []DeliveryAttempt `json:"attempts"`
+}
+
+// DeliveryAttempt is the log of a single attempt to deliver an event
+type DeliveryAttempt struct {
+	Time time.Time `json:"time"`
+	// StatusCode is 0 if no response has been received
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// NewWebhook returns a webhook sending events to the MaaS platform served
+// at `server`. If `apiKey` is not empty, it is sent in the "X-API-Key" header.
+// The idToken of events is signed with `idTokenSecret`, for the operator of
+// the driver.
+func NewWebhook(server, apiKey, idTokenSecret string) (*Webhook, error) {
+	return newWebhook(server, apiKey, idTokenSecret, webhookMaxAttempts, webhookRetryDelay)
+}
+
+func newWebhook(server, apiKey, idTokenSecret string, maxAttempts int, retryDelay time.Duration) (*Webhook, error) {
+	client, err := api.NewClient(server, api.WithRequestEditorFn(
+		func(ctx context.Context, req *http.Request) error {
+			if apiKey != "" {
+				req.Header.Set(api.HeaderXAPIKey, apiKey)
+			}
+
+			return nil
+		},
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Webhook{
+		client:        client,
+		idTokenSecret: []byte(idTokenSecret),
+		maxAttempts:   maxAttempts,
+		retryDelay:    retryDelay,
+		queue:         make(chan api.CarpoolBookingEvent, webhookQueueSize),
+		deliveries:    []Delivery{},
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+// NotifyStatusChange sends an event with the current state of a booking. It
+// does not wait for the delivery. A nil webhook does nothing.
+func (w *Webhook) NotifyStatusChange(d db.DB, bookingID api.BookingId) {
+	if w == nil {
+		return
+	}
+
+	booking, err := d.GetBooking(bookingID)
+	if err != nil {
+		return
+	}
+
+	event, err := newBookingEvent(booking, w.idTokenSecret)
+	if err != nil {
+		w.log(Delivery{EventID: event.Id, BookingID: bookingID, Status: booking.Status,
+			Attempts: []DeliveryAttempt{{Time: time.Now(), Error: err.Error()}}})
+
+		return
+	}
+
+	if err := w.enqueue(event); err != nil {
+		w.log(Delivery{EventID: event.Id, BookingID: bookingID, Status: booking.Status,
+			Attempts: []DeliveryAttempt{{Time: time.Now(), Error: err.Error()}}})
+	}
+}
+
+// enqueue queues an event for delivery, unless the webhook is closed or the
+// queue is full
+func (w *Webhook) enqueue(event api.CarpoolBookingEvent) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return errors.New("webhook is closed")
+	}
+
+	w.pending.Add(1)
+
+	select {
+	case w.queue <- event:
+		return nil
+
+	default:
+		w.pending.Done()
+		return errors.New("delivery queue is full")
+	}
+}
+
+// Deliveries returns the log of all deliveries, in order
+func (w *Webhook) Deliveries() []Delivery {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	deliveries := make([]Delivery, len(w.deliveries))
+	copy(deliveries, w.deliveries)
+
+	return deliveries
+}
+
+// Close stops accepting events, and waits for pending events to be delivered
+// (or to fail). It returns an error if `ctx` is done first.
+func (w *Webhook) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		w.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+
+	case <-ctx.Done():
+		return fmt.Errorf("pending booking events not delivered: %w", ctx.Err())
+	}
+}
+
+// run delivers queued events one by one
+func (w *Webhook) run() {
+	for event := range w.queue {
+		w.log(w.deliver(event))
+		w.pending.Done()
+	}
+}
+
+// deliver sends an event, and retries on failure with exponential backoff.
+// Events rejected with a client error (except 429) are not retried.
+func (w *Webhook) deliver(event api.CarpoolBookingEvent) Delivery {
+	delivery := Delivery{EventID: event.Id, Attempts: []DeliveryAttempt{}}
+
+	if driverCarpoolBooking, err := event.Data.AsDriverCarpoolBooking(); err == nil {
+		delivery.BookingID = driverCarpoolBooking.Id
+		delivery.Status = api.BookingStatus(driverCarpoolBooking.Status)
+	}
+
+	delay := w.retryDelay
+
+	for attempt := 1; attempt <= w.maxAttempts; attempt++ {
+		result := DeliveryAttempt{Time: time.Now()}
+
+		response, err := w.client.PostBookingEvents(context.Background(), event)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			response.Body.Close()
+			result.StatusCode = response.StatusCode
+		}
+
+		delivery.Attempts = append(delivery.Attempts, result)
+
+		if err == nil && response.StatusCode == http.StatusOK {
+			delivery.Delivered = true
+			break
+		}
+
+		if err == nil && !isRetryable(response.StatusCode) {
+			break
+		}
+
+		if attempt < w.maxAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+
+	return delivery
+}
+
+func isRetryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+func (w *Webhook) log(delivery Delivery) {
+	w.mu.Lock()
+	w.deliveries = append(w.deliveries, delivery)
+	w.mu.Unlock()
+
+	if w.logger == nil {
+		return
+	}
+
+	msg := fmt.Sprintf("booking event %s (booking %s, status %s): %d attempt(s), delivered: %t",
+		delivery.EventID, delivery.BookingID, delivery.Status, len(delivery.Attempts),
+		delivery.Delivered)
+
+	if delivery.Delivered {
+		w.logger.Info(msg)
+	} else {
+		w.logger.Warn(msg)
+	}
+}
+
+// newBookingEvent returns an event with the current state of a booking, seen
+// from the driver's operator. Its idToken identifies the passenger, for the
+// driver's operator.
+func newBookingEvent(booking *api.Booking, idTokenSecret []byte) (api.CarpoolBookingEvent, error) {
+	event := api.CarpoolBookingEvent{Id: uuid.New()}
+
+	idToken, err := signIDToken(idTokenSecret, booking.Passenger.Id, booking.Driver.Operator, time.Now())
+	if err != nil {
+		return event, err
+	}
+
+	event.IdToken = idToken
+
+	err = event.Data.FromDriverCarpoolBooking(*booking.ToDriverCarpoolBooking())
+
+	return event, err
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/service/db"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
+)
+
+// setupMaaSServer serves a MaaS platform receiving booking events in maasDB,
+// and verifying their idToken. The first `failures` requests fail with code
+// `failureCode`.
+func setupMaaSServer(maasDB *db.Mock, failures int32, failureCode int) (*httptest.Server, *int32) {
+	var requests int32
+
+	handler := NewServerWithDB(maasDB)
+	handler.idTokenVerifier, _ = NewIDTokenVerifier(defaultOperator, idTokenSecret, nil)
+
+	e := newEcho(handler, Config{})
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) <= failures {
+				w.WriteHeader(failureCode)
+				return
+			}
+
+			e.ServeHTTP(w, r)
+		},
+	))
+
+	return server, &requests
+}
+
+// setupOperatorServer serves an operator with a booking, notifying the MaaS
+// server of status changes
+func setupOperatorServer(t *testing.T, maasServer string, bookingID api.BookingId) (*httptest.Server, *Webhook) {
+	t.Helper()
+
+	operatorDB := db.NewMockDB()
+	operatorDB.Bookings = NewBookingsByID(makeBooking(bookingID))
+
+	webhook, err := newWebhook(maasServer, "", idTokenSecret, 3, time.Millisecond)
+	util.PanicIf(err)
+
+	handler := NewServerWithDB(operatorDB)
+	handler.webhook = webhook
+
+	return httptest.NewServer(newEcho(handler, Config{AdminKey: adminKey})), webhook
+}
+
+func TestWebhook(t *testing.T) {
+	testCases := []struct {
+		name              string
+		failures          int32
+		failureCode       int
+		expectedAttempts  int
+		expectedDelivered bool
+	}{
+		{"delivered at first attempt", 0, 0, 1, true},
+		{"delivered after retries", 2, http.StatusServiceUnavailable, 3, true},
+		{"too many requests is retried", 1, http.StatusTooManyRequests, 2, true},
+		{"not delivered after max attempts", 3, http.StatusInternalServerError, 3, false},
+		{"client error is not retried", 1, http.StatusBadRequest, 1, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bookingID := repUUID(700)
+
+			maasDB := db.NewMockDB()
+			maasServer, requests := setupMaaSServer(maasDB, tc.failures, tc.failureCode)
+			defer maasServer.Close()
+
+			operatorServer, webhook := setupOperatorServer(t, maasServer.URL, bookingID)
+			defer operatorServer.Close()
+
+			code, body := adminRequest(t, operatorServer, http.MethodPatch,
+				"/bookings/"+bookingID.String()+"?status=CONFIRMED", "", nil)
+			if code != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d (%s)", http.StatusOK, code, body)
+			}
+
+			util.PanicIf(webhook.Close(context.Background()))
+
+			deliveries := webhook.Deliveries()
+			if len(deliveries) != 1 {
+				t.Fatalf("expected a single delivery, got %d", len(deliveries))
+			}
+
+			delivery := deliveries[0]
+
+			if len(delivery.Attempts) != tc.expectedAttempts || int(*requests) != tc.expectedAttempts {
+				t.Errorf("expected %d attempts, got %d (%d requests)", tc.expectedAttempts,
+					len(delivery.Attempts), *requests)
+			}
+
+			if delivery.Delivered != tc.expectedDelivered {
+				t.Errorf("expected delivered: %t, got %t", tc.expectedDelivered, delivery.Delivered)
+			}
+
+			if delivery.BookingID != bookingID || delivery.Status != api.BookingStatusCONFIRMED {
+				t.Errorf("wrong delivery log: %+v", delivery)
+			}
+
+			if !tc.expectedDelivered {
+				return
+			}
+
+			// The MaaS server validates the event against the specification,
+			// verifies its idToken, and stores the booking
+			received, err := maasDB.GetBooking(bookingID)
+			if err != nil || received.Status != api.BookingStatusCONFIRMED {
+				t.Errorf("expected the MaaS platform to receive the confirmed booking")
+			}
+		})
+	}
+}
+
+func TestWebhookWithAdminAPI(t *testing.T) {
+	bookingID := repUUID(701)
+
+	maasServer, _ := setupMaaSServer(db.NewMockDB(), 0, 0)
+	defer maasServer.Close()
+
+	operatorServer, webhook := setupOperatorServer(t, maasServer.URL, bookingID)
+	defer operatorServer.Close()
+
+	for _, status := range []api.BookingStatus{api.BookingStatusCONFIRMED, api.BookingStatusCANCELLED} {
+		code, body := adminRequest(t, operatorServer, http.MethodPatch,
+			"/admin/bookings/"+bookingID.String()+"?status="+string(status), adminKey, nil)
+		if code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d (%s)", http.StatusOK, code, body)
+		}
+	}
+
+	// No notification if status is unchanged
+	if code, _ := adminRequest(t, operatorServer, http.MethodPatch,
+		"/admin/bookings/"+bookingID.String()+"?status=CANCELLED", adminKey, nil); code != http.StatusConflict {
+		t.Errorf("expected status code %d, got %d", http.StatusConflict, code)
+	}
+
+	util.PanicIf(webhook.Close(context.Background()))
+
+	code, body := adminRequest(t, operatorServer, http.MethodGet, "/admin/webhook/deliveries", adminKey, nil)
+	if code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, code)
+	}
+
+	var deliveries []Delivery
+	util.PanicIf(json.Unmarshal(body, &deliveries))
+
+	if len(deliveries) != 2 ||
+		deliveries[0].Status != api.BookingStatusCONFIRMED ||
+		deliveries[1].Status != api.BookingStatusCANCELLED {
+		t.Errorf("expected deliveries of status changes in order, got %s", body)
+	}
+}
+
+func TestWebhookClose(t *testing.T) {
+	bookingID := repUUID(702)
+
+	maasServer, requests := setupMaaSServer(db.NewMockDB(), 1, http.StatusServiceUnavailable)
+	defer maasServer.Close()
+
+	operatorDB := db.NewMockDB()
+	operatorDB.Bookings = NewBookingsByID(makeBooking(bookingID))
+
+	webhook, err := newWebhook(maasServer.URL, "", idTokenSecret, 2, 200*time.Millisecond)
+	util.PanicIf(err)
+
+	webhook.NotifyStatusChange(operatorDB, bookingID)
+
+	// The event is not delivered before the retry
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := webhook.Close(ctx); err == nil {
+		t.Error("expected an error when closing before pending events are delivered")
+	}
+
+	// No event is accepted once closed
+	webhook.NotifyStatusChange(operatorDB, bookingID)
+
+	util.PanicIf(webhook.Close(context.Background()))
+
+	deliveries := webhook.Deliveries()
+	if len(deliveries) != 2 || !deliveries[1].Delivered || deliveries[0].Delivered ||
+		deliveries[0].Attempts[0].Error != "webhook is closed" {
+		t.Errorf("expected a rejected event then a delivered one, got %+v", deliveries)
+	}
+
+	if *requests != 2 {
+		t.Errorf("expected 2 requests, got %d", *requests)
+	}
+}
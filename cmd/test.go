@@ -21,31 +21,96 @@ var testCmd = &cobra.Command{
 			body = nil
 		}
 
-		err = test.RunTest(method, URL, query, body, verbose, apiKey, flagsWithDefault(http.StatusOK))
+		startRecording()
+
+		err = test.RunTestWithOptions(method, URL, query, body, flagsWithDefault(http.StatusOK),
+			test.RunOptions{Verbose: verbose, Format: reportFormat, APIKey: apiKey})
 		exitWithError(err)
 	},
 }
 
 var (
-	apiKey             string
-	URL                string
-	verbose            bool
-	query              test.Query
-	expectNonEmpty     bool
-	expectResponseCode int
-	method             string
+	apiKey                    string
+	URL                       string
+	verbose                   bool
+	reportFormat              = test.ReportText
+	query                     test.Query
+	expectNonEmpty            bool
+	expectAuthRequired        bool
+	expectIDTokenVerified     bool
+	idTokenSecret             string
+	idTokenAudience           string
+	expectTransitionsEnforced bool
+	expectDeepLink            bool
+	deepLinkHosts             []string
+	expectResponseCode        int
+	method                    string
+	recordDir                 string
 )
 
 func init() {
 	rootCmd.AddCommand(testCmd)
 
 	testCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Make the operation more talkative")
+	testCmd.PersistentFlags().Var(
+		&reportFormat,
+		"report-format",
+		"Format of the test report, either text (default), json or junit",
+	)
 	testCmd.PersistentFlags().BoolVar(
 		&expectNonEmpty,
 		"expectNonEmpty",
 		test.DefaultFlagExpectNonEmpty,
 		"Should an empty request return an error",
 	)
+	testCmd.PersistentFlags().BoolVar(
+		&expectAuthRequired,
+		"expectAuthRequired",
+		test.DefaultFlagExpectAuthRequired,
+		"Additionally check that the request without API key is rejected with code 401",
+	)
+	testCmd.PersistentFlags().BoolVar(
+		&expectIDTokenVerified,
+		"expectIdTokenVerified",
+		test.DefaultFlagExpectIDTokenVerified,
+		"Additionally check that the booking event with a forged or expired idToken is rejected (only for POST /booking_events)",
+	)
+	testCmd.PersistentFlags().StringVar(
+		&idTokenSecret,
+		"idTokenSecret",
+		"",
+		"Shared secret of idTokens, used to sign the expired idToken of --expectIdTokenVerified",
+	)
+	testCmd.PersistentFlags().StringVar(
+		&idTokenAudience,
+		"idTokenAudience",
+		test.DefaultFlagIDTokenAudience,
+		"Audience of the idTokens of --expectIdTokenVerified: the operator served by the tested server",
+	)
+	testCmd.PersistentFlags().BoolVar(
+		&expectTransitionsEnforced,
+		"expectTransitionsEnforced",
+		test.DefaultFlagExpectTransitionsEnforced,
+		"Additionally check that the status changes not allowed from the new booking status are rejected with code 409 (only for PATCH /bookings). They are probed on a copy of the booking, created with POST /bookings",
+	)
+	testCmd.PersistentFlags().BoolVar(
+		&expectDeepLink,
+		"expectDeepLink",
+		test.DefaultFlagExpectDeepLinkSupport,
+		"Additionally check that returned journeys, trips and bookings have a webUrl, for booking by deep link",
+	)
+	testCmd.PersistentFlags().StringSliceVar(
+		&deepLinkHosts,
+		"deepLinkHosts",
+		nil,
+		"Hosts allowed in the webUrls checked by --expectDeepLink. Defaults to any host",
+	)
+	testCmd.PersistentFlags().StringVar(
+		&recordDir,
+		"record",
+		"",
+		"Directory where requests and responses are saved as HAR files, to replay the tests offline with \"test replay\"",
+	)
 	testCmd.PersistentFlags().StringVar(&apiKey, "auth", "", "API key sent in the \"X-API-Key\" header of the request")
 	testCmd.PersistentFlags().IntVar(
 		&expectResponseCode,
@@ -62,9 +127,24 @@ func init() {
 	testCmd.Flags().VarP(&query, "query", "q", "Query parameters in the form name=value")
 }
 
+// startRecording records the requests and responses of the tests in the
+// directory of the --record flag, if set
+func startRecording() {
+	if recordDir != "" {
+		exitWithError(test.RecordTo(recordDir))
+	}
+}
+
 func flagsWithDefault(defaultStatus int) test.Flags {
 	flags := test.NewFlags()
 	flags.ExpectNonEmpty = expectNonEmpty
+	flags.ExpectAuthRequired = expectAuthRequired
+	flags.ExpectIDTokenVerified = expectIDTokenVerified
+	flags.IDTokenSecret = idTokenSecret
+	flags.IDTokenAudience = idTokenAudience
+	flags.ExpectTransitionsEnforced = expectTransitionsEnforced
+	flags.ExpectDeepLinkSupport = expectDeepLink
+	flags.DeepLinkHosts = deepLinkHosts
 	if expectResponseCode == 0 { //not set
 		flags.ExpectedResponseCode = defaultStatus
 	} else {
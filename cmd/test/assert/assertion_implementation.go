@@ -2,14 +2,21 @@
 package assert
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"math"
 	"net/http"
+	"net/url"
+	"path"
+	"reflect"
 	"strings"
+	"time"
 
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
 	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
+	"github.com/google/uuid"
 	tld "github.com/jpillora/go-tld"
 	"github.com/pkg/errors"
 )
@@ -31,6 +38,13 @@ func StatusCode(a Accumulator, resp *http.Response, statusCode int) {
 	a.Queue(assertion)
 }
 
+// CriticStatusCode is the same as StatusCode, but a failure prevents the
+// following assertions to be executed.
+func CriticStatusCode(a Accumulator, resp *http.Response, statusCode int) {
+	assertion := Critic(assertStatusCode{resp, statusCode})
+	a.Queue(assertion)
+}
+
 // StatusCodeOK checks if a given response has status 200 OK
 func StatusCodeOK(a Accumulator, resp *http.Response) {
 	StatusCode(a, resp, http.StatusOK)
@@ -56,6 +70,37 @@ func CriticFormat(a Accumulator, request *http.Request, response *http.Response)
 	a.Queue(assertion)
 }
 
+// RequestFormat checks if the request data has the expected format. It is
+// used on requests received from an API under test.
+func RequestFormat(a Accumulator, request *http.Request) {
+	assertion := assertRequestFormat{request}
+	a.Queue(assertion)
+}
+
+// CriticRequestFormat is the same as RequestFormat, but a failure prevents
+// the following assertions to be executed.
+func CriticRequestFormat(a Accumulator, request *http.Request) {
+	assertion := Critic(assertRequestFormat{request})
+	a.Queue(assertion)
+}
+
+// BookingEventKnownBooking checks that a booking event received by `listen`
+// refers to a known booking (`known`), or creates a new booking with status
+// WAITING_CONFIRMATION.
+func BookingEventKnownBooking(a Accumulator, request *http.Request, known bool) {
+	assertion := assertBookingEventKnownBooking{request, known}
+	a.Queue(assertion)
+}
+
+// BookingEventStatus checks that the status of a booking event received by
+// `listen` is valid, and is a legal transition from `previous`, the status
+// of the booking in the previous event. `previous` is empty if there is no
+// previous event of the booking.
+func BookingEventStatus(a Accumulator, request *http.Request, previous api.BookingStatus) {
+	assertion := assertBookingEventStatus{request, previous}
+	a.Queue(assertion)
+}
+
 // JourneysDepartureRadius checks that the response data respect
 // the "departureRadius" query parameter
 func JourneysDepartureRadius(a Accumulator, request *http.Request, response *http.Response) {
@@ -97,6 +142,67 @@ func JourneysCount(a Accumulator, request *http.Request, response *http.Response
 	a.Queue(assertion)
 }
 
+// PassengerJourneysPassenger checks the format of the "passenger" user object
+// of each passenger journey of the response
+func PassengerJourneysPassenger(a Accumulator, response *http.Response) {
+	assertion := assertPassengerJourneysPassenger{response}
+	a.Queue(assertion)
+}
+
+// PassengerJourneysRequestedSeats checks that the "requestedSeats" of each
+// passenger journey of the response, if any, is positive
+func PassengerJourneysRequestedSeats(a Accumulator, response *http.Response) {
+	assertion := assertPassengerJourneysRequestedSeats{response}
+	a.Queue(assertion)
+}
+
+// NoDriverProperties checks that the passenger journeys of the response have
+// none of the properties specific to driver journeys, e.g. "driver", "car"
+// or "price"
+func NoDriverProperties(a Accumulator, response *http.Response) {
+	assertion := assertNoDriverProperties{response}
+	a.Queue(assertion)
+}
+
+// DriverJourneysDates checks that the driver of each driver journey of the
+// response departs before the passenger pickup
+func DriverJourneysDates(a Accumulator, response *http.Response) {
+	assertion := assertDriverJourneysDates{response}
+	a.Queue(assertion)
+}
+
+// DriverJourneysDurationDistance checks that the duration and distance of
+// each driver journey of the response are positive, and plausible given the
+// distance as the crow flies between passenger pickup and drop
+func DriverJourneysDurationDistance(a Accumulator, response *http.Response) {
+	assertion := assertDriverJourneysDurationDistance{response}
+	a.Queue(assertion)
+}
+
+// DriverJourneysWalking checks that the walking distances and durations of
+// each driver journey of the response are not negative
+func DriverJourneysWalking(a Accumulator, response *http.Response) {
+	assertion := assertDriverJourneysWalking{response}
+	a.Queue(assertion)
+}
+
+// DriverJourneysPolyline checks that the "journeyPolyline" of each driver
+// journey of the response, if any, starts near the driver departure and ends
+// near the driver arrival
+func DriverJourneysPolyline(a Accumulator, response *http.Response) {
+	assertion := assertDriverJourneysPolyline{response}
+	a.Queue(assertion)
+}
+
+// RegularTripsSchedules checks that each regular trip of the response has a
+// schedule complying to all the "departureWeekdays", "departureTimeOfDay"
+// (within "timeDelta"), "minDepartureDate" and "maxDepartureDate" query
+// parameters together
+func RegularTripsSchedules(a Accumulator, request *http.Request, response *http.Response) {
+	assertion := assertRegularTripsSchedules{request, response}
+	a.Queue(assertion)
+}
+
 // UniqueIDs checks that all IDs (property "id"), if they exist, are
 // unique.
 func UniqueIDs(a Accumulator, response *http.Response) {
@@ -111,11 +217,76 @@ func OperatorFieldFormat(a Accumulator, response *http.Response) {
 	a.Queue(assertion)
 }
 
+// DeepLinks checks that each journey or trip of the response has a webUrl,
+// which is an https URL on one of the allowedHosts, if any.
+func DeepLinks(a Accumulator, response *http.Response, allowedHosts []string) {
+	assertion := assertDeepLinks{response, allowedHosts}
+	a.Queue(assertion)
+}
+
 func BookingStatus(a Accumulator, response *http.Response, expectedStatus string) {
 	assertion := assertBookingStatus{response, expectedStatus}
 	a.Queue(assertion)
 }
 
+// UnauthenticatedRejected checks that the same request, sent without API
+// key, is rejected with code 401.
+func UnauthenticatedRejected(a Accumulator, request *http.Request) {
+	assertion := assertUnauthenticatedRejected{request, Client}
+	a.Queue(assertion)
+}
+
+// InvalidIDTokenRejected checks that the same booking event, sent with a
+// forged idToken and with an expired idToken, is rejected with code 401. If
+// idTokenSecret is not empty, the expired idToken is signed with it. Both
+// idTokens have audience idTokenAudience (the operator of the tested server)
+// if not empty, so that they are only invalid for their signature or expiry.
+func InvalidIDTokenRejected(a Accumulator, request *http.Request, idTokenSecret, idTokenAudience string) {
+	assertion := assertInvalidIDTokenRejected{request, Client, idTokenSecret, idTokenAudience}
+	a.Queue(assertion)
+}
+
+// IllegalTransitionsRejected checks that, after a successful PATCH /bookings,
+// the status changes not allowed from the new status of the booking are
+// rejected with code 409. They are probed on a copy of the booking, created
+// with POST /bookings and brought to the same status, so that the tested
+// booking is unchanged. Probing stops at the first one accepted, as the
+// status of the copy then changes.
+func IllegalTransitionsRejected(a Accumulator, request *http.Request, response *http.Response) {
+	assertion := assertIllegalTransitionsRejected{request, response, Client}
+	a.Queue(assertion)
+}
+
+// BookingPaying checks that the price type of the booking is PAYING, as
+// required for bookings by API.
+func BookingPaying(a Accumulator, response *http.Response) {
+	a.Queue(assertBookingPaying{response})
+}
+
+// BookingPriceAmount checks that the price of a PAYING booking has an amount.
+func BookingPriceAmount(a Accumulator, response *http.Response) {
+	a.Queue(assertBookingPriceAmount{response})
+}
+
+// BookingWebURL checks that the booking has a webUrl, as required for
+// booking by deep link. The webUrl must be an https URL on one of the
+// allowedHosts, if any.
+func BookingWebURL(a Accumulator, response *http.Response, allowedHosts []string) {
+	a.Queue(assertBookingWebURL{response, allowedHosts})
+}
+
+// BookingOperatorsFormat checks the format of the operator of the driver and
+// of the passenger of the booking.
+func BookingOperatorsFormat(a Accumulator, response *http.Response) {
+	a.Queue(assertBookingOperatorsFormat{response})
+}
+
+// BookingEchoed checks that the booking returned by POST /bookings has the
+// properties of the submitted booking.
+func BookingEchoed(a Accumulator, request *http.Request, response *http.Response) {
+	a.Queue(assertBookingEchoed{request, response})
+}
+
 /////////////////////////////////////////////////////////////
 
 type assertAPICallSuccess struct {
@@ -198,6 +369,87 @@ func (a assertFormat) Describe() string {
 
 /////////////////////////////////////////////////////////////
 
+type assertRequestFormat struct {
+	request *http.Request
+}
+
+func (a assertRequestFormat) Execute() error {
+	return validateRequest(a.request)
+}
+
+func (a assertRequestFormat) Describe() string {
+	return "assert request format"
+}
+
+/////////////////////////////////////////////////////////////
+
+type assertBookingEventKnownBooking struct {
+	request *http.Request
+	known   bool
+}
+
+func (a assertBookingEventKnownBooking) Execute() error {
+	if a.known {
+		return nil
+	}
+
+	booking, err := parseBookingEventRequest(a.request)
+	if err != nil {
+		return failedParsing("request", err)
+	}
+
+	if booking.Status != api.BookingStatusWAITINGCONFIRMATION {
+		return fmt.Errorf(
+			"booking %s is unknown: expected a new booking with status %s, got status %s",
+			booking.Id,
+			api.BookingStatusWAITINGCONFIRMATION,
+			booking.Status,
+		)
+	}
+
+	return nil
+}
+
+func (a assertBookingEventKnownBooking) Describe() string {
+	return "assert booking event refers to a known booking"
+}
+
+/////////////////////////////////////////////////////////////
+
+type assertBookingEventStatus struct {
+	request  *http.Request
+	previous api.BookingStatus
+}
+
+func (a assertBookingEventStatus) Execute() error {
+	booking, err := parseBookingEventRequest(a.request)
+	if err != nil {
+		return failedParsing("request", err)
+	}
+
+	if !booking.Status.IsValid() {
+		return fmt.Errorf("invalid booking status %q", booking.Status)
+	}
+
+	if a.previous == "" || a.previous == booking.Status ||
+		a.previous.CanTransitionTo(booking.Status) {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"booking %s cannot change status from %s (previous event) to %s",
+		booking.Id,
+		a.previous,
+		booking.Status,
+	)
+}
+
+func (a assertBookingEventStatus) Describe() string {
+	return "assert booking event status"
+}
+
+/////////////////////////////////////////////////////////////
+
 type departureOrArrival string
 
 const (
@@ -352,113 +604,1133 @@ func (a assertJourneysCount) Describe() string {
 
 /////////////////////////////////////////////////////////////
 
-type assertUniqueIDs struct {
+type assertPassengerJourneysPassenger struct {
 	response *http.Response
 }
 
-func (a assertUniqueIDs) Execute() error {
-	objsWithID, err := parseArrayResponse(a.response)
+func (a assertPassengerJourneysPassenger) Execute() error {
+	passengerJourneys, err := parseArrayResponse(a.response)
 	if err != nil {
 		return failedParsing("response", err)
 	}
 
-	ids := map[string]bool{}
+	for _, passengerJourney := range passengerJourneys {
+		var withPassenger struct {
+			Passenger *api.User `json:"passenger"`
+		}
 
-	for _, objWithID := range objsWithID {
-		idPtr, err := getResponseID(objWithID)
-		if err != nil {
+		if err := json.Unmarshal(passengerJourney, &withPassenger); err != nil {
 			return failedParsing("response", err)
 		}
 
-		if idPtr != nil {
-			id := *idPtr
-
-			_, idDuplicate := ids[id]
-			if idDuplicate {
-				return errors.New("IDs should be unique")
-			}
+		if withPassenger.Passenger == nil {
+			return errors.New("a passenger journey has no passenger")
+		}
 
-			ids[id] = true
+		if err := validateUser(*withPassenger.Passenger); err != nil {
+			return fmt.Errorf("passenger: %w", err)
 		}
 	}
 
 	return nil
 }
 
-func (a assertUniqueIDs) Describe() string {
-	return "assert unique ids"
+// validateUser checks that a user is identified, and has a well formed
+// operator and grade
+func validateUser(user api.User) error {
+	if user.Id == "" || user.Alias == "" {
+		return errors.New("user id and alias are required")
+	}
+
+	if err := validateOperator(user.Operator); err != nil {
+		return err
+	}
+
+	if user.Grade != nil && (*user.Grade < 1 || *user.Grade > 5) {
+		return fmt.Errorf("user grade %d is not between 1 and 5", *user.Grade)
+	}
+
+	return nil
+}
+
+func (a assertPassengerJourneysPassenger) Describe() string {
+	return "assert response property \"passenger\""
 }
 
 /////////////////////////////////////////////////////////////
 
-type assertOperatorFieldFormat struct {
+type assertPassengerJourneysRequestedSeats struct {
 	response *http.Response
 }
 
-func (a assertOperatorFieldFormat) Execute() error {
-	objsWithOperator, err := parseArrayResponse(a.response)
+func (a assertPassengerJourneysRequestedSeats) Execute() error {
+	passengerJourneys, err := parseArrayResponse(a.response)
 	if err != nil {
-		return err
+		return failedParsing("response", err)
 	}
 
-	for _, objWithOperator := range objsWithOperator {
-		operator, err := getResponseOperator(objWithOperator)
-		if err != nil {
+	for _, passengerJourney := range passengerJourneys {
+		var withRequestedSeats struct {
+			RequestedSeats *int `json:"requestedSeats"`
+		}
+
+		if err := json.Unmarshal(passengerJourney, &withRequestedSeats); err != nil {
 			return failedParsing("response", err)
 		}
 
-		if err := validateOperator(operator); err != nil {
-			return err
+		if seats := withRequestedSeats.RequestedSeats; seats != nil && *seats <= 0 {
+			return fmt.Errorf("a passenger journey requests %d seats, expected a positive number", *seats)
 		}
 	}
 
 	return nil
 }
 
-func validateOperator(operator string) error {
-	uri, err := tld.Parse("https://" + operator)
+func (a assertPassengerJourneysRequestedSeats) Describe() string {
+	return "assert response property \"requestedSeats\""
+}
+
+/////////////////////////////////////////////////////////////
+
+// driverProperties are the properties of driver journeys, which passenger
+// journeys do not have
+var driverProperties = []string{
+	"availableSeats",
+	"car",
+	"departureToPickupWalkingDistance",
+	"departureToPickupWalkingDuration",
+	"departureToPickupWalkingPolyline",
+	"driver",
+	"dropoffToArrivalWalkingDistance",
+	"dropoffToArrivalWalkingDuration",
+	"dropoffToArrivalWalkingPolyline",
+	"price",
+}
+
+type assertNoDriverProperties struct {
+	response *http.Response
+}
+
+func (a assertNoDriverProperties) Execute() error {
+	passengerJourneys, err := parseArrayResponse(a.response)
 	if err != nil {
-		return fmt.Errorf("wrong operator field format: %w", err)
+		return failedParsing("response", err)
 	}
 
-	if uri.Host == "" || uri.Path != "" || uri.User != nil || uri.RawQuery != "" {
-		return fmt.Errorf("wrong operator field format")
+	for _, passengerJourney := range passengerJourneys {
+		var properties map[string]json.RawMessage
+
+		if err := json.Unmarshal(passengerJourney, &properties); err != nil {
+			return failedParsing("response", err)
+		}
+
+		for _, property := range driverProperties {
+			if _, ok := properties[property]; ok {
+				return fmt.Errorf("a passenger journey has driver property %q", property)
+			}
+		}
 	}
 
 	return nil
 }
 
-func (a assertOperatorFieldFormat) Describe() string {
-	return "assert response property \"operator\""
+func (a assertNoDriverProperties) Describe() string {
+	return "assert no driver property"
 }
 
 /////////////////////////////////////////////////////////////
 
-type assertBookingStatus struct {
-	response       *http.Response
-	expectedStatus string
+type assertDriverJourneysDates struct {
+	response *http.Response
 }
 
-func (a assertBookingStatus) Execute() error {
-	bodyBytes, err := io.ReadAll(a.response.Body)
+func (a assertDriverJourneysDates) Execute() error {
+	driverJourneys, err := parseDriverJourneys(a.response)
 	if err != nil {
-		return err
+		return failedParsing("response", err)
 	}
 
-	status, err := getResponseStatus(json.RawMessage(bodyBytes))
+	for _, dj := range driverJourneys {
+		if dj.DriverDepartureDate != nil && *dj.DriverDepartureDate > dj.PassengerPickupDate {
+			return fmt.Errorf("driver departure date %d is after passenger pickup date %d",
+				*dj.DriverDepartureDate, dj.PassengerPickupDate)
+		}
+	}
+
+	return nil
+}
+
+func (a assertDriverJourneysDates) Describe() string {
+	return "assert driver departs before passenger pickup"
+}
+
+/////////////////////////////////////////////////////////////
+
+const (
+	// maxJourneySpeed is the maximum plausible average speed of a carpool, in
+	// km/h
+	maxJourneySpeed = 200
+
+	// crowFliesMargin is the share of the distance as the crow flies below
+	// which a carpool distance is not plausible. It allows for imprecise
+	// coordinates.
+	crowFliesMargin = 0.9
+)
+
+type assertDriverJourneysDurationDistance struct {
+	response *http.Response
+}
+
+func (a assertDriverJourneysDurationDistance) Execute() error {
+	driverJourneys, err := parseDriverJourneys(a.response)
 	if err != nil {
-		return err
+		return failedParsing("response", err)
 	}
 
-	if status != a.expectedStatus {
-		return fmt.Errorf(
-			"expected booking status %s, got %s", a.expectedStatus, status,
+	for _, dj := range driverJourneys {
+		if dj.Duration <= 0 {
+			return fmt.Errorf("journey duration %d is not positive", dj.Duration)
+		}
+
+		crowFlies := util.Distance(
+			util.Coord{Lat: dj.PassengerPickupLat, Lon: dj.PassengerPickupLng},
+			util.Coord{Lat: dj.PassengerDropLat, Lon: dj.PassengerDropLng},
 		)
+
+		hours := float64(dj.Duration) / 3600
+
+		if crowFlies/hours > maxJourneySpeed {
+			return fmt.Errorf("journey duration %ds is too short for %.1fkm as the crow flies",
+				dj.Duration, crowFlies)
+		}
+
+		if dj.Distance == nil {
+			continue
+		}
+
+		distance := float64(*dj.Distance) / 1000
+
+		if *dj.Distance <= 0 {
+			return fmt.Errorf("journey distance %d is not positive", *dj.Distance)
+		}
+
+		if distance < crowFlies*crowFliesMargin {
+			return fmt.Errorf("journey distance %dm is shorter than %.1fkm as the crow flies",
+				*dj.Distance, crowFlies)
+		}
+
+		if distance/hours > maxJourneySpeed {
+			return fmt.Errorf("journey duration %ds is too short for distance %dm",
+				dj.Duration, *dj.Distance)
+		}
 	}
 
 	return nil
 }
 
-func (a assertBookingStatus) Describe() string {
-	return fmt.Sprintf("assert booking status %s", a.expectedStatus)
+func (a assertDriverJourneysDurationDistance) Describe() string {
+	return "assert journey duration and distance"
+}
+
+/////////////////////////////////////////////////////////////
+
+type assertDriverJourneysWalking struct {
+	response *http.Response
+}
+
+func (a assertDriverJourneysWalking) Execute() error {
+	driverJourneys, err := parseDriverJourneys(a.response)
+	if err != nil {
+		return failedParsing("response", err)
+	}
+
+	for _, dj := range driverJourneys {
+		walking := []struct {
+			property string
+			value    *int
+		}{
+			{"departureToPickupWalkingDistance", dj.DepartureToPickupWalkingDistance},
+			{"departureToPickupWalkingDuration", dj.DepartureToPickupWalkingDuration},
+			{"dropoffToArrivalWalkingDistance", dj.DropoffToArrivalWalkingDistance},
+			{"dropoffToArrivalWalkingDuration", dj.DropoffToArrivalWalkingDuration},
+		}
+
+		for _, w := range walking {
+			if w.value != nil && *w.value < 0 {
+				return fmt.Errorf("%s %d is negative", w.property, *w.value)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (a assertDriverJourneysWalking) Describe() string {
+	return "assert walking distances and durations"
+}
+
+/////////////////////////////////////////////////////////////
+
+// polylineTolerance is the maximum distance, in km, between the ends of a
+// journey polyline and the driver departure and arrival
+const polylineTolerance = 1
+
+type assertDriverJourneysPolyline struct {
+	response *http.Response
+}
+
+func (a assertDriverJourneysPolyline) Execute() error {
+	driverJourneys, err := parseDriverJourneys(a.response)
+	if err != nil {
+		return failedParsing("response", err)
+	}
+
+	for _, dj := range driverJourneys {
+		if dj.JourneyPolyline == nil {
+			continue
+		}
+
+		coords, err := decodePolyline(*dj.JourneyPolyline)
+		if err != nil {
+			return fmt.Errorf("wrong journeyPolyline format: %w", err)
+		}
+
+		if len(coords) == 0 {
+			return errors.New("journeyPolyline is empty")
+		}
+
+		ends := []struct {
+			name  string
+			coord util.Coord
+			lat   *float64
+			lng   *float64
+		}{
+			{"driver departure", coords[0], dj.DriverDepartureLat, dj.DriverDepartureLng},
+			{"driver arrival", coords[len(coords)-1], dj.DriverArrivalLat, dj.DriverArrivalLng},
+		}
+
+		for _, end := range ends {
+			if end.lat == nil || end.lng == nil {
+				continue
+			}
+
+			d := util.Distance(end.coord, util.Coord{Lat: *end.lat, Lon: *end.lng})
+			if d > polylineTolerance {
+				return fmt.Errorf("journeyPolyline is %.1fkm away from the %s", d, end.name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (a assertDriverJourneysPolyline) Describe() string {
+	return "assert response property \"journeyPolyline\""
+}
+
+/////////////////////////////////////////////////////////////
+
+type assertRegularTripsSchedules struct {
+	request  *http.Request
+	response *http.Response
+}
+
+func (a assertRegularTripsSchedules) Execute() error {
+	constraints, err := scheduleConstraints(a.request)
+	if err != nil {
+		return failedParsing("request", err)
+	}
+
+	regularTrips, err := parseArrayResponse(a.response)
+	if err != nil {
+		return failedParsing("response", err)
+	}
+
+	for i, regularTrip := range regularTrips {
+		schedules, err := getResponseSchedules(regularTrip)
+		if err != nil {
+			return failedParsing("response", err)
+		}
+
+		if len(schedules) == 0 {
+			return fmt.Errorf("regular trip %d has no schedule", i)
+		}
+
+		failures := []string{}
+
+		for j, schedule := range schedules {
+			failed, err := failedScheduleConstraints(schedule, constraints)
+			if err != nil {
+				return failedParsing("response", err)
+			}
+
+			if len(failed) == 0 {
+				failures = nil
+				break
+			}
+
+			failures = append(failures,
+				fmt.Sprintf("schedule %d does not comply to %s", j, strings.Join(failed, ", ")))
+		}
+
+		if failures != nil {
+			return fmt.Errorf("regular trip %d has no schedule complying to all query parameters: %s",
+				i, strings.Join(failures, "; "))
+		}
+	}
+
+	return nil
+}
+
+func (a assertRegularTripsSchedules) Describe() string {
+	return "assert query parameters \"departureWeekdays\", \"departureTimeOfDay\", \"minDepartureDate\" and \"maxDepartureDate\""
+}
+
+// scheduleConstraint is a query parameter of regular trips searches, which a
+// schedule must comply to
+type scheduleConstraint struct {
+	name string
+	keep func(api.Schedule) (bool, error)
+}
+
+// scheduleConstraints returns the constraints of the query parameters of a
+// regular trips search
+func scheduleConstraints(request *http.Request) ([]scheduleConstraint, error) {
+	weekdays := getQueryWeekdays(request)
+
+	timeOfDay, err := getQueryTimeOfDay(request)
+	if err != nil {
+		return nil, err
+	}
+
+	timeDelta, err := getQueryTimeDelta(request)
+	if err != nil {
+		return nil, err
+	}
+
+	min, max, err := getQueryMinMaxDepartureDate(request)
+	if err != nil {
+		return nil, err
+	}
+
+	onWeekdays := func(schedule api.Schedule) (bool, error) {
+		if schedule.PassengerPickupDay == nil {
+			return false, nil
+		}
+
+		for _, weekday := range weekdays {
+			if string(*schedule.PassengerPickupDay) == weekday {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	}
+
+	inTimeDelta := func(schedule api.Schedule) (bool, error) {
+		if schedule.PassengerPickupTimeOfDay == nil {
+			return false, nil
+		}
+
+		seconds, err := secondsBetweenTimesOfDay(*schedule.PassengerPickupTimeOfDay, timeOfDay)
+		if err != nil {
+			return false, err
+		}
+
+		return seconds <= float64(timeDelta), nil
+	}
+
+	// A schedule without journey schedules applies to any date
+	inPeriod := func(schedule api.Schedule) (bool, error) {
+		if schedule.JourneySchedules == nil || (min == nil && max == nil) {
+			return true, nil
+		}
+
+		for _, js := range *schedule.JourneySchedules {
+			belowMin := min != nil && js.PassengerPickupDate < int64(*min)
+			aboveMax := max != nil && js.PassengerPickupDate > int64(*max)
+
+			if !belowMin && !aboveMax {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	}
+
+	return []scheduleConstraint{
+		{"departureWeekdays", onWeekdays},
+		{"departureTimeOfDay and timeDelta", inTimeDelta},
+		{"minDepartureDate and maxDepartureDate", inPeriod},
+	}, nil
+}
+
+// failedScheduleConstraints returns the names of the constraints a schedule
+// does not comply to
+func failedScheduleConstraints(schedule api.Schedule, constraints []scheduleConstraint) ([]string, error) {
+	failed := []string{}
+
+	for _, constraint := range constraints {
+		kept, err := constraint.keep(schedule)
+		if err != nil {
+			return nil, err
+		}
+
+		if !kept {
+			failed = append(failed, constraint.name)
+		}
+	}
+
+	return failed, nil
+}
+
+/////////////////////////////////////////////////////////////
+
+type assertUniqueIDs struct {
+	response *http.Response
+}
+
+func (a assertUniqueIDs) Execute() error {
+	objsWithID, err := parseArrayResponse(a.response)
+	if err != nil {
+		return failedParsing("response", err)
+	}
+
+	ids := map[string]bool{}
+
+	for _, objWithID := range objsWithID {
+		idPtr, err := getResponseID(objWithID)
+		if err != nil {
+			return failedParsing("response", err)
+		}
+
+		if idPtr != nil {
+			id := *idPtr
+
+			_, idDuplicate := ids[id]
+			if idDuplicate {
+				return errors.New("IDs should be unique")
+			}
+
+			ids[id] = true
+		}
+	}
+
+	return nil
+}
+
+func (a assertUniqueIDs) Describe() string {
+	return "assert unique ids"
+}
+
+/////////////////////////////////////////////////////////////
+
+type assertOperatorFieldFormat struct {
+	response *http.Response
+}
+
+func (a assertOperatorFieldFormat) Execute() error {
+	objsWithOperator, err := parseArrayResponse(a.response)
+	if err != nil {
+		return err
+	}
+
+	for _, objWithOperator := range objsWithOperator {
+		operator, err := getResponseOperator(objWithOperator)
+		if err != nil {
+			return failedParsing("response", err)
+		}
+
+		if err := validateOperator(operator); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateOperator(operator string) error {
+	uri, err := tld.Parse("https://" + operator)
+	if err != nil {
+		return fmt.Errorf("wrong operator field format: %w", err)
+	}
+
+	if uri.Host == "" || uri.Path != "" || uri.User != nil || uri.RawQuery != "" {
+		return fmt.Errorf("wrong operator field format")
+	}
+
+	return nil
+}
+
+func (a assertOperatorFieldFormat) Describe() string {
+	return "assert response property \"operator\""
+}
+
+/////////////////////////////////////////////////////////////
+
+type assertDeepLinks struct {
+	response     *http.Response
+	allowedHosts []string
+}
+
+func (a assertDeepLinks) Execute() error {
+	objsWithWebURL, err := parseArrayResponse(a.response)
+	if err != nil {
+		return err
+	}
+
+	for _, objWithWebURL := range objsWithWebURL {
+		webURL, err := getResponseWebURL(objWithWebURL)
+		if err != nil {
+			return failedParsing("response", err)
+		}
+
+		if err := validateDeepLink(webURL, a.allowedHosts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateDeepLink checks that webURL is an absolute https URL, on one of
+// allowedHosts if any
+func validateDeepLink(webURL string, allowedHosts []string) error {
+	if webURL == "" {
+		return errors.New("webUrl is required when deep link support is expected")
+	}
+
+	uri, err := url.Parse(webURL)
+	if err != nil {
+		return fmt.Errorf("wrong webUrl format: %w", err)
+	}
+
+	if uri.Scheme != "https" || uri.Host == "" {
+		return fmt.Errorf("webUrl %s is not an absolute https URL", webURL)
+	}
+
+	if len(allowedHosts) == 0 {
+		return nil
+	}
+
+	for _, host := range allowedHosts {
+		if strings.EqualFold(uri.Hostname(), host) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("host of webUrl %s is not among the allowed hosts %s",
+		webURL, strings.Join(allowedHosts, ", "))
+}
+
+func (a assertDeepLinks) Describe() string {
+	return "assert response property \"webUrl\""
+}
+
+/////////////////////////////////////////////////////////////
+
+type assertBookingStatus struct {
+	response       *http.Response
+	expectedStatus string
+}
+
+func (a assertBookingStatus) Execute() error {
+	bodyBytes, err := io.ReadAll(a.response.Body)
+	if err != nil {
+		return err
+	}
+
+	status, err := getResponseStatus(json.RawMessage(bodyBytes))
+	if err != nil {
+		return err
+	}
+
+	if status != a.expectedStatus {
+		return fmt.Errorf(
+			"expected booking status %s, got %s", a.expectedStatus, status,
+		)
+	}
+
+	return nil
+}
+
+func (a assertBookingStatus) Describe() string {
+	return fmt.Sprintf("assert booking status %s", a.expectedStatus)
+}
+
+/////////////////////////////////////////////////////////////
+
+type assertUnauthenticatedRejected struct {
+	request *http.Request
+	client  httpDoer
+}
+
+// httpDoer performs HTTP requests
+type httpDoer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Client sends the additional requests of assertions (e.g. the same request
+// without API key). It can be replaced, e.g. to record or replay these
+// requests.
+var Client httpDoer = http.DefaultClient
+
+func (a assertUnauthenticatedRejected) Execute() error {
+	unauthenticated := a.request.Clone(a.request.Context())
+	unauthenticated.Header.Del(api.HeaderXAPIKey)
+
+	if a.request.GetBody != nil {
+		body, err := a.request.GetBody()
+		if err != nil {
+			return failedParsing("request", err)
+		}
+
+		unauthenticated.Body = body
+	}
+
+	response, err := a.client.Do(unauthenticated)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusUnauthorized {
+		return fmt.Errorf(
+			"expected request without API key to be rejected with status code %d, got %d",
+			http.StatusUnauthorized,
+			response.StatusCode,
+		)
+	}
+
+	return nil
+}
+
+func (a assertUnauthenticatedRejected) Describe() string {
+	return "assert unauthenticated request is rejected"
+}
+
+/////////////////////////////////////////////////////////////
+
+type assertInvalidIDTokenRejected struct {
+	request         *http.Request
+	client          httpDoer
+	idTokenSecret   string
+	idTokenAudience string
+}
+
+func (a assertInvalidIDTokenRejected) Execute() error {
+	if a.request.GetBody == nil {
+		return failedParsing("request", errors.New("missing request body"))
+	}
+
+	body, err := a.request.GetBody()
+	if err != nil {
+		return failedParsing("request", err)
+	}
+	defer body.Close()
+
+	var event map[string]interface{}
+	if err := json.NewDecoder(body).Decode(&event); err != nil {
+		return failedParsing("request", err)
+	}
+
+	claims := idTokenClaims(event, a.idTokenAudience)
+
+	forgedToken, err := forgedIDToken(claims, time.Now().Add(time.Hour), nil)
+	if err != nil {
+		return err
+	}
+
+	expiredToken, err := forgedIDToken(claims, time.Now().Add(-time.Hour), []byte(a.idTokenSecret))
+	if err != nil {
+		return err
+	}
+
+	for _, invalid := range []struct{ name, token string }{
+		{"forged", forgedToken},
+		{"expired", expiredToken},
+	} {
+		event["idToken"] = invalid.token
+
+		statusCode, err := a.send(event)
+		if err != nil {
+			return err
+		}
+
+		if statusCode != http.StatusUnauthorized {
+			return fmt.Errorf(
+				"expected booking event with %s idToken to be rejected with status code %d, got %d",
+				invalid.name,
+				http.StatusUnauthorized,
+				statusCode,
+			)
+		}
+	}
+
+	return nil
+}
+
+// send sends the request with another body, and returns the status code of
+// the response
+func (a assertInvalidIDTokenRejected) send(body interface{}) (int, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+
+	request := a.request.Clone(a.request.Context())
+	request.Body = io.NopCloser(bytes.NewReader(b))
+	request.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	request.ContentLength = int64(len(b))
+
+	response, err := a.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	return response.StatusCode, nil
+}
+
+func (a assertInvalidIDTokenRejected) Describe() string {
+	return "assert invalid idToken is rejected"
+}
+
+/////////////////////////////////////////////////////////////
+
+type assertIllegalTransitionsRejected struct {
+	request  *http.Request
+	response *http.Response
+	client   httpDoer
+}
+
+func (a assertIllegalTransitionsRejected) Execute() error {
+	// The booking status is only known if the status change succeeded
+	if a.response.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	current := api.BookingStatus(a.request.URL.Query().Get("status"))
+	if !current.IsValid() {
+		return failedParsing("request", fmt.Errorf("invalid status %q", current))
+	}
+
+	illegal := []api.BookingStatus{}
+
+	for _, next := range api.BookingStatuses() {
+		if next != current && !current.CanTransitionTo(next) {
+			illegal = append(illegal, next)
+		}
+	}
+
+	// Transitions are probed on a copy of the booking, so that the tested
+	// booking is unchanged if the server accepts an illegal transition
+	probeID, err := a.newProbeBooking(current)
+	if err != nil {
+		return fmt.Errorf("cannot create a copy of the booking to probe illegal transitions: %w", err)
+	}
+
+	wrongCodes := []string{}
+
+	for _, next := range illegal {
+		statusCode, err := a.patch(probeID, next)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case statusCode == http.StatusConflict:
+
+		case isSuccessStatus(statusCode):
+			// The probed booking has changed status, later transitions would
+			// not be probed from `current`
+			return fmt.Errorf(
+				"expected illegal transition from %s to %s to be rejected with status code %d, got %d (other transitions were not probed)",
+				current,
+				next,
+				http.StatusConflict,
+				statusCode,
+			)
+
+		default:
+			wrongCodes = append(wrongCodes, fmt.Sprintf("%s to %s: %d", current, next, statusCode))
+		}
+	}
+
+	if len(wrongCodes) > 0 {
+		return fmt.Errorf(
+			"expected illegal transitions to be rejected with status code %d, got %s",
+			http.StatusConflict,
+			strings.Join(wrongCodes, ", "),
+		)
+	}
+
+	return nil
+}
+
+// newProbeBooking creates a copy of the tested booking with POST /bookings,
+// and brings it to `status` with legal transitions. It returns the ID of the
+// copy.
+func (a assertIllegalTransitionsRejected) newProbeBooking(status api.BookingStatus) (string, error) {
+	response, err := a.do(http.MethodGet, a.request.URL.Path, nil)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	booking, ok, err := parseBookingResponse(response)
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return "", fmt.Errorf("GET /bookings returned status code %d", response.StatusCode)
+	}
+
+	booking.Id = uuid.New()
+	booking.Status = api.BookingStatusWAITINGCONFIRMATION
+
+	body, err := json.Marshal(booking)
+	if err != nil {
+		return "", err
+	}
+
+	response, err = a.do(http.MethodPost, path.Dir(a.request.URL.Path), body)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if !isSuccessStatus(response.StatusCode) {
+		return "", fmt.Errorf("POST /bookings returned status code %d", response.StatusCode)
+	}
+
+	probeID := booking.Id.String()
+
+	for _, next := range transitionsTo(status) {
+		statusCode, err := a.patch(probeID, next)
+		if err != nil {
+			return "", err
+		}
+
+		if statusCode != http.StatusOK {
+			return "", fmt.Errorf("PATCH /bookings to status %s returned status code %d", next, statusCode)
+		}
+	}
+
+	return probeID, nil
+}
+
+// patch changes the status of a booking with PATCH /bookings, and returns
+// the status code of the response
+func (a assertIllegalTransitionsRejected) patch(bookingID string, status api.BookingStatus) (int, error) {
+	response, err := a.do(http.MethodPatch,
+		path.Join(path.Dir(a.request.URL.Path), bookingID)+"?status="+url.QueryEscape(string(status)), nil)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	return response.StatusCode, nil
+}
+
+// do sends a request with the headers of the tested request, to another path
+// (with query) of the same server
+func (a assertIllegalTransitionsRejected) do(method, pathWithQuery string, body []byte) (*http.Response, error) {
+	target, err := a.request.URL.Parse(pathWithQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(a.request.Context(), method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header = a.request.Header.Clone()
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	return a.client.Do(request)
+}
+
+func (a assertIllegalTransitionsRejected) Describe() string {
+	return "assert illegal status transitions are rejected"
+}
+
+/////////////////////////////////////////////////////////////
+
+// Booking assertions pass if the response is not successful, which is
+// checked by the status code assertion.
+
+type assertBookingPaying struct {
+	response *http.Response
+}
+
+func (a assertBookingPaying) Execute() error {
+	booking, ok, err := parseBookingResponse(a.response)
+	if !ok || err != nil {
+		return err
+	}
+
+	if booking.Price.Type == nil || *booking.Price.Type != api.PAYING {
+		return fmt.Errorf("expected price type %s for a booking by API, got %s",
+			api.PAYING, priceTypeString(booking.Price.Type))
+	}
+
+	return nil
+}
+
+func (a assertBookingPaying) Describe() string {
+	return "assert booking price type PAYING"
+}
+
+func priceTypeString(priceType *api.PriceType) string {
+	if priceType == nil {
+		return "none"
+	}
+
+	return string(*priceType)
+}
+
+/////////////////////////////////////////////////////////////
+
+type assertBookingPriceAmount struct {
+	response *http.Response
+}
+
+func (a assertBookingPriceAmount) Execute() error {
+	booking, ok, err := parseBookingResponse(a.response)
+	if !ok || err != nil {
+		return err
+	}
+
+	paying := booking.Price.Type != nil && *booking.Price.Type == api.PAYING
+	if paying && booking.Price.Amount == nil {
+		return errors.New("price amount is required if price type is PAYING")
+	}
+
+	return nil
+}
+
+func (a assertBookingPriceAmount) Describe() string {
+	return "assert booking price amount"
+}
+
+/////////////////////////////////////////////////////////////
+
+type assertBookingWebURL struct {
+	response     *http.Response
+	allowedHosts []string
+}
+
+func (a assertBookingWebURL) Execute() error {
+	booking, ok, err := parseBookingResponse(a.response)
+	if !ok || err != nil {
+		return err
+	}
+
+	if booking.WebUrl == nil {
+		return validateDeepLink("", a.allowedHosts)
+	}
+
+	return validateDeepLink(*booking.WebUrl, a.allowedHosts)
+}
+
+func (a assertBookingWebURL) Describe() string {
+	return "assert booking webUrl"
+}
+
+/////////////////////////////////////////////////////////////
+
+type assertBookingOperatorsFormat struct {
+	response *http.Response
+}
+
+func (a assertBookingOperatorsFormat) Execute() error {
+	booking, ok, err := parseBookingResponse(a.response)
+	if !ok || err != nil {
+		return err
+	}
+
+	users := []struct {
+		role string
+		user api.User
+	}{{"driver", booking.Driver}, {"passenger", booking.Passenger}}
+
+	for _, u := range users {
+		// A booking known through a booking event only carries one of the
+		// carpoolers
+		if u.user == (api.User{}) {
+			continue
+		}
+
+		if err := validateOperator(u.user.Operator); err != nil {
+			return fmt.Errorf("%s: %w", u.role, err)
+		}
+	}
+
+	return nil
+}
+
+func (a assertBookingOperatorsFormat) Describe() string {
+	return "assert booking driver and passenger operators"
+}
+
+/////////////////////////////////////////////////////////////
+
+type assertBookingEchoed struct {
+	request  *http.Request
+	response *http.Response
+}
+
+func (a assertBookingEchoed) Execute() error {
+	if !isSuccessStatus(a.response.StatusCode) {
+		return nil
+	}
+
+	if a.request.GetBody == nil {
+		return failedParsing("request", errors.New("request body cannot be read again"))
+	}
+
+	requestBody, err := a.request.GetBody()
+	if err != nil {
+		return failedParsing("request", err)
+	}
+	defer requestBody.Close()
+
+	var submitted, returned map[string]interface{}
+
+	if err := json.NewDecoder(requestBody).Decode(&submitted); err != nil {
+		return failedParsing("request", err)
+	}
+
+	responseBody, err := io.ReadAll(a.response.Body)
+	if err != nil {
+		return failedParsing("response", err)
+	}
+
+	if err := json.Unmarshal(responseBody, &returned); err != nil {
+		return failedParsing("response", err)
+	}
+
+	for _, property := range sortedProperties(submitted) {
+		value, ok := returned[property]
+		if !ok {
+			return fmt.Errorf("returned booking misses submitted property %q", property)
+		}
+
+		if !reflect.DeepEqual(value, submitted[property]) {
+			return fmt.Errorf("returned booking differs from the submitted one on property %q", property)
+		}
+	}
+
+	return nil
+}
+
+func (a assertBookingEchoed) Describe() string {
+	return "assert returned booking is the submitted one"
 }
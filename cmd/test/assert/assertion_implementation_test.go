@@ -1,14 +1,25 @@
 package assert
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"path"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
 	"github.com/fabmob/playground-standard-covoiturage/cmd/endpoint"
 	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
@@ -661,3 +672,880 @@ func TestExpectedBookingStatus(t *testing.T) {
 		})
 	}
 }
+
+// authDoer returns 401 if the request has no API key, 200 otherwise, and
+// stores the last request.
+type authDoer struct {
+	lastRequest *http.Request
+	err         error
+}
+
+func (d *authDoer) Do(req *http.Request) (*http.Response, error) {
+	d.lastRequest = req
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	if req.Header.Get(api.HeaderXAPIKey) == "" {
+		return mockStatusResponse(http.StatusUnauthorized), nil
+	}
+
+	return mockStatusResponse(http.StatusOK), nil
+}
+
+func TestUnauthenticatedRejected(t *testing.T) {
+	testCases := []struct {
+		name        string
+		rejectsAuth bool
+		clientErr   error
+		expectError bool
+	}{
+		{"server rejecting requests without API key", true, nil, false},
+		{"server accepting requests without API key", false, nil, true},
+		{"client error", true, errors.New("connection refused"), true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var doer httpDoer = &authDoer{err: tc.clientErr}
+			if !tc.rejectsAuth {
+				doer = acceptAllDoer{}
+			}
+
+			request, err := http.NewRequest(http.MethodPost, "http://localhost:1323/bookings", strings.NewReader("{}"))
+			util.PanicIf(err)
+			request.Header.Set(api.HeaderXAPIKey, "key")
+
+			err = singleAssertionError(t, assertUnauthenticatedRejected{request, doer})
+			if !errAsExpected(err, tc.expectError) {
+				t.Errorf("expected error: %t, got %s", tc.expectError, err)
+			}
+
+			if d, ok := doer.(*authDoer); ok && tc.clientErr == nil {
+				if d.lastRequest.Header.Get(api.HeaderXAPIKey) != "" {
+					t.Error("request should be sent without API key")
+				}
+
+				if request.Header.Get(api.HeaderXAPIKey) != "key" {
+					t.Error("original request should not be modified")
+				}
+			}
+		})
+	}
+}
+
+type acceptAllDoer struct{}
+
+func (acceptAllDoer) Do(req *http.Request) (*http.Response, error) {
+	return mockStatusResponse(http.StatusOK), nil
+}
+
+// signatureDoer returns 401 if the idToken of the booking event is not
+// signed with secret, 200 otherwise. Expiry is not checked.
+type signatureDoer struct {
+	secret []byte
+}
+
+func (d signatureDoer) Do(req *http.Request) (*http.Response, error) {
+	var event struct {
+		IDToken string `json:"idToken"`
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(&event); err != nil {
+		return mockStatusResponse(http.StatusBadRequest), nil
+	}
+
+	parts := strings.Split(event.IDToken, ".")
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+
+	if base64.RawURLEncoding.EncodeToString(mac.Sum(nil)) != parts[2] {
+		return mockStatusResponse(http.StatusUnauthorized), nil
+	}
+
+	return mockStatusResponse(http.StatusOK), nil
+}
+
+// audienceDoer returns 401 if the idToken of the booking event does not have
+// audience `audience`, and forwards the request to `next` otherwise.
+type audienceDoer struct {
+	audience string
+	next     httpDoer
+}
+
+func (d audienceDoer) Do(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	util.PanicIf(err)
+
+	var event struct {
+		IDToken string `json:"idToken"`
+	}
+
+	if err := json.Unmarshal(body, &event); err != nil {
+		return mockStatusResponse(http.StatusBadRequest), nil
+	}
+
+	var claims struct {
+		Aud string `json:"aud"`
+	}
+
+	parts := strings.Split(event.IDToken, ".")
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+
+	if json.Unmarshal(payload, &claims) != nil || claims.Aud != d.audience {
+		return mockStatusResponse(http.StatusUnauthorized), nil
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	return d.next.Do(req)
+}
+
+func TestInvalidIDTokenRejected(t *testing.T) {
+	const (
+		secret   = "secret"
+		audience = "served.example.com"
+	)
+
+	testCases := []struct {
+		name            string
+		doer            httpDoer
+		idTokenSecret   string
+		idTokenAudience string
+		expectError     bool
+	}{
+		{"server verifying signature", signatureDoer{[]byte(secret)}, "", "", false},
+		{"server not checking expiry", signatureDoer{[]byte(secret)}, secret, "", true},
+		{"server accepting any idToken", acceptAllDoer{}, "", "", true},
+		{"server verifying audience and signature", audienceDoer{audience, signatureDoer{[]byte(secret)}}, "", audience, false},
+		{"server verifying audience only", audienceDoer{audience, acceptAllDoer{}}, "", audience, true},
+		{"server verifying audience, not expiry", audienceDoer{audience, signatureDoer{[]byte(secret)}}, secret, audience, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := `{"id": "a1b2", "idToken": "token", "data": {"driver": {"operator": "carpool.example.com"}}}`
+
+			request, err := http.NewRequest(http.MethodPost, "http://localhost:1323/booking_events", strings.NewReader(body))
+			util.PanicIf(err)
+
+			err = singleAssertionError(t,
+				assertInvalidIDTokenRejected{request, tc.doer, tc.idTokenSecret, tc.idTokenAudience})
+			if !errAsExpected(err, tc.expectError) {
+				t.Errorf("expected error: %t, got %s", tc.expectError, err)
+			}
+		})
+	}
+}
+
+func TestBookingEventAssertions(t *testing.T) {
+	const (
+		waiting   = api.BookingStatusWAITINGCONFIRMATION
+		confirmed = api.BookingStatusCONFIRMED
+		validated = api.BookingStatusVALIDATED
+	)
+
+	testCases := []struct {
+		name        string
+		status      api.BookingStatus
+		previous    api.BookingStatus
+		known       bool
+		expectError bool
+	}{
+		{"new booking", waiting, "", false, false},
+		{"unknown booking", confirmed, "", false, true},
+		{"known booking without previous event", validated, "", true, false},
+		{"legal transition", confirmed, waiting, true, false},
+		{"same status", confirmed, confirmed, true, false},
+		{"illegal transition", waiting, confirmed, true, true},
+		{"invalid status", "UNKNOWN", waiting, true, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"id": %q, "idToken": "token", "data": {"id": %q, "status": %q}}`,
+				uuid.New(), uuid.New(), tc.status)
+
+			request, err := http.NewRequest(http.MethodPost, "http://localhost:1323/booking_events", strings.NewReader(body))
+			util.PanicIf(err)
+
+			a := NewAccumulator()
+			BookingEventKnownBooking(a, request, tc.known)
+			BookingEventStatus(a, request, tc.previous)
+			a.ExecuteAll()
+
+			var failed bool
+			for _, result := range a.GetAssertionResults() {
+				failed = failed || result.Unwrap() != nil
+			}
+
+			if failed != tc.expectError {
+				t.Errorf("expected error: %t, got %v", tc.expectError, a.GetAssertionResults())
+			}
+		})
+	}
+}
+
+// bookingsDoer serves bookings in memory, with GET, POST and PATCH
+// /bookings. Illegal status transitions are rejected with code `rejectCode`,
+// or accepted if it is 0.
+type bookingsDoer struct {
+	rejectCode int
+	bookings   map[string]*api.Booking
+	// patches are the statuses requested with PATCH /bookings, by booking ID
+	patches map[string][]api.BookingStatus
+}
+
+func newBookingsDoer(rejectCode int, bookingID string, status api.BookingStatus) *bookingsDoer {
+	booking := &api.Booking{Id: uuid.MustParse(bookingID), Status: status}
+
+	return &bookingsDoer{
+		rejectCode: rejectCode,
+		bookings:   map[string]*api.Booking{bookingID: booking},
+		patches:    map[string][]api.BookingStatus{},
+	}
+}
+
+func (d *bookingsDoer) Do(req *http.Request) (*http.Response, error) {
+	id := path.Base(req.URL.Path)
+
+	switch req.Method {
+	case http.MethodGet:
+		booking, ok := d.bookings[id]
+		if !ok {
+			return mockStatusResponse(http.StatusNotFound), nil
+		}
+
+		return mockBodyResponse(booking), nil
+
+	case http.MethodPost:
+		var booking api.Booking
+		if err := json.NewDecoder(req.Body).Decode(&booking); err != nil {
+			return mockStatusResponse(http.StatusBadRequest), nil
+		}
+
+		d.bookings[booking.Id.String()] = &booking
+
+		return mockStatusResponse(http.StatusCreated), nil
+
+	case http.MethodPatch:
+		booking, ok := d.bookings[id]
+		if !ok {
+			return mockStatusResponse(http.StatusNotFound), nil
+		}
+
+		next := api.BookingStatus(req.URL.Query().Get("status"))
+		d.patches[id] = append(d.patches[id], next)
+
+		if d.rejectCode != 0 && !booking.Status.CanTransitionTo(next) {
+			return mockStatusResponse(d.rejectCode), nil
+		}
+
+		booking.Status = next
+
+		return mockStatusResponse(http.StatusOK), nil
+	}
+
+	return mockStatusResponse(http.StatusMethodNotAllowed), nil
+}
+
+// probePatches returns the statuses requested with PATCH /bookings on the
+// copy of the tested booking
+func (d *bookingsDoer) probePatches(testedID string) []api.BookingStatus {
+	for id, patches := range d.patches {
+		if id != testedID {
+			return patches
+		}
+	}
+
+	return nil
+}
+
+func TestIllegalTransitionsRejected(t *testing.T) {
+	const bookingID = "00000000-0000-0000-0000-00000000a1b2"
+
+	testCases := []struct {
+		name         string
+		status       api.BookingStatus
+		responseCode int
+		doer         httpDoer
+		expectError  bool
+	}{
+		{"server enforcing transitions", api.BookingStatusCONFIRMED, http.StatusOK,
+			newBookingsDoer(http.StatusConflict, bookingID, api.BookingStatusCONFIRMED), false},
+		{"server accepting any transition", api.BookingStatusCONFIRMED, http.StatusOK,
+			newBookingsDoer(0, bookingID, api.BookingStatusCONFIRMED), true},
+		{"final status", api.BookingStatusCANCELLED, http.StatusOK,
+			newBookingsDoer(http.StatusConflict, bookingID, api.BookingStatusCANCELLED), false},
+		{"failed status change is not probed", api.BookingStatusCONFIRMED, http.StatusConflict,
+			acceptAllDoer{}, false},
+		{"invalid status", "INVALID", http.StatusOK,
+			newBookingsDoer(http.StatusConflict, bookingID, api.BookingStatusCONFIRMED), true},
+		{"server rejecting with another code", api.BookingStatusCONFIRMED, http.StatusOK,
+			newBookingsDoer(http.StatusBadRequest, bookingID, api.BookingStatusCONFIRMED), true},
+		{"booking cannot be copied", api.BookingStatusCONFIRMED, http.StatusOK,
+			newBookingsDoer(http.StatusConflict, "00000000-0000-0000-0000-0000000000ff", api.BookingStatusCONFIRMED), true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url := "http://localhost:1323/bookings/" + bookingID + "?status=" + string(tc.status)
+
+			request, err := http.NewRequest(http.MethodPatch, url, nil)
+			util.PanicIf(err)
+
+			assertion := assertIllegalTransitionsRejected{request, mockStatusResponse(tc.responseCode), tc.doer}
+
+			err = singleAssertionError(t, assertion)
+			if !errAsExpected(err, tc.expectError) {
+				t.Errorf("expected error: %t, got %s", tc.expectError, err)
+			}
+
+			if d, ok := tc.doer.(*bookingsDoer); ok && len(d.patches[bookingID]) > 0 {
+				t.Errorf("the tested booking should not be probed, got %v", d.patches[bookingID])
+			}
+		})
+	}
+}
+
+func TestIllegalTransitionsProbingStops(t *testing.T) {
+	const bookingID = "00000000-0000-0000-0000-00000000a1b2"
+
+	request, err := http.NewRequest(http.MethodPatch, "http://localhost:1323/bookings/"+bookingID+"?status=CONFIRMED", nil)
+	util.PanicIf(err)
+
+	// Once an illegal transition is accepted, the copy is no longer
+	// CONFIRMED: no other transition is probed
+	doer := newBookingsDoer(0, bookingID, api.BookingStatusCONFIRMED)
+
+	err = singleAssertionError(t, assertIllegalTransitionsRejected{request, mockStatusResponse(http.StatusOK), doer})
+	if err == nil {
+		t.Error("expected an error for the accepted transition")
+	}
+
+	// The copy is brought to CONFIRMED, then probed once
+	if patches := doer.probePatches(bookingID); len(patches) != 2 {
+		t.Errorf("expected a single probe, got %v", patches)
+	}
+
+	if status := doer.bookings[bookingID].Status; status != api.BookingStatusCONFIRMED {
+		t.Errorf("the tested booking should be unchanged, got status %s", status)
+	}
+
+	// Rejected transitions leave the copy unchanged: all are probed
+	doer = newBookingsDoer(http.StatusBadRequest, bookingID, api.BookingStatusCONFIRMED)
+
+	_ = singleAssertionError(t, assertIllegalTransitionsRejected{request, mockStatusResponse(http.StatusOK), doer})
+
+	if patches := doer.probePatches(bookingID); len(patches) < 3 {
+		t.Errorf("expected all illegal transitions to be probed, got %v", patches)
+	}
+}
+
+func TestTransitionsTo(t *testing.T) {
+	testCases := []struct {
+		status   api.BookingStatus
+		expected []api.BookingStatus
+	}{
+		{api.BookingStatusWAITINGCONFIRMATION, []api.BookingStatus{}},
+		{api.BookingStatusCONFIRMED, []api.BookingStatus{api.BookingStatusCONFIRMED}},
+		{api.BookingStatusVALIDATED, []api.BookingStatus{
+			api.BookingStatusCONFIRMED,
+			api.BookingStatusCOMPLETEDPENDINGVALIDATION,
+			api.BookingStatusVALIDATED,
+		}},
+		{api.BookingStatusCANCELLED, []api.BookingStatus{api.BookingStatusCANCELLED}},
+	}
+
+	for _, tc := range testCases {
+		if got := transitionsTo(tc.status); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.status, tc.expected, got)
+		}
+	}
+}
+
+func TestBookingAssertions(t *testing.T) {
+	const (
+		paying = `"price": {"type": "PAYING", "amount": 5}`
+		users  = `"driver": {"id": "1", "alias": "d", "operator": "operator.com"},
+			"passenger": {"id": "2", "alias": "p", "operator": "operator.com"}`
+	)
+
+	testCases := []struct {
+		name        string
+		assertion   func(*http.Response) Assertion
+		body        string
+		statusCode  int
+		expectError bool
+	}{
+		{"paying booking", bookingPaying, `{` + paying + `}`, http.StatusOK, false},
+		{"free booking", bookingPaying, `{"price": {"type": "FREE"}}`, http.StatusOK, true},
+		{"booking without price type", bookingPaying, `{"price": {}}`, http.StatusOK, true},
+		{"failed request is not checked", bookingPaying, `{"error": "not found"}`, http.StatusNotFound, false},
+		{"price with amount", bookingPriceAmount, `{` + paying + `}`, http.StatusOK, false},
+		{"paying price without amount", bookingPriceAmount, `{"price": {"type": "PAYING"}}`, http.StatusOK, true},
+		{"free price without amount", bookingPriceAmount, `{"price": {"type": "FREE"}}`, http.StatusOK, false},
+		{"webUrl", bookingWebURL, `{"webUrl": "https://operator.com/b/1"}`, http.StatusOK, false},
+		{"missing webUrl", bookingWebURL, `{}`, http.StatusOK, true},
+		{"empty webUrl", bookingWebURL, `{"webUrl": ""}`, http.StatusOK, true},
+		{"relative webUrl", bookingWebURL, `{"webUrl": "/b/1"}`, http.StatusOK, true},
+		{"valid operators", bookingOperators, `{` + users + `}`, http.StatusOK, false},
+		{"missing passenger", bookingOperators,
+			`{"driver": {"id": "1", "alias": "d", "operator": "operator.com"}}`, http.StatusOK, false},
+		{"invalid driver operator", bookingOperators,
+			`{"driver": {"id": "1", "alias": "d", "operator": "https://operator.com"}}`, http.StatusOK, true},
+		{"invalid response", bookingOperators, `[]`, http.StatusOK, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			response := mockResponse(tc.statusCode, tc.body, nil)
+
+			err := singleAssertionError(t, tc.assertion(response))
+			if !errAsExpected(err, tc.expectError) {
+				t.Errorf("expected error: %t, got %s", tc.expectError, err)
+			}
+		})
+	}
+}
+
+func bookingPaying(response *http.Response) Assertion {
+	return assertBookingPaying{response}
+}
+
+func bookingPriceAmount(response *http.Response) Assertion {
+	return assertBookingPriceAmount{response}
+}
+
+func bookingWebURL(response *http.Response) Assertion {
+	return assertBookingWebURL{response, nil}
+}
+
+func bookingOperators(response *http.Response) Assertion {
+	return assertBookingOperatorsFormat{response}
+}
+
+func TestBookingEchoed(t *testing.T) {
+	submitted := `{"id": "a1b2", "status": "WAITING_CONFIRMATION", "price": {"type": "PAYING", "amount": 5}}`
+
+	testCases := []struct {
+		name        string
+		returned    string
+		statusCode  int
+		expectError bool
+	}{
+		{"same booking", submitted, http.StatusCreated, false},
+		{"additional properties",
+			`{"id": "a1b2", "status": "WAITING_CONFIRMATION", "price": {"type": "PAYING", "amount": 5}, "car": {}}`,
+			http.StatusCreated, false},
+		{"missing property", `{"id": "a1b2", "status": "WAITING_CONFIRMATION"}`, http.StatusCreated, true},
+		{"different value",
+			`{"id": "a1b2", "status": "WAITING_CONFIRMATION", "price": {"type": "PAYING", "amount": 6}}`,
+			http.StatusCreated, true},
+		{"failed request is not checked", `{"error": "conflict"}`, http.StatusConflict, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodPost, localServer+"/bookings",
+				strings.NewReader(submitted))
+			util.PanicIf(err)
+
+			response := mockResponse(tc.statusCode, tc.returned, nil)
+
+			err = singleAssertionError(t, assertBookingEchoed{request, response})
+			if !errAsExpected(err, tc.expectError) {
+				t.Errorf("expected error: %t, got %s", tc.expectError, err)
+			}
+		})
+	}
+}
+
+func TestAssertDeepLinks(t *testing.T) {
+	testCases := []struct {
+		name         string
+		webURLs      []string
+		allowedHosts []string
+		expectError  bool
+	}{
+		{"no journey", []string{}, nil, false},
+		{"https webUrls", []string{"https://operator.com/j/1", "https://www.operator.com/j/2"}, nil, false},
+		{"missing webUrl", []string{"https://operator.com/j/1", ""}, nil, true},
+		{"http webUrl", []string{"http://operator.com/j/1"}, nil, true},
+		{"relative webUrl", []string{"/j/1"}, nil, true},
+		{"invalid webUrl", []string{"https://operator.com/%zz"}, nil, true},
+		{"allowed host", []string{"https://operator.com/j/1"}, []string{"other.com", "Operator.com"}, false},
+		{"host not allowed", []string{"https://operator.com.evil.com/j/1"}, []string{"operator.com"}, true},
+		{"port of allowed host", []string{"https://operator.com:8443/j/1"}, []string{"operator.com"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			responseData := make([]map[string]string, 0, len(tc.webURLs))
+
+			for _, webURL := range tc.webURLs {
+				obj := map[string]string{"operator": "operator.com"}
+				if webURL != "" {
+					obj["webUrl"] = webURL
+				}
+
+				responseData = append(responseData, obj)
+			}
+
+			response := mockBodyResponse(responseData)
+
+			err := singleAssertionError(t, assertDeepLinks{response, tc.allowedHosts})
+			if !errAsExpected(err, tc.expectError) {
+				t.Errorf("expected error: %t, got %s", tc.expectError, err)
+			}
+		})
+	}
+}
+
+func TestAssertRegularTrips(t *testing.T) {
+	var (
+		weekdays  = []string{"MON", "TUE"}
+		timeDelta = 600
+		minDate   = 1000
+		maxDate   = 2000
+	)
+
+	params := &api.GetDriverRegularTripsParams{
+		DepartureTimeOfDay: "08:00:00",
+		DepartureWeekdays:  &weekdays,
+		TimeDelta:          &timeDelta,
+		MinDepartureDate:   &minDate,
+		MaxDepartureDate:   &maxDate,
+	}
+
+	request, err := api.NewGetDriverRegularTripsRequest(localServer, params)
+	util.PanicIf(err)
+
+	schedule := func(day, timeOfDay string, dates ...int64) api.Schedule {
+		sch := api.Schedule{}
+
+		if day != "" {
+			pickupDay := api.SchedulePassengerPickupDay(day)
+			sch.PassengerPickupDay = &pickupDay
+		}
+
+		if timeOfDay != "" {
+			sch.PassengerPickupTimeOfDay = &timeOfDay
+		}
+
+		if dates != nil {
+			journeySchedules := []api.JourneySchedule{}
+			for _, date := range dates {
+				journeySchedules = append(journeySchedules, api.JourneySchedule{PassengerPickupDate: date})
+			}
+
+			sch.JourneySchedules = &journeySchedules
+		}
+
+		return sch
+	}
+
+	testCases := []struct {
+		name        string
+		schedules   [][]api.Schedule
+		expectError bool
+		// failedConstraints are named in the error message
+		failedConstraints []string
+	}{
+		{"no regular trip", [][]api.Schedule{}, false, nil},
+		{"complying schedule", [][]api.Schedule{
+			{schedule("SUN", "08:00:00"), schedule("TUE", "08:00:00", 1500)},
+			{schedule("MON", "08:10:00", 500, 1500)},
+			{schedule("MON", "07:50:00")},
+		}, false, nil},
+		{"other weekday", [][]api.Schedule{{schedule("WED", "08:00:00")}}, true, nil},
+		{"no schedule", [][]api.Schedule{{}}, true, nil},
+		{"out of timeDelta", [][]api.Schedule{{schedule("MON", "08:10:01")}}, true, nil},
+		{"missing weekday", [][]api.Schedule{{schedule("", "08:00:00")}}, true, nil},
+		{"missing time of day", [][]api.Schedule{{schedule("MON", "")}}, true, nil},
+		{"invalid time of day", [][]api.Schedule{{schedule("MON", "8h")}}, true, nil},
+		{"journeys out of period", [][]api.Schedule{{schedule("MON", "08:00:00", 500, 2500)}}, true, nil},
+		{"each constraint met by a different schedule", [][]api.Schedule{
+			{schedule("MON", "20:00:00"), schedule("SUN", "08:00:00")},
+		}, true, []string{"departureTimeOfDay", "departureWeekdays"}},
+		{"time of day and period met by different schedules", [][]api.Schedule{
+			{schedule("MON", "08:00:00", 2500), schedule("MON", "20:00:00", 1500)},
+		}, true, []string{"minDepartureDate", "departureTimeOfDay"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			responseData := make([]map[string]interface{}, 0, len(tc.schedules))
+			for _, schedules := range tc.schedules {
+				responseData = append(responseData, map[string]interface{}{"schedules": schedules})
+			}
+
+			response := mockBodyResponse(responseData)
+
+			err := singleAssertionError(t, assertRegularTripsSchedules{request, response})
+			if !errAsExpected(err, tc.expectError) {
+				t.Errorf("expected error: %t, got %s", tc.expectError, err)
+			}
+
+			for _, constraint := range tc.failedConstraints {
+				if err == nil || !strings.Contains(err.Error(), constraint) {
+					t.Errorf("expected error naming %s, got %s", constraint, err)
+				}
+			}
+		})
+	}
+}
+
+func TestAssertRegularTripsAcrossMidnight(t *testing.T) {
+	var (
+		weekdays  = []string{"MON"}
+		timeDelta = 3600
+	)
+
+	params := &api.GetDriverRegularTripsParams{
+		DepartureTimeOfDay: "23:30:00",
+		DepartureWeekdays:  &weekdays,
+		TimeDelta:          &timeDelta,
+	}
+
+	request, err := api.NewGetDriverRegularTripsRequest(localServer, params)
+	util.PanicIf(err)
+
+	testCases := []struct {
+		timeOfDay   string
+		expectError bool
+	}{
+		{"23:00:00", false},
+		{"00:15:00", false},
+		{"00:30:00", false},
+		{"00:30:01", true},
+		{"12:00:00", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.timeOfDay, func(t *testing.T) {
+			pickupDay := api.SchedulePassengerPickupDay("MON")
+			timeOfDay := tc.timeOfDay
+			schedules := []api.Schedule{
+				{PassengerPickupDay: &pickupDay, PassengerPickupTimeOfDay: &timeOfDay},
+			}
+
+			response := mockBodyResponse([]map[string]interface{}{{"schedules": schedules}})
+
+			err := singleAssertionError(t, assertRegularTripsSchedules{request, response})
+			if !errAsExpected(err, tc.expectError) {
+				t.Errorf("expected error: %t, got %s", tc.expectError, err)
+			}
+		})
+	}
+}
+
+func TestGetQueryWeekdays(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected string
+	}{
+		{"", "MON,TUE,WED,THU,FRI,SAT,SUN"},
+		{"departureWeekdays=MON", "MON"},
+		{"departureWeekdays=MON,FRI", "MON,FRI"},
+		{"departureWeekdays=MON&departureWeekdays=FRI", "MON,FRI"},
+	}
+
+	for _, tc := range testCases {
+		request, err := http.NewRequest(http.MethodGet, localServer+"/driver_regular_trips?"+tc.query, nil)
+		util.PanicIf(err)
+
+		if got := strings.Join(getQueryWeekdays(request), ","); got != tc.expected {
+			t.Errorf("query %q: expected weekdays %s, got %s", tc.query, tc.expected, got)
+		}
+	}
+}
+
+func TestPassengerJourneysAssertions(t *testing.T) {
+	var (
+		zero     = 0
+		two      = 2
+		badGrade = 6
+	)
+
+	withPassenger := func(passenger api.User) api.PassengerJourney {
+		pj := api.NewPassengerJourney()
+		pj.Passenger = passenger
+		return pj
+	}
+
+	withSeats := func(seats *int) api.PassengerJourney {
+		pj := api.NewPassengerJourney()
+		pj.RequestedSeats = seats
+		return pj
+	}
+
+	passengerAssertion := func(response *http.Response) Assertion {
+		return assertPassengerJourneysPassenger{response}
+	}
+	seatsAssertion := func(response *http.Response) Assertion {
+		return assertPassengerJourneysRequestedSeats{response}
+	}
+	noDriverAssertion := func(response *http.Response) Assertion {
+		return assertNoDriverProperties{response}
+	}
+
+	gradedUser := api.NewUser()
+	gradedUser.Grade = &badGrade
+
+	testCases := []struct {
+		name         string
+		assertion    func(*http.Response) Assertion
+		responseData interface{}
+		expectError  bool
+	}{
+		{"valid passenger", passengerAssertion, []api.PassengerJourney{api.NewPassengerJourney()}, false},
+		{"missing passenger", passengerAssertion, []map[string]string{{"operator": "example.com"}}, true},
+		{"empty passenger", passengerAssertion, []api.PassengerJourney{withPassenger(api.User{})}, true},
+		{"wrong passenger operator", passengerAssertion,
+			[]api.PassengerJourney{withPassenger(api.User{Id: "1", Alias: "a", Operator: "https://example.com"})}, true},
+		{"wrong passenger grade", passengerAssertion, []api.PassengerJourney{withPassenger(gradedUser)}, true},
+		{"no requested seats", seatsAssertion, []api.PassengerJourney{withSeats(nil)}, false},
+		{"positive requested seats", seatsAssertion, []api.PassengerJourney{withSeats(&two)}, false},
+		{"zero requested seats", seatsAssertion, []api.PassengerJourney{withSeats(&zero)}, true},
+		{"passenger journey", noDriverAssertion, []api.PassengerJourney{api.NewPassengerJourney()}, false},
+		{"driver journey", noDriverAssertion, []api.DriverJourney{api.NewDriverJourney()}, true},
+		{"price", noDriverAssertion, []map[string]interface{}{{"price": map[string]string{"type": "FREE"}}}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			response := mockBodyResponse(tc.responseData)
+
+			err := singleAssertionError(t, tc.assertion(response))
+			if !errAsExpected(err, tc.expectError) {
+				t.Errorf("expected error: %t, got %s", tc.expectError, err)
+			}
+		})
+	}
+}
+
+func TestDriverJourneysConsistency(t *testing.T) {
+	var (
+		pickup = util.Coord{Lat: 46.1604531, Lon: -1.2219607}
+		drop   = util.Coord{Lat: 46.1779, Lon: -1.1536} // about 5.6km away
+
+		before   = int64(900)
+		after    = int64(1100)
+		negative = -1
+		positive = 100
+		short    = 4000
+		long     = 8000
+	)
+
+	makeDJ := func(update func(*api.DriverJourney)) api.DriverJourney {
+		dj := api.NewDriverJourney()
+		dj.PassengerPickupLat, dj.PassengerPickupLng = pickup.Lat, pickup.Lon
+		dj.PassengerDropLat, dj.PassengerDropLng = drop.Lat, drop.Lon
+		dj.PassengerPickupDate = 1000
+
+		update(&dj)
+
+		return dj
+	}
+
+	// polyline of (38.5, -120.2), (40.7, -120.95), (43.252, -126.453)
+	polyline := "_p~iF~ps|U_ulLnnqC_mqNvxq`@"
+	depLat, depLng := 38.5, -120.2
+	arrLat, arrLng := 43.252, -126.453
+	farLat := 40.7
+
+	datesAssertion := func(response *http.Response) Assertion {
+		return assertDriverJourneysDates{response}
+	}
+	durationDistanceAssertion := func(response *http.Response) Assertion {
+		return assertDriverJourneysDurationDistance{response}
+	}
+	walkingAssertion := func(response *http.Response) Assertion {
+		return assertDriverJourneysWalking{response}
+	}
+	polylineAssertion := func(response *http.Response) Assertion {
+		return assertDriverJourneysPolyline{response}
+	}
+
+	testCases := []struct {
+		name        string
+		assertion   func(*http.Response) Assertion
+		update      func(*api.DriverJourney)
+		expectError bool
+	}{
+		{"driver departs before pickup", datesAssertion,
+			func(dj *api.DriverJourney) { dj.DriverDepartureDate = &before }, false},
+		{"driver departs after pickup", datesAssertion,
+			func(dj *api.DriverJourney) { dj.DriverDepartureDate = &after }, true},
+		{"plausible duration", durationDistanceAssertion,
+			func(dj *api.DriverJourney) { dj.Duration = 600 }, false},
+		{"zero duration", durationDistanceAssertion,
+			func(dj *api.DriverJourney) { dj.Duration = 0 }, true},
+		{"too short duration", durationDistanceAssertion,
+			func(dj *api.DriverJourney) { dj.Duration = 60 }, true},
+		{"plausible distance", durationDistanceAssertion,
+			func(dj *api.DriverJourney) { dj.Distance = &long }, false},
+		{"negative distance", durationDistanceAssertion,
+			func(dj *api.DriverJourney) { dj.Distance = &negative }, true},
+		{"distance shorter than as the crow flies", durationDistanceAssertion,
+			func(dj *api.DriverJourney) { dj.Distance = &short }, true},
+		{"positive walking", walkingAssertion,
+			func(dj *api.DriverJourney) { dj.DropoffToArrivalWalkingDuration = &positive }, false},
+		{"negative walking", walkingAssertion,
+			func(dj *api.DriverJourney) { dj.DepartureToPickupWalkingDistance = &negative }, true},
+		{"no polyline", polylineAssertion, func(dj *api.DriverJourney) {}, false},
+		{"polyline between departure and arrival", polylineAssertion,
+			func(dj *api.DriverJourney) {
+				dj.JourneyPolyline = &polyline
+				dj.DriverDepartureLat, dj.DriverDepartureLng = &depLat, &depLng
+				dj.DriverArrivalLat, dj.DriverArrivalLng = &arrLat, &arrLng
+			}, false},
+		{"polyline without driver coordinates", polylineAssertion,
+			func(dj *api.DriverJourney) { dj.JourneyPolyline = &polyline }, false},
+		{"polyline far from departure", polylineAssertion,
+			func(dj *api.DriverJourney) {
+				dj.JourneyPolyline = &polyline
+				dj.DriverDepartureLat, dj.DriverDepartureLng = &farLat, &depLng
+			}, true},
+		{"polyline far from arrival", polylineAssertion,
+			func(dj *api.DriverJourney) {
+				dj.JourneyPolyline = &polyline
+				dj.DriverArrivalLat, dj.DriverArrivalLng = &depLat, &depLng
+			}, true},
+		{"invalid polyline", polylineAssertion,
+			func(dj *api.DriverJourney) {
+				invalid := "_p~iF~ps|"
+				dj.JourneyPolyline = &invalid
+			}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			response := mockBodyResponse([]api.DriverJourney{makeDJ(tc.update)})
+
+			err := singleAssertionError(t, tc.assertion(response))
+			if !errAsExpected(err, tc.expectError) {
+				t.Errorf("expected error: %t, got %s", tc.expectError, err)
+			}
+		})
+	}
+}
+
+func TestDecodePolyline(t *testing.T) {
+	coords, err := decodePolyline("_p~iF~ps|U_ulLnnqC_mqNvxq`@")
+	util.PanicIf(err)
+
+	expected := []util.Coord{{Lat: 38.5, Lon: -120.2}, {Lat: 40.7, Lon: -120.95}, {Lat: 43.252, Lon: -126.453}}
+
+	if len(coords) != len(expected) {
+		t.Fatalf("expected %d coordinates, got %v", len(expected), coords)
+	}
+
+	for i := range coords {
+		if math.Abs(coords[i].Lat-expected[i].Lat) > 1e-9 || math.Abs(coords[i].Lon-expected[i].Lon) > 1e-9 {
+			t.Errorf("expected coordinate %v, got %v", expected[i], coords[i])
+		}
+	}
+}
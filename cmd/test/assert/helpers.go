@@ -1,12 +1,22 @@
 package assert
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
 	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
 )
 
@@ -72,6 +82,68 @@ func getQueryCount(req *http.Request) (int, error) {
 	return parseQueryIntParamWithDefault(req, "count", -1)
 }
 
+// getQueryWeekdays extracts departureWeekdays parameter from request, which
+// defaults to all days of week
+func getQueryWeekdays(req *http.Request) []string {
+	var weekdays []string
+
+	// departureWeekdays is not exploded, e.g. "MON,TUE"
+	for _, value := range req.URL.Query()["departureWeekdays"] {
+		for _, weekday := range strings.Split(value, ",") {
+			if weekday != "" {
+				weekdays = append(weekdays, weekday)
+			}
+		}
+	}
+
+	if len(weekdays) == 0 {
+		return []string{"MON", "TUE", "WED", "THU", "FRI", "SAT", "SUN"}
+	}
+
+	return weekdays
+}
+
+// getQueryTimeOfDay extracts departureTimeOfDay parameter from request
+func getQueryTimeOfDay(req *http.Request) (string, error) {
+	timeOfDay := req.URL.Query().Get("departureTimeOfDay")
+
+	if _, err := parseTimeOfDay(timeOfDay); err != nil {
+		return "", err
+	}
+
+	return timeOfDay, nil
+}
+
+// getQueryMinMaxDepartureDate extracts minDepartureDate and maxDepartureDate
+// parameters from request, which are nil if not set
+func getQueryMinMaxDepartureDate(req *http.Request) (min, max *int, err error) {
+	min, err = parseQueryOptionalIntParam(req, "minDepartureDate")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	max, err = parseQueryOptionalIntParam(req, "maxDepartureDate")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return min, max, nil
+}
+
+func parseQueryOptionalIntParam(request *http.Request, paramName string) (*int, error) {
+	paramStr := request.URL.Query().Get(paramName)
+	if paramStr == "" {
+		return nil, nil
+	}
+
+	param, err := auxParseInt(paramStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &param, nil
+}
+
 func parseQueryFloatParam(request *http.Request, paramName string) (float64, error) {
 	paramStr := request.URL.Query().Get(paramName)
 	return auxParseFloat(paramStr)
@@ -232,6 +304,119 @@ func getResponsePickupDate(obj json.RawMessage) (int, error) {
 	return withPickupDate.PassengerPickupDate, nil
 }
 
+// getResponseSchedules extracts the schedules of a regular trip, from a
+// json.RawMessage as returned by parseArrayResponse
+func getResponseSchedules(obj json.RawMessage) ([]api.Schedule, error) {
+	type WithSchedules struct {
+		Schedules []api.Schedule `json:"schedules"`
+	}
+
+	var withSchedules WithSchedules
+
+	err := json.Unmarshal(obj, &withSchedules)
+	if err != nil {
+		return nil, err
+	}
+
+	return withSchedules.Schedules, nil
+}
+
+// parseDriverJourneys parses the driver journeys of a response
+func parseDriverJourneys(response *http.Response) ([]api.DriverJourney, error) {
+	objs, err := parseArrayResponse(response)
+	if err != nil {
+		return nil, err
+	}
+
+	driverJourneys := make([]api.DriverJourney, 0, len(objs))
+
+	for _, obj := range objs {
+		var dj api.DriverJourney
+
+		if err := json.Unmarshal(obj, &dj); err != nil {
+			return nil, err
+		}
+
+		driverJourneys = append(driverJourneys, dj)
+	}
+
+	return driverJourneys, nil
+}
+
+// decodePolyline decodes a Google Encoded Polyline, compressed at level 5
+func decodePolyline(polyline string) ([]util.Coord, error) {
+	var (
+		coords   []util.Coord
+		lat, lng int
+		index    int
+	)
+
+	for index < len(polyline) {
+		for _, value := range []*int{&lat, &lng} {
+			var result, shift int
+
+			for {
+				if index >= len(polyline) {
+					return nil, errors.New("truncated polyline")
+				}
+
+				chunk := int(polyline[index]) - 63
+				index++
+
+				if chunk < 0 || chunk > 63 {
+					return nil, fmt.Errorf("invalid polyline character %q", polyline[index-1])
+				}
+
+				result |= (chunk & 0x1f) << shift
+				shift += 5
+
+				if chunk < 0x20 {
+					break
+				}
+			}
+
+			if result&1 != 0 {
+				*value += ^(result >> 1)
+			} else {
+				*value += result >> 1
+			}
+		}
+
+		coords = append(coords, util.Coord{Lat: float64(lat) / 1e5, Lon: float64(lng) / 1e5})
+	}
+
+	return coords, nil
+}
+
+// parseTimeOfDay parses an RFC3339 partial time, e.g. "07:30:00"
+func parseTimeOfDay(timeOfDay string) (time.Time, error) {
+	t, err := time.Parse("15:04:05", timeOfDay)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is not a valid time of day (%w)", timeOfDay, err)
+	}
+
+	return t, nil
+}
+
+// secondsBetweenTimesOfDay returns the number of seconds between two times of
+// day, modulo 24h, so that e.g. 23:30:00 and 00:15:00 are 45 minutes apart
+func secondsBetweenTimesOfDay(timeOfDay1, timeOfDay2 string) (float64, error) {
+	t1, err := parseTimeOfDay(timeOfDay1)
+	if err != nil {
+		return 0, err
+	}
+
+	t2, err := parseTimeOfDay(timeOfDay2)
+	if err != nil {
+		return 0, err
+	}
+
+	seconds := math.Abs(t1.Sub(t2).Seconds())
+	day := (24 * time.Hour).Seconds()
+
+	return math.Min(seconds, day-seconds), nil
+}
+
 func getResponseID(obj json.RawMessage) (*string, error) {
 	type WithID struct {
 		ID *string `json:"id,omitempty"`
@@ -261,3 +446,180 @@ func getResponseOperator(obj json.RawMessage) (string, error) {
 
 	return withOperator.Operator, nil
 }
+
+// getResponseWebURL extracts the webUrl of a json.RawMessage, e.g. as returned
+// by parseArrayResponse. It is empty if the object has no webUrl.
+func getResponseWebURL(obj json.RawMessage) (string, error) {
+	type WithWebURL struct {
+		WebURL string `json:"webUrl"`
+	}
+
+	var withWebURL WithWebURL
+
+	err := json.Unmarshal(obj, &withWebURL)
+	if err != nil {
+		return "", err
+	}
+
+	return withWebURL.WebURL, nil
+}
+
+// idTokenClaims returns the claims of the idToken of a booking event, if it
+// is a JWT, with `audience` as audience if not empty. If the idToken is not a
+// JWT and `audience` is empty, the operators of the booking are used as
+// audience.
+func idTokenClaims(event map[string]interface{}, audience string) map[string]interface{} {
+	claims := map[string]interface{}{}
+	isJWT := false
+
+	if token, ok := event["idToken"].(string); ok {
+		if parts := strings.Split(token, "."); len(parts) == 3 {
+			if payload, err := base64.RawURLEncoding.DecodeString(parts[1]); err == nil {
+				isJWT = json.Unmarshal(payload, &claims) == nil
+			}
+		}
+	}
+
+	if !isJWT {
+		claims = map[string]interface{}{}
+	}
+
+	switch {
+	case audience != "":
+		claims["aud"] = audience
+
+	case !isJWT:
+		operators := []string{}
+
+		data, _ := event["data"].(map[string]interface{})
+		for _, userType := range []string{"driver", "passenger"} {
+			user, _ := data[userType].(map[string]interface{})
+			if operator, ok := user["operator"].(string); ok {
+				operators = append(operators, operator)
+			}
+		}
+
+		claims["aud"] = operators
+	}
+
+	return claims
+}
+
+// forgedIDToken returns a HS256 JWT with given claims and expiry. It is
+// signed with secret, or with a random key if secret is empty.
+func forgedIDToken(claims map[string]interface{}, exp time.Time, secret []byte) (string, error) {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return "", err
+		}
+	}
+
+	forgedClaims := map[string]interface{}{}
+	for k, v := range claims {
+		forgedClaims[k] = v
+	}
+
+	forgedClaims["exp"] = exp.Unix()
+
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(forgedClaims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// isSuccessStatus checks if a status code is a success (2xx)
+// transitionsTo returns the shortest sequence of legal transitions from
+// status WAITING_CONFIRMATION to `status`
+func transitionsTo(status api.BookingStatus) []api.BookingStatus {
+	paths := map[api.BookingStatus][]api.BookingStatus{api.BookingStatusWAITINGCONFIRMATION: {}}
+	queue := []api.BookingStatus{api.BookingStatusWAITINGCONFIRMATION}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if current == status {
+			return paths[current]
+		}
+
+		for _, next := range api.BookingStatuses() {
+			if _, visited := paths[next]; visited || !current.CanTransitionTo(next) {
+				continue
+			}
+
+			paths[next] = append(append([]api.BookingStatus{}, paths[current]...), next)
+			queue = append(queue, next)
+		}
+	}
+
+	return nil
+}
+
+// parseBookingEventRequest parses the booking of a booking event request
+func parseBookingEventRequest(request *http.Request) (*api.Booking, error) {
+	if request.GetBody == nil {
+		return nil, errors.New("request body cannot be read again")
+	}
+
+	body, err := request.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var event api.CarpoolBookingEvent
+	if err := json.NewDecoder(body).Decode(&event); err != nil {
+		return nil, err
+	}
+
+	return event.Booking()
+}
+
+func isSuccessStatus(statusCode int) bool {
+	return statusCode >= 200 && statusCode < 300
+}
+
+// parseBookingResponse parses the booking of a response. ok is false if the
+// response is not successful, and has no booking.
+func parseBookingResponse(response *http.Response) (booking api.Booking, ok bool, err error) {
+	if !isSuccessStatus(response.StatusCode) {
+		return booking, false, nil
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return booking, true, failedParsing("response", err)
+	}
+
+	if err := json.Unmarshal(body, &booking); err != nil {
+		return booking, true, failedParsing("response", err)
+	}
+
+	return booking, true, nil
+}
+
+// sortedProperties returns the properties of a json object, sorted
+func sortedProperties(obj map[string]interface{}) []string {
+	properties := make([]string, 0, len(obj))
+	for property := range obj {
+		properties = append(properties, property)
+	}
+
+	sort.Strings(properties)
+
+	return properties
+}
@@ -53,6 +53,30 @@ func validateResponse(request *http.Request, response *http.Response) error {
 	return validationErr
 }
 
+// validateRequest validates a Request against the openapi specification.
+// The request body is restored after validation.
+func validateRequest(request *http.Request) error {
+	server, _, err := endpoint.FromContext(request.Context())
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	route, pathParams, err := findRoute(ctx, request, server)
+	if err != nil {
+		return err
+	}
+
+	requestValidationInput := &openapi3filter.RequestValidationInput{
+		Request:    request,
+		PathParams: pathParams,
+		Route:      route,
+	}
+
+	return openapi3filter.ValidateRequest(ctx, requestValidationInput)
+}
+
 func findRoute(ctx context.Context, request *http.Request, server endpoint.Server) (route *routers.Route, pathParams map[string]string, err error) {
 	loader := &openapi3.Loader{Context: ctx, IsExternalRefsAllowed: true}
 
@@ -3,6 +3,7 @@ package assert
 import (
 	"context"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
@@ -41,3 +42,17 @@ func TestFindRoute(t *testing.T) {
 		t.Error("Format validation with kin-openapi does not find route properly")
 	}
 }
+
+func TestValidateRequest(t *testing.T) {
+	request, err := http.NewRequest(http.MethodPost, localServer+"/booking_events",
+		strings.NewReader(`{"id": "1234"}`))
+	util.PanicIf(err)
+	request.Header.Set("Content-Type", "application/json")
+
+	request, err = endpoint.AddEndpointContext(request)
+	util.PanicIf(err)
+
+	if validateRequest(request) == nil {
+		t.Error("Format validation is expected to fail for invalid request body")
+	}
+}
@@ -475,7 +475,7 @@ go run main.go test \
   --url="$SERVER/bookings" \
   --expectResponseCode=201 \
   --auth="$API_TOKEN" \
-  <<< '{"driver":{"alias":"","id":"","operator":""},"id":"83472eda-6eb4-7590-6aee-b7f09e757ba9","passenger":{"alias":"","id":"","operator":""},"passengerDropLat":0,"passengerDropLng":0,"passengerPickupDate":0,"passengerPickupLat":0,"passengerPickupLng":0,"price":{},"status":"WAITING_CONFIRMATION"}'
+  <<< '{"driver":{"alias":"driver","id":"driver","operator":"default.operator.com"},"id":"83472eda-6eb4-7590-6aee-b7f09e757ba9","passenger":{"alias":"passenger","id":"passenger","operator":"default.operator.com"},"passengerDropLat":0,"passengerDropLng":0,"passengerPickupDate":0,"passengerPickupLat":0,"passengerPickupLng":0,"price":{"amount":5,"type":"PAYING"},"status":"WAITING_CONFIRMATION"}'
 
 echo "TestPostBookings/Posting_a_new_booking_succeeds_with_code_201"
 go run main.go test \
@@ -491,7 +491,7 @@ go run main.go test \
   --url="$SERVER/bookings" \
   --expectResponseCode=400 \
   --auth="$API_TOKEN" \
-  <<< '{"driver":{"alias":"","id":"","operator":""},"id":"590c1440-9888-b5b0-7d51-a817ee07c3f2","passenger":{"alias":"","id":"","operator":""},"passengerDropLat":0,"passengerDropLng":0,"passengerPickupDate":0,"passengerPickupLat":0,"passengerPickupLng":0,"price":{},"status":"WAITING_CONFIRMATION"}'
+  <<< '{"driver":{"alias":"driver","id":"driver","operator":"default.operator.com"},"id":"590c1440-9888-b5b0-7d51-a817ee07c3f2","passenger":{"alias":"passenger","id":"passenger","operator":"default.operator.com"},"passengerDropLat":0,"passengerDropLng":0,"passengerPickupDate":0,"passengerPickupLat":0,"passengerPickupLng":0,"price":{"amount":5,"type":"PAYING"},"status":"WAITING_CONFIRMATION"}'
 
 echo "TestPostBookings/Posting_a_booking_with_colliding_ID_fails_with_code_400"
 go run main.go test \
@@ -501,36 +501,96 @@ go run main.go test \
   --auth="$API_TOKEN" \
   --expectNonEmpty
 
-echo "TestPatchBookings/patching_VALIDATED_over_WAITING_CONFIRMATION_succeeds"
+echo "TestPatchBookings/patching_VALIDATED_over_WAITING_CONFIRMATION_fails_with_code_409"
 go run main.go test \
   --method=PATCH \
   --url="$SERVER/bookings/0ad346f9-e692-3ab1-d2f0-91785e9ca0ea?status=VALIDATED" \
-  --expectResponseCode=200 \
+  --expectResponseCode=409 \
   --auth="$API_TOKEN"
 
-echo "TestPatchBookings/patching_VALIDATED_over_WAITING_CONFIRMATION_succeeds"
+echo "TestPatchBookings/patching_VALIDATED_over_WAITING_CONFIRMATION_fails_with_code_409"
 go run main.go test \
   --method=GET \
   --url="$SERVER/bookings/0ad346f9-e692-3ab1-d2f0-91785e9ca0ea" \
   --expectResponseCode=200 \
   --auth="$API_TOKEN" \
-  --expectBookingStatus=VALIDATED
+  --expectBookingStatus=WAITING_CONFIRMATION
 
-echo "TestPatchBookings/patching_COMPLETED_PENDING_VALIDATION_over_WAITING_CONFIRMATION_succeeds"
+echo "TestPatchBookings/patching_COMPLETED_PENDING_VALIDATION_over_WAITING_CONFIRMATION_fails_with_code_409"
 go run main.go test \
   --method=PATCH \
   --url="$SERVER/bookings/68087cc0-282c-35d9-ad8b-51bf6a35a933?status=COMPLETED_PENDING_VALIDATION" \
-  --expectResponseCode=200 \
+  --expectResponseCode=409 \
   --auth="$API_TOKEN"
 
-echo "TestPatchBookings/patching_COMPLETED_PENDING_VALIDATION_over_WAITING_CONFIRMATION_succeeds"
+echo "TestPatchBookings/patching_COMPLETED_PENDING_VALIDATION_over_WAITING_CONFIRMATION_fails_with_code_409"
 go run main.go test \
   --method=GET \
   --url="$SERVER/bookings/68087cc0-282c-35d9-ad8b-51bf6a35a933" \
   --expectResponseCode=200 \
   --auth="$API_TOKEN" \
+  --expectBookingStatus=WAITING_CONFIRMATION
+
+echo "TestPatchBookings/patching_COMPLETED_PENDING_VALIDATION_over_CONFIRMED_succeeds"
+go run main.go test \
+  --method=PATCH \
+  --url="$SERVER/bookings/ab95f747-7527-0789-bccc-8d4364e82a04?status=COMPLETED_PENDING_VALIDATION" \
+  --expectResponseCode=200 \
+  --auth="$API_TOKEN"
+
+echo "TestPatchBookings/patching_COMPLETED_PENDING_VALIDATION_over_CONFIRMED_succeeds"
+go run main.go test \
+  --method=GET \
+  --url="$SERVER/bookings/ab95f747-7527-0789-bccc-8d4364e82a04" \
+  --expectResponseCode=200 \
+  --auth="$API_TOKEN" \
   --expectBookingStatus=COMPLETED_PENDING_VALIDATION
 
+echo "TestPatchBookings/patching_VALIDATED_over_COMPLETED_PENDING_VALIDATION_succeeds"
+go run main.go test \
+  --method=PATCH \
+  --url="$SERVER/bookings/014fddac-2289-853a-d8af-1e1f98a3628e?status=VALIDATED" \
+  --expectResponseCode=200 \
+  --auth="$API_TOKEN"
+
+echo "TestPatchBookings/patching_VALIDATED_over_COMPLETED_PENDING_VALIDATION_succeeds"
+go run main.go test \
+  --method=GET \
+  --url="$SERVER/bookings/014fddac-2289-853a-d8af-1e1f98a3628e" \
+  --expectResponseCode=200 \
+  --auth="$API_TOKEN" \
+  --expectBookingStatus=VALIDATED
+
+echo "TestPatchBookings/patching_CANCELLED_over_CONFIRMED_succeeds"
+go run main.go test \
+  --method=PATCH \
+  --url="$SERVER/bookings/5e84613d-a805-485a-0ba5-4f6d7c269ae7?status=CANCELLED" \
+  --expectResponseCode=200 \
+  --auth="$API_TOKEN"
+
+echo "TestPatchBookings/patching_CANCELLED_over_CONFIRMED_succeeds"
+go run main.go test \
+  --method=GET \
+  --url="$SERVER/bookings/5e84613d-a805-485a-0ba5-4f6d7c269ae7" \
+  --expectResponseCode=200 \
+  --auth="$API_TOKEN" \
+  --expectBookingStatus=CANCELLED
+
+echo "TestPatchBookings/patching_CANCELLED_over_VALIDATED_fails_with_code_409"
+go run main.go test \
+  --method=PATCH \
+  --url="$SERVER/bookings/3c0df716-757d-b849-2666-d00809c1ce11?status=CANCELLED" \
+  --expectResponseCode=409 \
+  --auth="$API_TOKEN"
+
+echo "TestPatchBookings/patching_CANCELLED_over_VALIDATED_fails_with_code_409"
+go run main.go test \
+  --method=GET \
+  --url="$SERVER/bookings/3c0df716-757d-b849-2666-d00809c1ce11" \
+  --expectResponseCode=200 \
+  --auth="$API_TOKEN" \
+  --expectBookingStatus=VALIDATED
+
 echo "TestPatchBookings/patching_a_non-existing_booking_returns_code_404"
 go run main.go test \
   --method=PATCH \
@@ -596,7 +656,7 @@ go run main.go test \
   --url="$SERVER/booking_events" \
   --expectResponseCode=200 \
   --auth="$API_TOKEN" \
-  <<< '{"data":{"id":"6fcf3150-b452-f79a-d30f-524750dbbef4","passengerDropLat":0,"passengerDropLng":0,"passengerPickupDate":0,"passengerPickupLat":0,"passengerPickupLng":0,"status":"WAITING_CONFIRMATION","webUrl":"","driver":{"alias":"","id":"","operator":""},"price":{}},"id":"91523cf5-6600-8472-204b-21603d4a076b","idToken":""}'
+  <<< '{"data":{"id":"6fcf3150-b452-f79a-d30f-524750dbbef4","passengerDropLat":0,"passengerDropLng":0,"passengerPickupDate":0,"passengerPickupLat":0,"passengerPickupLng":0,"status":"WAITING_CONFIRMATION","webUrl":"","driver":{"alias":"driver","id":"driver","operator":"default.operator.com"},"price":{"amount":5,"type":"PAYING"}},"id":"91523cf5-6600-8472-204b-21603d4a076b","idToken":""}'
 
 echo "TestPostBookingEvents/posting_a_new_bookingEvent_with_status_WAITING_CONFIRMATION_succeeds"
 go run main.go test \
@@ -612,7 +672,7 @@ go run main.go test \
   --url="$SERVER/booking_events" \
   --expectResponseCode=200 \
   --auth="$API_TOKEN" \
-  <<< '{"data":{"id":"cc8c67ad-62d4-b3b1-ee30-02a37a51035f","passengerDropLat":0,"passengerDropLng":0,"passengerPickupDate":0,"passengerPickupLat":0,"passengerPickupLng":0,"status":"CONFIRMED","webUrl":"","driver":{"alias":"","id":"","operator":""},"price":{}},"id":"22128d01-f093-3aca-4106-05310cdc3bb8","idToken":""}'
+  <<< '{"data":{"id":"cc8c67ad-62d4-b3b1-ee30-02a37a51035f","passengerDropLat":0,"passengerDropLng":0,"passengerPickupDate":0,"passengerPickupLat":0,"passengerPickupLng":0,"status":"CONFIRMED","webUrl":"","driver":{"alias":"driver","id":"driver","operator":"default.operator.com"},"price":{"amount":5,"type":"PAYING"}},"id":"22128d01-f093-3aca-4106-05310cdc3bb8","idToken":""}'
 
 echo "TestPostBookingEvents/posting_a_bookingEvent_on_existing_booking_(status_CONFIRMED_over_WAITING_CONFIRMATION)_changes_its_status"
 go run main.go test \
@@ -622,15 +682,15 @@ go run main.go test \
   --auth="$API_TOKEN" \
   --expectBookingStatus=CONFIRMED
 
-echo "TestPostBookingEvents/posting_a_bookingEvent_on_existing_booking_(status_CONFIRMED_over_CONFIRMED)_fails_with_code_400"
+echo "TestPostBookingEvents/posting_a_bookingEvent_on_existing_booking_(status_CONFIRMED_over_CONFIRMED)_fails_with_code_409"
 go run main.go test \
   --method=POST \
   --url="$SERVER/booking_events" \
-  --expectResponseCode=400 \
+  --expectResponseCode=409 \
   --auth="$API_TOKEN" \
-  <<< '{"data":{"id":"ffda9299-b1d9-fafa-3d47-844c536f73c2","passengerDropLat":0,"passengerDropLng":0,"passengerPickupDate":0,"passengerPickupLat":0,"passengerPickupLng":0,"status":"CONFIRMED","webUrl":"","driver":{"alias":"","id":"","operator":""},"price":{}},"id":"d50fb8fd-a25c-8f1b-114a-976408f9a71b","idToken":""}'
+  <<< '{"data":{"id":"ffda9299-b1d9-fafa-3d47-844c536f73c2","passengerDropLat":0,"passengerDropLng":0,"passengerPickupDate":0,"passengerPickupLat":0,"passengerPickupLng":0,"status":"CONFIRMED","webUrl":"","driver":{"alias":"driver","id":"driver","operator":"default.operator.com"},"price":{"amount":5,"type":"PAYING"}},"id":"d50fb8fd-a25c-8f1b-114a-976408f9a71b","idToken":""}'
 
-echo "TestPostBookingEvents/posting_a_bookingEvent_on_existing_booking_(status_CONFIRMED_over_CONFIRMED)_fails_with_code_400"
+echo "TestPostBookingEvents/posting_a_bookingEvent_on_existing_booking_(status_CONFIRMED_over_CONFIRMED)_fails_with_code_409"
 go run main.go test \
   --method=GET \
   --url="$SERVER/bookings/ffda9299-b1d9-fafa-3d47-844c536f73c2" \
@@ -638,15 +698,15 @@ go run main.go test \
   --auth="$API_TOKEN" \
   --expectBookingStatus=CONFIRMED
 
-echo "TestPostBookingEvents/posting_a_bookingEvent_on_existing_booking_(status_CONFIRMED_over_CANCELLED)_fails_with_code_400"
+echo "TestPostBookingEvents/posting_a_bookingEvent_on_existing_booking_(status_CONFIRMED_over_CANCELLED)_fails_with_code_409"
 go run main.go test \
   --method=POST \
   --url="$SERVER/booking_events" \
-  --expectResponseCode=400 \
+  --expectResponseCode=409 \
   --auth="$API_TOKEN" \
-  <<< '{"data":{"id":"b2892d57-f402-cd4a-2c11-08cc823ae0c5","passengerDropLat":0,"passengerDropLng":0,"passengerPickupDate":0,"passengerPickupLat":0,"passengerPickupLng":0,"status":"CONFIRMED","webUrl":"","driver":{"alias":"","id":"","operator":""},"price":{}},"id":"90cec22a-723f-cc72-5fb2-462733c2880f","idToken":""}'
+  <<< '{"data":{"id":"b2892d57-f402-cd4a-2c11-08cc823ae0c5","passengerDropLat":0,"passengerDropLng":0,"passengerPickupDate":0,"passengerPickupLat":0,"passengerPickupLng":0,"status":"CONFIRMED","webUrl":"","driver":{"alias":"driver","id":"driver","operator":"default.operator.com"},"price":{"amount":5,"type":"PAYING"}},"id":"90cec22a-723f-cc72-5fb2-462733c2880f","idToken":""}'
 
-echo "TestPostBookingEvents/posting_a_bookingEvent_on_existing_booking_(status_CONFIRMED_over_CANCELLED)_fails_with_code_400"
+echo "TestPostBookingEvents/posting_a_bookingEvent_on_existing_booking_(status_CONFIRMED_over_CANCELLED)_fails_with_code_409"
 go run main.go test \
   --method=GET \
   --url="$SERVER/bookings/b2892d57-f402-cd4a-2c11-08cc823ae0c5" \
@@ -654,6 +714,22 @@ go run main.go test \
   --auth="$API_TOKEN" \
   --expectBookingStatus=CANCELLED
 
+echo "TestPostBookingEvents/posting_a_bookingEvent_on_existing_booking_(status_VALIDATED_over_WAITING_CONFIRMATION)_fails_with_code_409"
+go run main.go test \
+  --method=POST \
+  --url="$SERVER/booking_events" \
+  --expectResponseCode=409 \
+  --auth="$API_TOKEN" \
+  <<< '{"data":{"id":"655bd814-308d-949b-5957-26750f55bc28","passengerDropLat":0,"passengerDropLng":0,"passengerPickupDate":0,"passengerPickupLat":0,"passengerPickupLng":0,"status":"VALIDATED","webUrl":"","driver":{"alias":"driver","id":"driver","operator":"default.operator.com"},"price":{"amount":5,"type":"PAYING"}},"id":"c3181ec6-ed0a-07ab-6cb8-9990a3ecf492","idToken":""}'
+
+echo "TestPostBookingEvents/posting_a_bookingEvent_on_existing_booking_(status_VALIDATED_over_WAITING_CONFIRMATION)_fails_with_code_409"
+go run main.go test \
+  --method=GET \
+  --url="$SERVER/bookings/655bd814-308d-949b-5957-26750f55bc28" \
+  --expectResponseCode=200 \
+  --auth="$API_TOKEN" \
+  --expectBookingStatus=WAITING_CONFIRMATION
+
 echo "TestPostMessage/Posting_message_with_both_user_known_succeeds_with_code_201"
 go run main.go test \
   --method=POST \
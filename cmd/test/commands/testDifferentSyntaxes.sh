@@ -42,14 +42,24 @@ go run main.go test post bookings \
   <<< '{
   "driver": {
     "alias": "abc87",
-    "id": "12345"
+    "id": "12345",
+    "operator": "carpool.mycity.com"
   },
   "id": "123e4567-e89b-12d3-a456-426614174000",
   "passenger": {
     "alias": "cde69",
-    "id": "67890"
+    "id": "67890",
+    "operator": "carpool.mycity.com"
   },
+  "passengerPickupDate": 1665579951,
+  "passengerPickupLat": 45.7597,
+  "passengerPickupLng": 4.8422,
   "passengerDropLat": 45.8275,
   "passengerDropLng":  1.25987,
+  "price": {
+    "type": "PAYING",
+    "amount": 4.5,
+    "currency": "EUR"
+  },
   "status": "WAITING_CONFIRMATION"
 }'
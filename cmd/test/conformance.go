@@ -0,0 +1,165 @@
+package test
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/endpoint"
+)
+
+// Level is the level of requirement of a test step, as in RFC 2119
+type Level string
+
+// Available levels
+const (
+	LevelMust   Level = "MUST"
+	LevelShould Level = "SHOULD"
+)
+
+func (l Level) isValid() bool {
+	return l == LevelMust || l == LevelShould
+}
+
+//go:embed conformance.yaml
+var conformanceBattery []byte
+
+// ConformanceSuite returns the built-in battery of requests used to check
+// the conformance of an API to the standard.
+func ConformanceSuite() (*Suite, error) {
+	return ReadSuite(bytes.NewReader(conformanceBattery))
+}
+
+// RunConformance runs the conformance battery, and prints its report
+// followed by a per-endpoint compliance matrix. It returns an error if any
+// MUST requirement is not met.
+func RunConformance(suite *Suite, verbose bool, format ReportFormat) error {
+	suiteReport, err := runSuite(suite, verbose, true)
+	if err != nil {
+		return err
+	}
+
+	if err := suiteReport.write(os.Stdout, format); err != nil {
+		return err
+	}
+
+	matrix := newComplianceMatrix(suiteReport)
+
+	if format == ReportText {
+		if err := matrix.write(os.Stdout); err != nil {
+			return err
+		}
+	}
+
+	if failed := matrix.failedSteps(LevelMust); failed > 0 {
+		return fmt.Errorf("❌ not compliant: %d MUST requirement(s) failed", failed)
+	}
+
+	return nil
+}
+
+// complianceMatrix counts the passed and total steps, per endpoint and
+// level.
+type complianceMatrix struct {
+	counts map[endpoint.Info]map[Level]*complianceCount
+}
+
+type complianceCount struct {
+	passed int
+	total  int
+}
+
+func newComplianceMatrix(sr *SuiteReport) complianceMatrix {
+	m := complianceMatrix{map[endpoint.Info]map[Level]*complianceCount{}}
+
+	for _, step := range sr.steps {
+		e := step.report.endpoint
+
+		if m.counts[e] == nil {
+			m.counts[e] = map[Level]*complianceCount{}
+		}
+
+		count := m.counts[e][step.level]
+		if count == nil {
+			count = &complianceCount{}
+			m.counts[e][step.level] = count
+		}
+
+		count.total++
+
+		if !step.report.hasErrors() {
+			count.passed++
+		}
+	}
+
+	return m
+}
+
+// failedSteps counts the failed steps of a given level, all endpoints
+// included
+func (m complianceMatrix) failedSteps(level Level) int {
+	failed := 0
+
+	for _, counts := range m.counts {
+		if count, ok := counts[level]; ok {
+			failed += count.total - count.passed
+		}
+	}
+
+	return failed
+}
+
+func (m complianceMatrix) write(w io.Writer) error {
+	levels := []Level{LevelMust, LevelShould}
+
+	str := "Compliance matrix\n\n"
+	str += fmt.Sprintf("%-35s", "Endpoint")
+
+	for _, level := range levels {
+		str += fmt.Sprintf(" %-12s", level)
+	}
+
+	str += "\n"
+
+	for _, e := range endpoint.All() {
+		str += fmt.Sprintf("%-35s", e)
+
+		for _, level := range levels {
+			str += fmt.Sprintf(" %-12s", m.cell(e, level))
+		}
+
+		str += "\n"
+	}
+
+	str += "\n"
+
+	for _, level := range levels {
+		if failed := m.failedSteps(level); failed > 0 {
+			str += stringError(fmt.Sprintf("%s requirements: %d failed", level, failed))
+		} else {
+			str += stringOK(fmt.Sprintf("%s requirements: all passed", level))
+		}
+	}
+
+	_, err := fmt.Fprintln(w, str)
+
+	return err
+}
+
+// cell returns the content of the matrix for an endpoint and a level, e.g.
+// "✅ 2/2", "❌ 1/2" or "-" if not covered.
+func (m complianceMatrix) cell(e endpoint.Info, level Level) string {
+	count, ok := m.counts[e][level]
+	if !ok {
+		return "-"
+	}
+
+	symbol := "✅"
+	if count.passed < count.total {
+		symbol = "❌"
+	}
+
+	return fmt.Sprintf("%s %d/%d", symbol, count.passed, count.total)
+}
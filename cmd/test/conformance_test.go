@@ -0,0 +1,100 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/endpoint"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/test/assert"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
+)
+
+func TestConformanceSuite(t *testing.T) {
+	suite, err := ConformanceSuite()
+	util.PanicIf(err)
+
+	covered := map[string]bool{}
+
+	for _, step := range suite.Steps {
+		if step.Level != "" && !step.Level.isValid() {
+			t.Errorf("step %s has invalid level %s", step.Name, step.Level)
+		}
+
+		req, err := step.makeRequest(&Suite{Server: localServer}, newVariables(suite.Variables))
+		if err != nil {
+			t.Fatalf("step %s: %s", step.Name, err)
+		}
+
+		_, e, err := endpoint.FromContext(req.Context())
+		util.PanicIf(err)
+
+		covered[e.String()] = true
+	}
+
+	for _, e := range endpoint.All() {
+		if !covered[e.String()] {
+			t.Errorf("endpoint %s is not covered by the conformance battery", e)
+		}
+	}
+}
+
+func TestComplianceMatrix(t *testing.T) {
+	makeStepReport := func(e endpoint.Info, level Level, err error) stepReport {
+		report := NewReport(request, assert.NewAssertionResult(err, ""))
+		report.endpoint = e
+
+		return stepReport{level: level, report: &report}
+	}
+
+	sr := &SuiteReport{steps: []stepReport{
+		makeStepReport(endpoint.GetStatus, LevelMust, nil),
+		makeStepReport(endpoint.GetBookings, LevelMust, nil),
+		makeStepReport(endpoint.GetBookings, LevelMust, errors.New("")),
+		makeStepReport(endpoint.GetBookings, LevelShould, errors.New("")),
+	}}
+
+	m := newComplianceMatrix(sr)
+
+	if m.failedSteps(LevelMust) != 1 || m.failedSteps(LevelShould) != 1 {
+		t.Errorf("wrong number of failed steps")
+	}
+
+	testCases := []struct {
+		endpoint endpoint.Info
+		level    Level
+		expected string
+	}{
+		{endpoint.GetStatus, LevelMust, "✅ 1/1"},
+		{endpoint.GetStatus, LevelShould, "-"},
+		{endpoint.GetBookings, LevelMust, "❌ 1/2"},
+		{endpoint.GetBookings, LevelShould, "❌ 0/1"},
+		{endpoint.PostBookings, LevelMust, "-"},
+	}
+
+	for _, tc := range testCases {
+		if got := m.cell(tc.endpoint, tc.level); got != tc.expected {
+			t.Errorf("%s %s: expected %q, got %q", tc.endpoint, tc.level, tc.expected, got)
+		}
+	}
+
+	var str strings.Builder
+	util.PanicIf(m.write(&str))
+
+	for _, e := range endpoint.All() {
+		if !strings.Contains(str.String(), e.String()) {
+			t.Errorf("compliance matrix should list endpoint %s", e)
+		}
+	}
+}
+
+func TestRunSuiteInvalidLevel(t *testing.T) {
+	suite := &Suite{
+		Server: localServer,
+		Steps:  []Step{{Endpoint: "/status", Level: "MAY"}},
+	}
+
+	if _, err := runSuite(suite, false, true); err == nil {
+		t.Error("expected an error on invalid level")
+	}
+}
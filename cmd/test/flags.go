@@ -18,23 +18,68 @@ type Flags struct {
 	// against expectation
 	ExpectedBookingStatus api.BookingStatus
 
-	// If true, the API is supposed to support the booking by deep link use case
+	// If true, the API is supposed to support the booking by deep link use
+	// case: returned journeys, trips and bookings are expected to have a
+	// webUrl
 	ExpectDeepLinkSupport bool
+
+	// DeepLinkHosts are the hosts allowed in webUrls, if deep link support is
+	// expected. If empty, any host is allowed.
+	DeepLinkHosts []string
+
+	// If true, the same request without API key is expected to be rejected
+	// with code 401
+	ExpectAuthRequired bool
+
+	// If true, the same booking event with a forged or expired idToken is
+	// expected to be rejected (only for POST /booking_events)
+	ExpectIDTokenVerified bool
+
+	// IDTokenSecret is the shared secret of idTokens. If not empty, the
+	// expired idToken is signed with it, so that the expiry check is tested
+	// independently of the signature check.
+	IDTokenSecret string
+
+	// IDTokenAudience is the audience of the forged and expired idTokens:
+	// the operator served by the tested server. If empty, the audience of
+	// the idToken of the booking event is kept.
+	IDTokenAudience string
+
+	// If true, the booking is expected to reject, with code 409, the status
+	// changes that are not allowed from its new status (only for PATCH
+	// /bookings). They are probed on a copy of the booking, created with
+	// POST /bookings.
+	ExpectTransitionsEnforced bool
+
+	// conformance is true for the steps of the conformance battery, where
+	// searches may be expected to fail: the status code of searches is then
+	// critic, and search results are only checked if code 200 is expected.
+	conformance bool
 }
 
 const (
-	DefaultFlagExpectNonEmpty        = false
-	DefaultFlagExpectDeepLinkSupport = false
-	DefaultFlagExpectedResponseCode  = http.StatusOK
-	DefaultFlagExpectedBookingStatus = ""
+	DefaultFlagExpectNonEmpty            = false
+	DefaultFlagExpectDeepLinkSupport     = false
+	DefaultFlagExpectAuthRequired        = false
+	DefaultFlagExpectIDTokenVerified     = false
+	DefaultFlagExpectTransitionsEnforced = false
+	DefaultFlagExpectedResponseCode      = http.StatusOK
+	DefaultFlagExpectedBookingStatus     = ""
+	// DefaultFlagIDTokenAudience is the operator of the default data of the
+	// test server
+	DefaultFlagIDTokenAudience = "operator.example.org"
 )
 
 // NewFlags return a set of default flags
 func NewFlags() Flags {
 	return Flags{
-		ExpectNonEmpty:        DefaultFlagExpectNonEmpty,
-		ExpectDeepLinkSupport: DefaultFlagExpectDeepLinkSupport,
-		ExpectedResponseCode:  DefaultFlagExpectedResponseCode,
-		ExpectedBookingStatus: DefaultFlagExpectedBookingStatus,
+		ExpectNonEmpty:            DefaultFlagExpectNonEmpty,
+		ExpectDeepLinkSupport:     DefaultFlagExpectDeepLinkSupport,
+		ExpectAuthRequired:        DefaultFlagExpectAuthRequired,
+		ExpectIDTokenVerified:     DefaultFlagExpectIDTokenVerified,
+		ExpectTransitionsEnforced: DefaultFlagExpectTransitionsEnforced,
+		ExpectedResponseCode:      DefaultFlagExpectedResponseCode,
+		ExpectedBookingStatus:     DefaultFlagExpectedBookingStatus,
+		IDTokenAudience:           DefaultFlagIDTokenAudience,
 	}
 }
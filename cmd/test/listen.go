@@ -0,0 +1,308 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/endpoint"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/test/assert"
+	"github.com/google/uuid"
+)
+
+// ListenConfig is the configuration of `Listen`
+type ListenConfig struct {
+	// Address on which the receiver listens, e.g. ":1324"
+	Address string
+
+	// BasePath is a prefix of the /booking_events path, e.g. "/stdcov/v1"
+	BasePath string
+
+	// Window is the time during which events are received. If 0, events are
+	// received until the context is done.
+	Window time.Duration
+
+	// Bookings are the IDs of the bookings known before the receiver starts.
+	// Events of other bookings are expected to create them.
+	Bookings []uuid.UUID
+
+	Verbose bool
+	Format  ReportFormat
+}
+
+// Listen starts an HTTP receiver for POST /booking_events, and tests every
+// received `CarpoolBookingEvent`: its format, and its booking and status
+// given the previous events. With the text format, a report is printed for
+// each event. Other formats print a single report of all events at the end.
+// It returns at the end of the time window (or when the context is done),
+// with an error if any event failed.
+func Listen(ctx context.Context, config ListenConfig) error {
+	return listen(ctx, config, os.Stdout)
+}
+
+func listen(ctx context.Context, config ListenConfig, w io.Writer) error {
+	l := newListener(config, w)
+
+	server := &http.Server{Addr: config.Address, Handler: l}
+
+	if config.Window > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, config.Window)
+		defer cancel()
+	}
+
+	listenErr := make(chan error, 1)
+
+	go func() {
+		listenErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-listenErr:
+		return err
+
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			return err
+		}
+	}
+
+	return l.summary()
+}
+
+// listener is an http.Handler receiving booking events, and reporting on
+// each of them
+type listener struct {
+	basePath string
+	verbose  bool
+	format   ReportFormat
+	w        io.Writer
+
+	// checkMu serializes the tests of events, as they depend on previous
+	// events
+	checkMu sync.Mutex
+	// statuses are the statuses of known bookings in their last valid event,
+	// empty if there is none
+	statuses map[uuid.UUID]api.BookingStatus
+
+	mu      sync.Mutex
+	reports []*Report
+}
+
+func newListener(config ListenConfig, w io.Writer) *listener {
+	basePath := strings.TrimSuffix(config.BasePath, "/")
+	if basePath != "" && !strings.HasPrefix(basePath, "/") {
+		basePath = "/" + basePath
+	}
+
+	statuses := make(map[uuid.UUID]api.BookingStatus, len(config.Bookings))
+	for _, id := range config.Bookings {
+		statuses[id] = ""
+	}
+
+	return &listener{
+		basePath: basePath,
+		verbose:  config.Verbose,
+		format:   config.Format,
+		w:        w,
+		statuses: statuses,
+	}
+}
+
+// ServeHTTP tests a received booking event, and responds with code 200 if
+// all assertions pass, 400 otherwise.
+func (l *listener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != l.basePath+endpoint.PostBookingEvents.Path {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	start := time.Now()
+
+	request, err := l.requestWithContext(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	l.checkMu.Lock()
+	defer l.checkMu.Unlock()
+
+	// If the event cannot be parsed, the format assertion fails
+	booking, _ := parseBookingEvent(request)
+
+	previous, known := api.BookingStatus(""), true
+	if booking != nil {
+		previous, known = l.statuses[booking.Id]
+	}
+
+	a := assert.NewAccumulator()
+	testBookingEventRequest(request, a, previous, known)
+	a.ExecuteAll()
+
+	report := &Report{
+		verbose:          l.verbose,
+		endpoint:         endpoint.PostBookingEvents,
+		request:          request,
+		assertionResults: a.GetAssertionResults(),
+	}
+
+	statusCode := http.StatusOK
+	if report.hasErrors() {
+		statusCode = http.StatusBadRequest
+	} else if booking != nil {
+		l.statuses[booking.Id] = booking.Status
+	}
+
+	report.response = &http.Response{StatusCode: statusCode}
+	report.duration = time.Since(start)
+
+	l.add(report)
+
+	if statusCode != http.StatusOK {
+		errStr := fmt.Sprintf("%d failed assertion(s)", report.countErrors())
+		body, _ := json.Marshal(api.BadRequest{Error: &errStr})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		_, _ = w.Write(body)
+
+		return
+	}
+
+	w.WriteHeader(statusCode)
+}
+
+// requestWithContext returns a copy of a received request, as sent by a
+// client: with an absolute URL, a re-readable body, and endpoint information
+// in its context.
+func (l *listener) requestWithContext(r *http.Request) (*http.Request, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	server := endpoint.Server(fmt.Sprintf("%s://%s%s", scheme, r.Host, l.basePath))
+	ctx := endpoint.NewContext(r.Context(), server, endpoint.PostBookingEvents)
+
+	request := r.Clone(ctx)
+	request.URL.Scheme = scheme
+	request.URL.Host = r.Host
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	request.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	return request, nil
+}
+
+// add stores a report, and prints it with the text format
+func (l *listener) add(report *Report) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.reports = append(l.reports, report)
+
+	if l.format != ReportText {
+		return
+	}
+
+	result := "✅"
+	if report.hasErrors() {
+		result = "❌"
+	}
+
+	fmt.Fprintf(l.w, "Event %d received at %s: %d assertion(s), %d failed %s\n",
+		len(l.reports), time.Now().Format(time.RFC3339), len(report.assertionResults),
+		report.countErrors(), result)
+	fmt.Fprint(l.w, report.String())
+}
+
+// summary prints a summary of all received events (a single report of all
+// events, with formats other than text), and returns an error if any event
+// failed
+func (l *listener) summary() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var failedEvents, failedAssertions int
+
+	for _, report := range l.reports {
+		if report.hasErrors() {
+			failedEvents++
+			failedAssertions += report.countErrors()
+		}
+	}
+
+	if l.format == ReportText {
+		fmt.Fprintf(l.w, "%d event(s) received, %d failed\n", len(l.reports), failedEvents)
+	} else if err := l.suiteReport().write(l.w, l.format); err != nil {
+		return err
+	}
+
+	if failedEvents > 0 {
+		return fmt.Errorf("❌ %d failed assertion(s) in %d event(s)", failedAssertions, failedEvents)
+	}
+
+	return nil
+}
+
+// suiteReport returns a report of all received events, an event per step
+func (l *listener) suiteReport() *SuiteReport {
+	sr := &SuiteReport{verbose: l.verbose}
+
+	for i, report := range l.reports {
+		sr.steps = append(sr.steps,
+			stepReport{name: fmt.Sprintf("Event %d", i+1), level: LevelMust, report: report})
+	}
+
+	return sr
+}
+
+// parseBookingEvent parses the booking of a booking event request
+func parseBookingEvent(request *http.Request) (*api.Booking, error) {
+	body, err := request.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var event api.CarpoolBookingEvent
+	if err := json.NewDecoder(body).Decode(&event); err != nil {
+		return nil, err
+	}
+
+	return event.Booking()
+}
+
+// testBookingEventRequest tests a booking event received on POST
+// /booking_events. `previous` is the status of the booking in its previous
+// event (if any), and `known` tells if the booking is known.
+func testBookingEventRequest(request *http.Request, a assert.Accumulator,
+	previous api.BookingStatus, known bool) {
+	assert.CriticRequestFormat(a, request)
+	assert.BookingEventKnownBooking(a, request, known)
+	assert.BookingEventStatus(a, request, previous)
+}
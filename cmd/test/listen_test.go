@@ -0,0 +1,239 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
+	"github.com/google/uuid"
+)
+
+func makeBookingEvent() api.CarpoolBookingEvent {
+	return makeBookingEventWithStatus(uuid.New(), api.BookingStatusWAITINGCONFIRMATION)
+}
+
+func makeBookingEventWithStatus(bookingID uuid.UUID, status api.BookingStatus) api.CarpoolBookingEvent {
+	booking := api.Booking{Id: bookingID, Status: status}
+
+	event := api.CarpoolBookingEvent{Id: uuid.New()}
+	util.PanicIf(event.Data.FromDriverCarpoolBooking(*booking.ToDriverCarpoolBooking()))
+
+	return event
+}
+
+func TestListener(t *testing.T) {
+	validEvent, err := json.Marshal(makeBookingEvent())
+	util.PanicIf(err)
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedCode   int
+		expectedErrors int
+	}{
+		{"valid event", http.MethodPost, "/stdcov/booking_events", string(validEvent), http.StatusOK, 0},
+		{"invalid event", http.MethodPost, "/stdcov/booking_events", `{"id": "1234"}`, http.StatusBadRequest, 1},
+		{"wrong path", http.MethodPost, "/booking_events", string(validEvent), http.StatusNotFound, 0},
+		{"wrong method", http.MethodGet, "/stdcov/booking_events", "", http.StatusMethodNotAllowed, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var output bytes.Buffer
+
+			l := newListener(ListenConfig{BasePath: "/stdcov/", Format: ReportText}, &output)
+
+			server := httptest.NewServer(l)
+			defer server.Close()
+
+			request, err := http.NewRequest(tc.method, server.URL+tc.path, strings.NewReader(tc.body))
+			util.PanicIf(err)
+			request.Header.Set("Content-Type", "application/json")
+
+			response, err := http.DefaultClient.Do(request)
+			util.PanicIf(err)
+			response.Body.Close()
+
+			if response.StatusCode != tc.expectedCode {
+				t.Errorf("expected status code %d, got %d", tc.expectedCode, response.StatusCode)
+			}
+
+			nErrors := 0
+			for _, report := range l.reports {
+				nErrors += report.countErrors()
+			}
+
+			if nErrors != tc.expectedErrors {
+				t.Errorf("expected %d failed assertion(s), got %d:\n%s", tc.expectedErrors, nErrors, output.String())
+			}
+
+			err = l.summary()
+			if (err != nil) != (tc.expectedErrors > 0) {
+				t.Errorf("unexpected summary error: %v", err)
+			}
+		})
+	}
+}
+
+func TestListenerJUnitReport(t *testing.T) {
+	validEvent, err := json.Marshal(makeBookingEvent())
+	util.PanicIf(err)
+
+	var output bytes.Buffer
+
+	l := newListener(ListenConfig{Format: ReportJUnit}, &output)
+
+	server := httptest.NewServer(l)
+	defer server.Close()
+
+	for _, body := range []string{string(validEvent), `{"id": "1234"}`} {
+		response, err := http.Post(server.URL+"/booking_events", "application/json", strings.NewReader(body))
+		util.PanicIf(err)
+		response.Body.Close()
+	}
+
+	if output.Len() != 0 {
+		t.Errorf("expected no output before the summary, got %q", output.String())
+	}
+
+	if err := l.summary(); err == nil {
+		t.Error("expected an error for the invalid event")
+	}
+
+	// A single document, with a test suite per event
+	var report junitTestSuites
+
+	decoder := xml.NewDecoder(&output)
+	util.PanicIf(decoder.Decode(&report))
+
+	if len(report.Suites) != 2 {
+		t.Fatalf("expected 2 test suites, got %d", len(report.Suites))
+	}
+
+	for i, expectedFailures := range []int{0, 1} {
+		suite := report.Suites[i]
+
+		if expectedName := fmt.Sprintf("Event %d", i+1); suite.Name != expectedName {
+			t.Errorf("expected test suite %q, got %q", expectedName, suite.Name)
+		}
+
+		if suite.Failures != expectedFailures {
+			t.Errorf("%s: expected %d failure(s), got %d", suite.Name, expectedFailures, suite.Failures)
+		}
+	}
+
+	if failure := report.Suites[1].TestCases[0].Failure; failure == nil ||
+		report.Suites[1].TestCases[0].Name != "assert request format" {
+		t.Errorf("expected the request format of the invalid event to fail, got %+v", report.Suites[1].TestCases)
+	}
+
+	if err := decoder.Decode(&report); err != io.EOF {
+		t.Errorf("expected a single junit report, got %v", err)
+	}
+}
+
+func TestListenerBookingEvents(t *testing.T) {
+	var (
+		newBooking     = uuid.New()
+		unknownBooking = uuid.New()
+		knownBooking   = uuid.New()
+	)
+
+	events := []struct {
+		event          api.CarpoolBookingEvent
+		expectedCode   int
+		expectedFailed []string
+	}{
+		{makeBookingEventWithStatus(newBooking, api.BookingStatusWAITINGCONFIRMATION), http.StatusOK, nil},
+		{makeBookingEventWithStatus(newBooking, api.BookingStatusCONFIRMED), http.StatusOK, nil},
+		{makeBookingEventWithStatus(newBooking, api.BookingStatusWAITINGCONFIRMATION), http.StatusBadRequest,
+			[]string{"assert booking event status"}},
+		{makeBookingEventWithStatus(unknownBooking, api.BookingStatusCONFIRMED), http.StatusBadRequest,
+			[]string{"assert booking event refers to a known booking"}},
+		{makeBookingEventWithStatus(knownBooking, api.BookingStatusCANCELLED), http.StatusOK, nil},
+		// The status of the booking is the one of the last valid event
+		{makeBookingEventWithStatus(newBooking, api.BookingStatusCOMPLETEDPENDINGVALIDATION), http.StatusOK, nil},
+	}
+
+	var output bytes.Buffer
+
+	l := newListener(ListenConfig{Format: ReportJSON, Bookings: []uuid.UUID{knownBooking}}, &output)
+
+	server := httptest.NewServer(l)
+	defer server.Close()
+
+	for i, e := range events {
+		body, err := json.Marshal(e.event)
+		util.PanicIf(err)
+
+		response, err := http.Post(server.URL+"/booking_events", "application/json", bytes.NewReader(body))
+		util.PanicIf(err)
+		response.Body.Close()
+
+		if response.StatusCode != e.expectedCode {
+			t.Errorf("event %d: expected status code %d, got %d", i+1, e.expectedCode, response.StatusCode)
+		}
+	}
+
+	if err := l.summary(); err == nil {
+		t.Error("expected an error for the invalid events")
+	}
+
+	var report jsonReport
+	util.PanicIf(json.Unmarshal(output.Bytes(), &report))
+
+	failed := map[string][]string{}
+	assertions := map[string]int{}
+
+	for _, entry := range report.Results {
+		assertions[entry.Step]++
+
+		if !entry.Passed {
+			failed[entry.Step] = append(failed[entry.Step], entry.Description)
+		}
+	}
+
+	for i, e := range events {
+		step := fmt.Sprintf("Event %d", i+1)
+
+		if assertions[step] != 3 {
+			t.Errorf("%s: expected 3 assertions, got %d", step, assertions[step])
+		}
+
+		if strings.Join(failed[step], ", ") != strings.Join(e.expectedFailed, ", ") {
+			t.Errorf("%s: expected failed assertions %v, got %v", step, e.expectedFailed, failed[step])
+		}
+	}
+}
+
+func TestListenWindow(t *testing.T) {
+	var output bytes.Buffer
+
+	config := ListenConfig{Address: "127.0.0.1:0", Window: 50 * time.Millisecond, Format: ReportText}
+
+	start := time.Now()
+
+	if err := listen(context.Background(), config, &output); err != nil {
+		t.Errorf("no event received should not fail, got %s", err)
+	}
+
+	if time.Since(start) < config.Window {
+		t.Error("listen should return at the end of the time window")
+	}
+
+	if !strings.Contains(output.String(), "0 event(s) received") {
+		t.Errorf("expected a summary, got %q", output.String())
+	}
+}
@@ -16,22 +16,45 @@ package test
 
 import (
 	"fmt"
+	"os"
 )
 
 type TestRunner interface {
 	Run(method, URL string, query Query, body []byte, verbose bool, apiKey string, flags Flags) error
 }
 
+// OptionsRunner is a `TestRunner` accepting `RunOptions`
+type OptionsRunner interface {
+	TestRunner
+	RunWithOptions(method, URL string, query Query, body []byte, flags Flags, options RunOptions) error
+}
+
+// RunOptions are the options of a test run, other than the request and the
+// `Flags`
+type RunOptions struct {
+	Verbose bool
+	// Format of the report, text if empty
+	Format ReportFormat
+	APIKey string
+}
+
 type DefaultRunner struct{}
 
+var _ OptionsRunner = &DefaultRunner{}
+
 func NewDefaultRunner() *DefaultRunner {
 	return &DefaultRunner{}
 }
 
-// Run runs the cli validation and returns an exit code
-func (*DefaultRunner) Run(method, URL string, query Query, body []byte, verbose bool, apiKey string, flags Flags) error {
+// Run runs the cli validation and returns an exit code. The report is
+// printed as text.
+func (r *DefaultRunner) Run(method, URL string, query Query, body []byte, verbose bool, apiKey string, flags Flags) error {
+	return r.RunWithOptions(method, URL, query, body, flags, RunOptions{Verbose: verbose, APIKey: apiKey})
+}
 
-	req, err := makeRequestWithContext(method, URL, body, apiKey)
+// RunWithOptions runs the cli validation and returns an exit code
+func (*DefaultRunner) RunWithOptions(method, URL string, query Query, body []byte, flags Flags, options RunOptions) error {
+	req, err := makeRequestWithContext(method, URL, body, options.APIKey)
 	if err != nil {
 		return err
 	}
@@ -43,8 +66,16 @@ func (*DefaultRunner) Run(method, URL string, query Query, body []byte, verbose
 		return err
 	}
 
-	report.verbose = verbose
-	fmt.Println(report)
+	report.verbose = options.Verbose
+
+	format := options.Format
+	if format == "" {
+		format = ReportText
+	}
+
+	if err := report.write(os.Stdout, format); err != nil {
+		return err
+	}
 
 	if report.hasErrors() {
 		return fmt.Errorf("❌ %d failed assertion(s) ", report.countErrors())
@@ -57,3 +88,9 @@ func RunTest(method, URL string, query Query, body []byte, verbose bool, apiKey
 	runner := DefaultRunner{}
 	return runner.Run(method, URL, query, body, verbose, apiKey, flags)
 }
+
+// RunTestWithOptions is `RunTest` with `RunOptions`, e.g. a report format
+func RunTestWithOptions(method, URL string, query Query, body []byte, flags Flags, options RunOptions) error {
+	runner := DefaultRunner{}
+	return runner.RunWithOptions(method, URL, query, body, flags, options)
+}
@@ -0,0 +1,655 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/endpoint"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/test/assert"
+)
+
+// Recordings are HAR files (http://www.softwareishard.com/blog/har-12-spec/),
+// one per tested request. The first entry is the tested request and its
+// response, followed by the additional requests sent by assertions (e.g. the
+// same request without API key). The flags of the test are stored in the
+// "_flags" property of the first entry, so that assertions can be replayed
+// offline with `Replay`.
+
+const (
+	recordingExt = ".har"
+
+	// redacted replaces the value of sensitive headers and body fields in
+	// recordings
+	redacted = "REDACTED"
+)
+
+// sensitiveHeaders are redacted in recordings
+var sensitiveHeaders = []string{api.HeaderXAPIKey, "Authorization"}
+
+// sensitiveBodyFields are the properties of json request bodies redacted in
+// recordings, e.g. the idToken of booking events, which is a bearer
+// credential
+var sensitiveBodyFields = []string{"idToken"}
+
+// recordDir is the directory where tests are recorded, set by `RecordTo`.
+// Recording is disabled if empty.
+var (
+	recordMu  sync.Mutex
+	recordDir string
+)
+
+// RecordTo records the requests and responses of all following tests in
+// directory dir, which is created if needed
+func RecordTo(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	recordMu.Lock()
+	defer recordMu.Unlock()
+
+	recordDir = dir
+
+	return nil
+}
+
+// StopRecording disables recording
+func StopRecording() {
+	recordMu.Lock()
+	defer recordMu.Unlock()
+
+	recordDir = ""
+}
+
+func recordingDir() string {
+	recordMu.Lock()
+	defer recordMu.Unlock()
+
+	return recordDir
+}
+
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+
+	// Flags are the flags of the test, set on the first entry only
+	Flags *Flags `json:"_flags,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// recordingDoer is an api.HttpRequestDoer which records the requests it
+// sends and their responses
+type recordingDoer struct {
+	doer    api.HttpRequestDoer
+	mu      *sync.Mutex
+	entries *[]harEntry
+}
+
+func (r recordingDoer) Do(req *http.Request) (*http.Response, error) {
+	requestBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+
+	response, err := r.doer.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	responseBody, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	response.Body = io.NopCloser(bytes.NewReader(responseBody))
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	*r.entries = append(*r.entries,
+		newHAREntry(req, requestBody, response, responseBody, start, time.Since(start)))
+
+	return response, nil
+}
+
+// readRequestBody reads the body of the request, without consuming it
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+
+		return io.ReadAll(body)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	return body, err
+}
+
+func newHAREntry(
+	req *http.Request,
+	requestBody []byte,
+	response *http.Response,
+	responseBody []byte,
+	start time.Time,
+	duration time.Duration,
+) harEntry {
+	ms := float64(duration) / float64(time.Millisecond)
+
+	entry := harEntry{
+		StartedDateTime: start,
+		Time:            ms,
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(req.Header),
+			QueryString: harQueryString(req),
+			HeadersSize: -1,
+			BodySize:    len(requestBody),
+		},
+		Response: harResponse{
+			Status:      response.StatusCode,
+			StatusText:  http.StatusText(response.StatusCode),
+			HTTPVersion: response.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(response.Header),
+			Content: harContent{
+				Size:     len(responseBody),
+				MimeType: response.Header.Get("Content-Type"),
+				Text:     string(responseBody),
+			},
+			HeadersSize: -1,
+			BodySize:    len(responseBody),
+		},
+		Timings: harTimings{Wait: ms},
+	}
+
+	if requestBody != nil {
+		entry.Request.PostData = &harPostData{
+			MimeType: req.Header.Get("Content-Type"),
+			Text:     string(redactBody(requestBody)),
+		}
+	}
+
+	return entry
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	headers := []harNameValue{}
+
+	for _, name := range sortedHeaderNames(header) {
+		for _, value := range header[name] {
+			if isSensitiveHeader(name) && value != "" {
+				value = redacted
+			}
+
+			headers = append(headers, harNameValue{name, value})
+		}
+	}
+
+	return headers
+}
+
+// sortedHeaderNames returns the names of the header (or query values), sorted
+func sortedHeaderNames(header http.Header) []string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func isSensitiveHeader(name string) bool {
+	for _, sensitive := range sensitiveHeaders {
+		if http.CanonicalHeaderKey(name) == http.CanonicalHeaderKey(sensitive) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactBody returns the body with the value of sensitive fields redacted, at
+// any depth. Bodies which are not json, or without sensitive field, are
+// returned as is.
+func redactBody(body []byte) []byte {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return body
+	}
+
+	if !redactValue(value) {
+		return body
+	}
+
+	redactedBody, err := json.Marshal(value)
+	if err != nil {
+		return body
+	}
+
+	return redactedBody
+}
+
+// redactValue redacts in place the sensitive fields of a decoded json value,
+// and returns true if any was found
+func redactValue(value interface{}) bool {
+	found := false
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if isSensitiveBodyField(key) {
+				v[key] = redacted
+				found = true
+
+				continue
+			}
+
+			found = redactValue(field) || found
+		}
+
+	case []interface{}:
+		for _, item := range v {
+			found = redactValue(item) || found
+		}
+	}
+
+	return found
+}
+
+func isSensitiveBodyField(name string) bool {
+	for _, sensitive := range sensitiveBodyFields {
+		if name == sensitive {
+			return true
+		}
+	}
+
+	return false
+}
+
+func harQueryString(req *http.Request) []harNameValue {
+	query := []harNameValue{}
+
+	values := req.URL.Query()
+	for _, name := range sortedHeaderNames(http.Header(values)) {
+		for _, value := range values[name] {
+			query = append(query, harNameValue{name, value})
+		}
+	}
+
+	return query
+}
+
+// recordTest runs the test, recording its requests and responses if
+// recording is enabled
+func recordTest(client APIClient, flags Flags, run func()) error {
+	dir := recordingDir()
+	if dir == "" {
+		run()
+		return nil
+	}
+
+	var (
+		mu      sync.Mutex
+		entries []harEntry
+	)
+
+	apiClient, assertClient := client.Client, assert.Client
+	client.Client = recordingDoer{apiClient, &mu, &entries}
+	assert.Client = recordingDoer{assertClient, &mu, &entries}
+
+	defer func() {
+		client.Client, assert.Client = apiClient, assertClient
+	}()
+
+	run()
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	// The secret is not needed to replay the test
+	flags.IDTokenSecret = ""
+	entries[0].Flags = &flags
+
+	return writeRecording(dir, entries)
+}
+
+// writeRecording writes entries in a new HAR file of dir, numbered after the
+// existing ones
+func writeRecording(dir string, entries []harEntry) error {
+	existing, err := recordingFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	first := entries[0].Request
+
+	name := fmt.Sprintf("%04d-%s%s", len(existing)+1, strings.ToLower(first.Method),
+		recordingFileSuffix(first.URL))
+
+	data, err := json.MarshalIndent(harFile{harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "pscovoit", Version: "1.0"},
+		Entries: entries,
+	}}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, name), data, 0o644)
+}
+
+// recordingFileSuffix returns a readable suffix of the recording file of a
+// request, from the last segment of its URL path
+func recordingFileSuffix(rawURL string) string {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return recordingExt
+	}
+
+	_, endpointInfo, err := endpoint.FromRequest(req)
+	if err != nil {
+		return recordingExt
+	}
+
+	segments := strings.Split(strings.Trim(endpointInfo.Path, "/"), "/")
+
+	return "-" + segments[0] + recordingExt
+}
+
+// recordingFiles lists the HAR files of dir, sorted by name
+func recordingFiles(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+recordingExt))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+//////////////////////////////////////////////////////////////
+// Replay
+//////////////////////////////////////////////////////////////
+
+// Replay runs again, offline, the assertions of the tests recorded in dir,
+// and prints a single report in given format. It returns an error if any
+// assertion failed.
+func Replay(dir string, verbose bool, format ReportFormat) error {
+	suiteReport, err := replay(dir, verbose)
+	if err != nil {
+		return err
+	}
+
+	if err := suiteReport.write(os.Stdout, format); err != nil {
+		return err
+	}
+
+	if suiteReport.hasErrors() {
+		return fmt.Errorf("❌ %d failed assertion(s) ", suiteReport.countErrors())
+	}
+
+	return nil
+}
+
+func replay(dir string, verbose bool) (*SuiteReport, error) {
+	files, err := recordingFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recording (%s file) in %s", recordingExt, dir)
+	}
+
+	suiteReport := &SuiteReport{verbose: verbose}
+
+	for _, file := range files {
+		report, err := replayFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+
+		report.verbose = verbose
+		suiteReport.steps = append(suiteReport.steps,
+			stepReport{name: filepath.Base(file), level: LevelMust, report: report})
+	}
+
+	return suiteReport, nil
+}
+
+// replayFile runs the assertions of a recorded test against its recorded
+// response. Additional requests of assertions get the recorded responses.
+func replayFile(file string) (*Report, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("invalid HAR file: %w", err)
+	}
+
+	entries := har.Log.Entries
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no entry in HAR file")
+	}
+
+	tested := entries[0]
+
+	flags := NewFlags()
+	if tested.Flags != nil {
+		flags = *tested.Flags
+	}
+
+	request, err := tested.Request.toRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	request, err = AddEndpointContext(request)
+	if err != nil {
+		return nil, err
+	}
+
+	_, endpointInfo, err := endpoint.FromContext(request.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	testFun, err := SelectTestFun(endpointInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	assertClient := assert.Client
+	assert.Client = &replayingDoer{entries: entries[1:]}
+
+	defer func() { assert.Client = assertClient }()
+
+	response := tested.Response.toResponse(request)
+
+	report := NewReport(request, testFun(request, response, flags)...)
+	report.endpoint = endpointInfo
+	report.response = response
+	report.duration = time.Duration(tested.Time * float64(time.Millisecond))
+
+	return &report, nil
+}
+
+func (r harRequest) toRequest() (*http.Request, error) {
+	var body io.Reader
+	if r.PostData != nil {
+		body = strings.NewReader(r.PostData.Text)
+	}
+
+	request, err := http.NewRequest(r.Method, r.URL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, header := range r.Headers {
+		request.Header.Add(header.Name, header.Value)
+	}
+
+	return request, nil
+}
+
+func (r harResponse) toResponse(request *http.Request) *http.Response {
+	header := http.Header{}
+	for _, h := range r.Headers {
+		header.Add(h.Name, h.Value)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.Status, r.StatusText),
+		StatusCode:    r.Status,
+		Proto:         r.HTTPVersion,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(r.Content.Text)),
+		ContentLength: int64(len(r.Content.Text)),
+		Request:       request,
+	}
+}
+
+// replayingDoer answers requests with the recorded responses of the first
+// unused entries with the same method, URL and body. As sensitive fields are
+// redacted in recordings, their values are ignored when comparing bodies.
+type replayingDoer struct {
+	entries []harEntry
+	used    []bool
+}
+
+func (r *replayingDoer) Do(req *http.Request) (*http.Response, error) {
+	if r.used == nil {
+		r.used = make([]bool, len(r.entries))
+	}
+
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, entry := range r.entries {
+		if !r.used[i] && entry.Request.Method == req.Method &&
+			entry.Request.URL == req.URL.String() && entry.Request.hasBody(body) {
+			r.used[i] = true
+			return entry.Response.toResponse(req), nil
+		}
+	}
+
+	return nil, fmt.Errorf("no recorded response to %s %s", req.Method, req.URL)
+}
+
+// hasBody checks if the recorded request has given body, once redacted.
+// Json bodies are compared by value.
+func (r harRequest) hasBody(body []byte) bool {
+	var recorded []byte
+	if r.PostData != nil {
+		recorded = []byte(r.PostData.Text)
+	}
+
+	body = redactBody(body)
+
+	var recordedValue, value interface{}
+	if json.Unmarshal(recorded, &recordedValue) == nil && json.Unmarshal(body, &value) == nil {
+		return reflect.DeepEqual(recordedValue, value)
+	}
+
+	return bytes.Equal(recorded, body)
+}
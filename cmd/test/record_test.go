@@ -0,0 +1,224 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
+	"github.com/labstack/echo/v4"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+			if r.Header.Get(api.HeaderXAPIKey) == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte(`{"error": "missing API key"}`))
+
+				return
+			}
+
+			_, _ = w.Write([]byte("[]"))
+		},
+	))
+
+	query := map[string]string{
+		"departureLat":  "0",
+		"departureLng":  "0",
+		"arrivalLat":    "0",
+		"arrivalLng":    "0",
+		"departureDate": "0",
+	}
+
+	suite := &Suite{
+		Server: server.URL,
+		APIKey: "secret-key",
+		Steps: []Step{
+			{Endpoint: "/driver_journeys", Query: query, ExpectAuthRequired: true},
+			{Endpoint: "/passenger_journeys", Query: query, ExpectNonEmpty: true},
+		},
+	}
+
+	dir := filepath.Join(t.TempDir(), "recording")
+
+	util.PanicIf(RecordTo(dir))
+	recorded, err := runSuite(suite, false, false)
+	StopRecording()
+	util.PanicIf(err)
+
+	// Replay is offline
+	server.Close()
+
+	files, err := recordingFiles(dir)
+	util.PanicIf(err)
+
+	if len(files) != 2 {
+		t.Fatalf("expected a recording per step, got %v", files)
+	}
+
+	if name := filepath.Base(files[0]); name != "0001-get-driver_journeys.har" {
+		t.Errorf("unexpected recording name %s", name)
+	}
+
+	data, err := os.ReadFile(files[0])
+	util.PanicIf(err)
+
+	if strings.Contains(string(data), suite.APIKey) {
+		t.Error("expected API key to be redacted")
+	}
+
+	var har harFile
+	util.PanicIf(json.Unmarshal(data, &har))
+
+	if n := len(har.Log.Entries); n != 2 {
+		t.Errorf("expected the request without API key to be recorded, got %d entries", n)
+	}
+
+	replayed, err := replay(dir, false)
+	util.PanicIf(err)
+
+	if len(replayed.steps) != len(recorded.steps) {
+		t.Fatalf("expected %d replayed steps, got %d", len(recorded.steps), len(replayed.steps))
+	}
+
+	for i, step := range replayed.steps {
+		expected := recorded.steps[i].report.assertionResults
+		got := step.report.assertionResults
+
+		if len(got) != len(expected) {
+			t.Errorf("step %d: expected %d assertions, got %d", i+1, len(expected), len(got))
+			continue
+		}
+
+		for j := range got {
+			if got[j].AssertionDescription != expected[j].AssertionDescription ||
+				(got[j].Err == nil) != (expected[j].Err == nil) {
+				t.Errorf("step %d: expected result %+v, got %+v", i+1, expected[j], got[j])
+			}
+		}
+	}
+
+	if replayed.countErrors() != 1 {
+		t.Errorf("expected the failure of the recording to be replayed, got %d failures",
+			replayed.countErrors())
+	}
+}
+
+func TestRecordAndReplayBookingEvent(t *testing.T) {
+	const idToken = "secret-id-token"
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var event map[string]interface{}
+			util.PanicIf(json.NewDecoder(r.Body).Decode(&event))
+
+			if event["idToken"] != idToken {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+		},
+	))
+
+	event := makeBookingEvent()
+	event.IdToken = idToken
+
+	suite := &Suite{
+		Server: server.URL,
+		Steps: []Step{
+			{Method: http.MethodPost, Endpoint: "/booking_events", Body: event, ExpectIDTokenVerified: true},
+		},
+	}
+
+	dir := filepath.Join(t.TempDir(), "recording")
+
+	util.PanicIf(RecordTo(dir))
+	recorded, err := runSuite(suite, false, false)
+	StopRecording()
+	util.PanicIf(err)
+
+	server.Close()
+
+	files, err := recordingFiles(dir)
+	util.PanicIf(err)
+
+	if len(files) != 1 {
+		t.Fatalf("expected a single recording, got %v", files)
+	}
+
+	data, err := os.ReadFile(files[0])
+	util.PanicIf(err)
+
+	if strings.Contains(string(data), idToken) {
+		t.Error("expected idToken to be redacted")
+	}
+
+	var har harFile
+	util.PanicIf(json.Unmarshal(data, &har))
+
+	// The tested request, then the requests with forged and expired idTokens
+	if n := len(har.Log.Entries); n != 3 {
+		t.Fatalf("expected 3 recorded entries, got %d", n)
+	}
+
+	for _, entry := range har.Log.Entries {
+		if !strings.Contains(entry.Request.PostData.Text, redacted) {
+			t.Errorf("expected redacted idToken in body %s", entry.Request.PostData.Text)
+		}
+	}
+
+	replayed, err := replay(dir, false)
+	util.PanicIf(err)
+
+	expected := recorded.steps[0].report.assertionResults
+	got := replayed.steps[0].report.assertionResults
+
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d assertions, got %d", len(expected), len(got))
+	}
+
+	for i := range got {
+		if got[i].AssertionDescription != expected[i].AssertionDescription ||
+			(got[i].Err == nil) != (expected[i].Err == nil) {
+			t.Errorf("expected result %+v, got %+v", expected[i], got[i])
+		}
+	}
+
+	if replayed.countErrors() != 0 {
+		t.Errorf("expected the idToken assertion to be replayed without error, got %d failures",
+			replayed.countErrors())
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	testCases := []struct {
+		body     string
+		expected string
+	}{
+		{`{"id": "1", "idToken": "token"}`, `{"id":"1","idToken":"REDACTED"}`},
+		{`[{"user": {"idToken": "token"}}]`, `[{"user":{"idToken":"REDACTED"}}]`},
+		{`{"id": "1"}`, `{"id": "1"}`},
+		{`not json`, `not json`},
+	}
+
+	for _, tc := range testCases {
+		if got := string(redactBody([]byte(tc.body))); got != tc.expected {
+			t.Errorf("redactBody(%s): expected %s, got %s", tc.body, tc.expected, got)
+		}
+	}
+}
+
+func TestReplayMissingRecording(t *testing.T) {
+	if _, err := replay(t.TempDir(), false); err == nil {
+		t.Error("expected an error without recording")
+	}
+}
@@ -2,7 +2,9 @@ package test
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/fabmob/playground-standard-covoiturage/cmd/endpoint"
 	"github.com/fabmob/playground-standard-covoiturage/cmd/test/assert"
@@ -13,6 +15,8 @@ type Report struct {
 	verbose          bool
 	endpoint         endpoint.Info
 	request          *http.Request
+	response         *http.Response
+	duration         time.Duration
 	assertionResults []assert.Result
 }
 
@@ -40,6 +44,11 @@ func (report *Report) String() string {
 		str += stringDetail("Additional details:")
 		str += stringDetail("  request Method: " + report.request.Method)
 		str += stringDetail("  request URL: " + report.request.URL.String())
+
+		if report.response != nil {
+			str += stringDetail(fmt.Sprintf("  response status: %d", report.statusCode()))
+			str += stringDetail("  response time: " + report.duration.String())
+		}
 	}
 
 	return str
@@ -65,6 +74,89 @@ func (report *Report) hasErrors() bool {
 	return report.countErrors() > 0
 }
 
+// statusCode returns the status code of the response, or 0 if no response
+// has been received.
+func (report *Report) statusCode() int {
+	if report.response == nil {
+		return 0
+	}
+
+	return report.response.StatusCode
+}
+
+// write writes the report in given format
+func (report *Report) write(w io.Writer, format ReportFormat) error {
+	return writeReports(w, format, report, []stepReport{{report: report}})
+}
+
+// ////////////////////////////////////////////////////////////
+// Suite report
+// ////////////////////////////////////////////////////////////
+
+// SuiteReport stores and prints the reports of all steps of a `Suite`
+type SuiteReport struct {
+	verbose bool
+	steps   []stepReport
+}
+
+type stepReport struct {
+	name   string
+	level  Level
+	report *Report
+}
+
+func (sr *SuiteReport) add(step Step, report *Report) {
+	report.verbose = sr.verbose
+	sr.steps = append(sr.steps, stepReport{step.Name, step.Level, report})
+}
+
+// String implements stringer interface. Step reports are printed if they
+// are not empty, followed by a summary.
+func (sr *SuiteReport) String() string {
+	str := ""
+
+	for i, step := range sr.steps {
+		if stepStr := step.report.String(); stepStr != "" {
+			str += fmt.Sprintf("Step %d: %s\n", i+1, step.name)
+			str += stepStr
+			str += "\n"
+		}
+	}
+
+	nAssertions := 0
+	for _, step := range sr.steps {
+		nAssertions += len(step.report.assertionResults)
+	}
+
+	str += fmt.Sprintf(
+		"%d step(s), %d assertion(s), %d failed\n",
+		len(sr.steps),
+		nAssertions,
+		sr.countErrors(),
+	)
+
+	return str
+}
+
+func (sr *SuiteReport) countErrors() int {
+	var nErr = 0
+
+	for _, step := range sr.steps {
+		nErr += step.report.countErrors()
+	}
+
+	return nErr
+}
+
+func (sr *SuiteReport) hasErrors() bool {
+	return sr.countErrors() > 0
+}
+
+// write writes the suite report in given format
+func (sr *SuiteReport) write(w io.Writer, format ReportFormat) error {
+	return writeReports(w, format, sr, sr.steps)
+}
+
 // ////////////////////////////////////////////////////////////
 // Printing helper functions
 // ////////////////////////////////////////////////////////////
@@ -0,0 +1,263 @@
+package test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ReportFormat is the output format of test reports
+type ReportFormat string
+
+// Available report formats
+const (
+	// ReportText is a human readable format, for terminals
+	ReportText ReportFormat = "text"
+	// ReportJSON is a json document with one entry per assertion
+	ReportJSON ReportFormat = "json"
+	// ReportJUnit is a JUnit XML document, with one test case per assertion
+	ReportJUnit ReportFormat = "junit"
+)
+
+// ReportFormats lists all available report formats
+var ReportFormats = []ReportFormat{ReportText, ReportJSON, ReportJUnit}
+
+// String implements pflag.Value.String (cobra flags)
+func (f *ReportFormat) String() string {
+	if *f == "" {
+		return string(ReportText)
+	}
+
+	return string(*f)
+}
+
+// Set implements pflag.Value.Set (cobra flags)
+func (f *ReportFormat) Set(s string) error {
+	for _, format := range ReportFormats {
+		if ReportFormat(s) == format {
+			*f = format
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown report format %q, available formats: %s", s, joinFormats())
+}
+
+// Type implements pflag.Value.Type (cobra flags)
+func (f *ReportFormat) Type() string {
+	return "ReportFormat"
+}
+
+func joinFormats() string {
+	formats := make([]string, 0, len(ReportFormats))
+	for _, format := range ReportFormats {
+		formats = append(formats, string(format))
+	}
+
+	return strings.Join(formats, ", ")
+}
+
+// writeReports writes the reports of all steps in given format. Text format
+// is the output of `text`.
+func writeReports(w io.Writer, format ReportFormat, text fmt.Stringer, steps []stepReport) error {
+	switch format {
+	case ReportJSON:
+		return writeJSONReport(w, steps)
+
+	case ReportJUnit:
+		return writeJUnitReport(w, steps)
+
+	default:
+		_, err := fmt.Fprintln(w, text)
+		return err
+	}
+}
+
+//////////////////////////////////////////////////////////////
+// JSON
+//////////////////////////////////////////////////////////////
+
+// jsonReport is the json representation of test reports
+type jsonReport struct {
+	Assertions int         `json:"assertions"`
+	Failures   int         `json:"failures"`
+	Results    []jsonEntry `json:"results"`
+}
+
+// jsonEntry is the json representation of a single assertion result
+type jsonEntry struct {
+	Step        string       `json:"step,omitempty"`
+	Level       Level        `json:"level,omitempty"`
+	Endpoint    string       `json:"endpoint"`
+	Description string       `json:"description"`
+	Passed      bool         `json:"passed"`
+	Error       string       `json:"error,omitempty"`
+	Request     jsonRequest  `json:"request"`
+	Response    jsonResponse `json:"response"`
+}
+
+type jsonRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+type jsonResponse struct {
+	// Status is 0 if no response has been received
+	Status     int     `json:"status"`
+	DurationMs float64 `json:"durationMs"`
+}
+
+func writeJSONReport(w io.Writer, steps []stepReport) error {
+	report := jsonReport{Results: []jsonEntry{}}
+
+	for _, step := range steps {
+		r := step.report
+		request := jsonRequest{r.request.Method, r.request.URL.String()}
+		response := jsonResponse{r.statusCode(), milliseconds(r.duration)}
+
+		for _, ar := range r.assertionResults {
+			entry := jsonEntry{
+				Step:        step.name,
+				Level:       step.level,
+				Endpoint:    r.endpoint.String(),
+				Description: ar.AssertionDescription,
+				Passed:      ar.Unwrap() == nil,
+				Request:     request,
+				Response:    response,
+			}
+
+			if err := ar.Unwrap(); err != nil {
+				entry.Error = err.Error()
+				report.Failures++
+			}
+
+			report.Results = append(report.Results, entry)
+		}
+	}
+
+	report.Assertions = len(report.Results)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(report)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+//////////////////////////////////////////////////////////////
+// JUnit XML
+//////////////////////////////////////////////////////////////
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Content string `xml:",chardata"`
+}
+
+// writeJUnitReport writes one test suite per step, and one test case per
+// assertion. Request and response details are stored as test suite
+// properties.
+func writeJUnitReport(w io.Writer, steps []stepReport) error {
+	var (
+		report        = junitTestSuites{}
+		totalDuration time.Duration
+	)
+
+	for _, step := range steps {
+		r := step.report
+
+		name := r.endpoint.String()
+		if step.name != "" {
+			name = step.name
+		}
+
+		suite := junitTestSuite{
+			Name:  name,
+			Tests: len(r.assertionResults),
+			Time:  seconds(r.duration),
+			Properties: []junitProperty{
+				{"endpoint", r.endpoint.String()},
+				{"level", string(step.level)},
+				{"request.method", r.request.Method},
+				{"request.url", r.request.URL.String()},
+				{"response.status", fmt.Sprint(r.statusCode())},
+				{"response.durationMs", fmt.Sprint(milliseconds(r.duration))},
+			},
+		}
+
+		for _, ar := range r.assertionResults {
+			testCase := junitTestCase{
+				Name:      ar.AssertionDescription,
+				ClassName: r.endpoint.String(),
+				Time:      seconds(0),
+			}
+
+			if err := ar.Unwrap(); err != nil {
+				testCase.Failure = &junitFailure{Message: err.Error(), Content: err.Error()}
+				suite.Failures++
+			}
+
+			suite.TestCases = append(suite.TestCases, testCase)
+		}
+
+		report.Suites = append(report.Suites, suite)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		totalDuration += r.duration
+	}
+
+	report.Time = seconds(totalDuration)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -1,13 +1,18 @@
 package test
 
 import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/fabmob/playground-standard-covoiturage/cmd/endpoint"
 	"github.com/fabmob/playground-standard-covoiturage/cmd/test/assert"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
 )
 
 var request, _ = http.NewRequest(http.MethodGet, "", nil)
@@ -144,3 +149,102 @@ func TestReportCountErrors(t *testing.T) {
 		}
 	}
 }
+
+func makeFormatTestReport() *Report {
+	req, _ := http.NewRequest(http.MethodGet, localServer+"/driver_journeys", nil)
+
+	report := NewReport(
+		req,
+		assert.NewAssertionResult(nil, "assert format"),
+		assert.NewAssertionResult(errors.New("wrong <status>"), "assert status code 200"),
+	)
+	report.endpoint = endpoint.GetDriverJourneys
+	report.response = &http.Response{StatusCode: http.StatusBadRequest}
+	report.duration = 1500 * time.Microsecond
+
+	return &report
+}
+
+func TestReportJSON(t *testing.T) {
+	var buf bytes.Buffer
+
+	util.PanicIf(makeFormatTestReport().write(&buf, ReportJSON))
+
+	var got jsonReport
+	util.PanicIf(json.Unmarshal(buf.Bytes(), &got))
+
+	if got.Assertions != 2 || got.Failures != 1 || len(got.Results) != 2 {
+		t.Fatalf("wrong json report summary: %s", buf.String())
+	}
+
+	failure := got.Results[1]
+	expected := jsonEntry{
+		Endpoint:    endpoint.GetDriverJourneys.String(),
+		Description: "assert status code 200",
+		Passed:      false,
+		Error:       "wrong <status>",
+		Request:     jsonRequest{http.MethodGet, localServer + "/driver_journeys"},
+		Response:    jsonResponse{http.StatusBadRequest, 1.5},
+	}
+
+	if failure != expected {
+		t.Errorf("wrong json entry, expected %+v, got %+v", expected, failure)
+	}
+
+	if !got.Results[0].Passed || got.Results[0].Error != "" {
+		t.Errorf("wrong json entry for passed assertion: %+v", got.Results[0])
+	}
+}
+
+func TestReportJUnit(t *testing.T) {
+	var buf bytes.Buffer
+
+	util.PanicIf(makeFormatTestReport().write(&buf, ReportJUnit))
+
+	var got junitTestSuites
+	util.PanicIf(xml.Unmarshal(buf.Bytes(), &got))
+
+	if got.Tests != 2 || got.Failures != 1 || len(got.Suites) != 1 {
+		t.Fatalf("wrong junit report summary: %s", buf.String())
+	}
+
+	testCases := got.Suites[0].TestCases
+	if len(testCases) != 2 {
+		t.Fatalf("expected 2 test cases, got %d", len(testCases))
+	}
+
+	if testCases[0].Failure != nil {
+		t.Error("passed assertion should not have a failure")
+	}
+
+	if testCases[1].Failure == nil || testCases[1].Failure.Message != "wrong <status>" {
+		t.Errorf("wrong failure: %+v", testCases[1].Failure)
+	}
+
+	for _, expected := range []string{
+		`name="response.status" value="400"`,
+		`name="request.url" value="` + localServer + `/driver_journeys"`,
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("junit report should contain %s: %s", expected, buf.String())
+		}
+	}
+}
+
+func TestReportFormatSet(t *testing.T) {
+	var format ReportFormat
+
+	if format.String() != string(ReportText) {
+		t.Errorf("default report format should be %s", ReportText)
+	}
+
+	for _, valid := range ReportFormats {
+		if err := format.Set(string(valid)); err != nil || format != valid {
+			t.Errorf("report format %s should be valid", valid)
+		}
+	}
+
+	if err := format.Set("html"); err == nil {
+		t.Error("report format html should be invalid")
+	}
+}
@@ -6,13 +6,15 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
 	"github.com/fabmob/playground-standard-covoiturage/cmd/endpoint"
 	"github.com/labstack/echo/v4"
 )
 
-const (
-	HeaderXAPIKey = "X-API-Key"
-)
+// HeaderXAPIKey is the header holding the API key of a request.
+//
+// Deprecated: use api.HeaderXAPIKey
+const HeaderXAPIKey = api.HeaderXAPIKey
 
 // makeRequestWithContext makes a request with right header, and stores server and
 // endpoint information in its context.
@@ -23,7 +25,7 @@ func makeRequestWithContext(method, URL string, body []byte, apiKey string) (*ht
 		return nil, err
 	}
 
-	req.Header.Set(HeaderXAPIKey, apiKey)
+	req.Header.Set(api.HeaderXAPIKey, apiKey)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
 	return AddEndpointContext(req)
@@ -0,0 +1,46 @@
+package test
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed scenarios/*.yaml
+var scenarioFiles embed.FS
+
+const scenarioDir = "scenarios"
+
+// ScenarioNames returns the names of the built-in scenarios
+func ScenarioNames() []string {
+	entries, err := scenarioFiles.ReadDir(scenarioDir)
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".yaml"))
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Scenario returns the built-in scenario with given name, as a `Suite`
+func Scenario(name string) (*Suite, error) {
+	data, err := scenarioFiles.ReadFile(path.Join(scenarioDir, name+".yaml"))
+	if err != nil {
+		return nil, fmt.Errorf(
+			"unknown scenario %q, available scenarios: %s",
+			name,
+			strings.Join(ScenarioNames(), ", "),
+		)
+	}
+
+	return ReadSuite(bytes.NewReader(data))
+}
@@ -0,0 +1,443 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/endpoint"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/test/assert"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// A Suite is a declarative list of test steps, run one after the other
+// against a server. It can be read from a YAML or JSON file with
+// `ReadSuite`.
+//
+// Variables (e.g. "${bookingId}") are expanded in server, API key,
+// endpoints, query parameters, bodies and expected booking status. They are
+// looked up in the suite variables, then in the values captured by previous
+// steps, and finally in environment variables. The special variable
+// "${uuid}" expands to a new random UUID each time it is used.
+type Suite struct {
+	// Server on which the steps are run, if endpoints are not absolute URLs
+	Server string `yaml:"server,omitempty"`
+
+	// APIKey is sent in the "X-API-Key" header of every request
+	APIKey string `yaml:"apiKey,omitempty"`
+
+	// Variables are initial values of variables. They are expanded once, at
+	// the beginning of the run.
+	Variables map[string]string `yaml:"variables,omitempty"`
+
+	Steps []Step `yaml:"steps"`
+}
+
+// A Step describes a single request and the expectations on its response.
+type Step struct {
+	Name string `yaml:"name,omitempty"`
+
+	// Method defaults to GET
+	Method string `yaml:"method,omitempty"`
+
+	// Endpoint is either a path relative to the suite server (e.g.
+	// "/bookings/{bookingId}", possibly with query), or an absolute URL.
+	Endpoint string `yaml:"endpoint"`
+
+	Query map[string]string `yaml:"query,omitempty"`
+
+	// Body is sent as is if it is a string, or marshalled to json otherwise.
+	Body interface{} `yaml:"body,omitempty"`
+
+	// Expectations, see `Flags`. ExpectResponseCode defaults to the success
+	// status code of the endpoint.
+	ExpectResponseCode        int      `yaml:"expectResponseCode,omitempty"`
+	ExpectNonEmpty            bool     `yaml:"expectNonEmpty,omitempty"`
+	ExpectBookingStatus       string   `yaml:"expectBookingStatus,omitempty"`
+	ExpectAuthRequired        bool     `yaml:"expectAuthRequired,omitempty"`
+	ExpectIDTokenVerified     bool     `yaml:"expectIdTokenVerified,omitempty"`
+	IDTokenSecret             string   `yaml:"idTokenSecret,omitempty"`
+	IDTokenAudience           string   `yaml:"idTokenAudience,omitempty"`
+	ExpectTransitionsEnforced bool     `yaml:"expectTransitionsEnforced,omitempty"`
+	ExpectDeepLink            bool     `yaml:"expectDeepLink,omitempty"`
+	DeepLinkHosts             []string `yaml:"deepLinkHosts,omitempty"`
+
+	// Level of requirement checked by the step, either MUST (default) or
+	// SHOULD.
+	Level Level `yaml:"level,omitempty"`
+
+	// Capture maps variable names to the path of a value in the json response
+	// body, e.g. "id", "driver.operator" or "0.id". Captured values can be
+	// used by later steps.
+	Capture map[string]string `yaml:"capture,omitempty"`
+}
+
+// ReadSuite reads a suite in YAML or JSON format
+func ReadSuite(r io.Reader) (*Suite, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var suite Suite
+
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("invalid suite file: %w", err)
+	}
+
+	return &suite, nil
+}
+
+// WriteSuite writes a suite in YAML format
+func WriteSuite(suite *Suite, w io.Writer) error {
+	data, err := yaml.Marshal(suite)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+
+	return err
+}
+
+// RunSuite runs all steps of the suite in order, and prints a single report
+// in given format. It returns an error if any assertion failed.
+func RunSuite(suite *Suite, verbose bool, format ReportFormat) error {
+	suiteReport, err := runSuite(suite, verbose, false)
+	if err != nil {
+		return err
+	}
+
+	if err := suiteReport.write(os.Stdout, format); err != nil {
+		return err
+	}
+
+	if suiteReport.hasErrors() {
+		return fmt.Errorf("❌ %d failed assertion(s) ", suiteReport.countErrors())
+	}
+
+	return nil
+}
+
+// runSuite runs all steps of a suite. conformance is true for the conformance
+// battery (see `Flags`).
+func runSuite(suite *Suite, verbose, conformance bool) (*SuiteReport, error) {
+	suiteReport := &SuiteReport{verbose: verbose}
+	vars := newVariables(suite.Variables)
+
+	for i, step := range suite.Steps {
+		if step.Level == "" {
+			step.Level = LevelMust
+		}
+
+		if !step.Level.isValid() {
+			return nil, fmt.Errorf("step %d (%s): invalid level %q", i+1, step.Name, step.Level)
+		}
+
+		report, err := runStep(suite, step, vars, conformance)
+		if err != nil {
+			return nil, fmt.Errorf("step %d (%s): %w", i+1, step.Name, err)
+		}
+
+		suiteReport.add(step, report)
+	}
+
+	return suiteReport, nil
+}
+
+func runStep(suite *Suite, step Step, vars variables, conformance bool) (*Report, error) {
+	req, err := step.makeRequest(suite, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	_, endpointInfo, err := endpoint.FromContext(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	flags := step.flags(endpointInfo, vars)
+	flags.conformance = conformance
+
+	report, err := testRequest(req, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	report.assertionResults = append(
+		report.assertionResults,
+		step.capture(report.response, vars)...,
+	)
+
+	return report, nil
+}
+
+// makeRequest makes the request described by the step, with endpoint
+// information stored in its context
+func (step Step) makeRequest(suite *Suite, vars variables) (*http.Request, error) {
+	method := step.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	body, err := step.body(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := makeRequestWithContext(
+		strings.ToUpper(method),
+		step.url(suite, vars),
+		body,
+		vars.expand(suite.APIKey),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	query := NewQuery()
+	for k, v := range step.Query {
+		query.SetParam(k, vars.expand(v))
+	}
+
+	AddQueryParameters(query, req)
+
+	return req, nil
+}
+
+func (step Step) url(suite *Suite, vars variables) string {
+	stepEndpoint := vars.expand(step.Endpoint)
+
+	if strings.HasPrefix(stepEndpoint, "http://") ||
+		strings.HasPrefix(stepEndpoint, "https://") {
+		return stepEndpoint
+	}
+
+	server := strings.TrimSuffix(vars.expand(suite.Server), "/")
+
+	return server + "/" + strings.TrimPrefix(stepEndpoint, "/")
+}
+
+func (step Step) body(vars variables) ([]byte, error) {
+	switch b := step.Body.(type) {
+	case nil:
+		return nil, nil
+
+	case string:
+		return []byte(vars.expand(b)), nil
+
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+
+		return []byte(vars.expand(string(data))), nil
+	}
+}
+
+func (step Step) flags(e endpoint.Info, vars variables) Flags {
+	flags := NewFlags()
+	flags.ExpectNonEmpty = step.ExpectNonEmpty
+	flags.ExpectedResponseCode = step.ExpectResponseCode
+	flags.ExpectedBookingStatus = api.BookingStatus(vars.expand(step.ExpectBookingStatus))
+	flags.ExpectAuthRequired = step.ExpectAuthRequired
+	flags.ExpectIDTokenVerified = step.ExpectIDTokenVerified
+	flags.IDTokenSecret = vars.expand(step.IDTokenSecret)
+
+	if step.IDTokenAudience != "" {
+		flags.IDTokenAudience = vars.expand(step.IDTokenAudience)
+	}
+
+	flags.ExpectTransitionsEnforced = step.ExpectTransitionsEnforced
+	flags.ExpectDeepLinkSupport = step.ExpectDeepLink
+
+	for _, host := range step.DeepLinkHosts {
+		flags.DeepLinkHosts = append(flags.DeepLinkHosts, vars.expand(host))
+	}
+
+	if flags.ExpectedResponseCode == 0 { // not set
+		flags.ExpectedResponseCode = defaultResponseCode(e)
+	}
+
+	return flags
+}
+
+// capture stores the values of the response described by `step.Capture` in
+// `vars`. There is one assertion result per captured variable.
+func (step Step) capture(response *http.Response, vars variables) []assert.Result {
+	if len(step.Capture) == 0 {
+		return nil
+	}
+
+	var (
+		results = []assert.Result{}
+		body    interface{}
+		bodyErr error
+	)
+
+	if response == nil {
+		bodyErr = errors.New("no response")
+	} else {
+		decoder := json.NewDecoder(response.Body)
+		decoder.UseNumber()
+		bodyErr = decoder.Decode(&body)
+	}
+
+	for _, name := range sortedKeys(step.Capture) {
+		path := step.Capture[name]
+		description := fmt.Sprintf("capture %q from %q", name, path)
+
+		if bodyErr != nil {
+			results = append(results, assert.NewAssertionResult(bodyErr, description))
+			continue
+		}
+
+		value, err := lookupPath(body, path)
+		if err == nil {
+			vars[name] = value
+		}
+
+		results = append(results, assert.NewAssertionResult(err, description))
+	}
+
+	return results
+}
+
+// lookupPath returns the value at a dot separated path (e.g. "0.driver.id")
+// in a decoded json value, as a string.
+func lookupPath(value interface{}, path string) (string, error) {
+	if path != "" {
+		for _, key := range strings.Split(path, ".") {
+			switch v := value.(type) {
+			case map[string]interface{}:
+				field, ok := v[key]
+				if !ok {
+					return "", fmt.Errorf("missing property %q in path %q", key, path)
+				}
+
+				value = field
+
+			case []interface{}:
+				index, err := strconv.Atoi(key)
+				if err != nil || index < 0 || index >= len(v) {
+					return "", fmt.Errorf("invalid index %q in path %q", key, path)
+				}
+
+				value = v[index]
+
+			default:
+				return "", fmt.Errorf("cannot look up %q in path %q", key, path)
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+
+	case json.Number:
+		return v.String(), nil
+
+	default:
+		data, err := json.Marshal(v)
+		return string(data), err
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// variables stores the values of suite variables during a run
+type variables map[string]string
+
+// newVariables initializes variables from initial values, which are
+// expanded.
+func newVariables(initial map[string]string) variables {
+	vars := variables{}
+
+	for _, name := range sortedKeys(initial) {
+		vars[name] = vars.expand(initial[name])
+	}
+
+	return vars
+}
+
+// expand replaces ${var} or $var in the string according to the variables,
+// the special "uuid" variable, or environment variables.
+func (vars variables) expand(s string) string {
+	return os.Expand(s, func(name string) string {
+		if value, ok := vars[name]; ok {
+			return value
+		}
+
+		if name == uuidVariable {
+			return uuid.NewString()
+		}
+
+		return os.Getenv(name)
+	})
+}
+
+const uuidVariable = "uuid"
+
+// defaultResponseCode returns the success status code of an endpoint
+func defaultResponseCode(e endpoint.Info) int {
+	switch e {
+	case endpoint.PostBookings, endpoint.PostMessages:
+		return http.StatusCreated
+
+	default:
+		return http.StatusOK
+	}
+}
+
+// NewStep returns the step testing a request with given flags and body.
+// Server information is stripped from the request URL.
+func NewStep(name string, request *http.Request, flags Flags, body []byte) (Step, error) {
+	server, _, err := endpoint.FromRequest(request)
+	if err != nil {
+		return Step{}, err
+	}
+
+	step := Step{
+		Name:                      name,
+		Method:                    request.Method,
+		Endpoint:                  strings.TrimPrefix(request.URL.String(), string(server)),
+		ExpectResponseCode:        flags.ExpectedResponseCode,
+		ExpectNonEmpty:            flags.ExpectNonEmpty,
+		ExpectBookingStatus:       string(flags.ExpectedBookingStatus),
+		ExpectAuthRequired:        flags.ExpectAuthRequired,
+		ExpectIDTokenVerified:     flags.ExpectIDTokenVerified,
+		IDTokenSecret:             flags.IDTokenSecret,
+		ExpectTransitionsEnforced: flags.ExpectTransitionsEnforced,
+		ExpectDeepLink:            flags.ExpectDeepLinkSupport,
+		DeepLinkHosts:             flags.DeepLinkHosts,
+	}
+
+	if flags.ExpectIDTokenVerified {
+		step.IDTokenAudience = flags.IDTokenAudience
+	}
+
+	if body != nil {
+		step.Body = string(body)
+	}
+
+	return step, nil
+}
@@ -0,0 +1,323 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/endpoint"
+	"github.com/fabmob/playground-standard-covoiturage/cmd/util"
+	"github.com/labstack/echo/v4"
+)
+
+func TestReadSuite(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+	}{
+		{
+			"yaml",
+			`
+server: http://localhost:1323
+apiKey: key
+steps:
+  - name: step
+    method: POST
+    endpoint: /bookings
+    query:
+      count: 1
+    body:
+      id: "1234"
+    expectResponseCode: 400
+    expectNonEmpty: true
+    expectBookingStatus: CONFIRMED
+`,
+		},
+		{
+			"json",
+			`{
+  "server": "http://localhost:1323",
+  "apiKey": "key",
+  "steps": [
+    {
+      "name": "step",
+      "method": "POST",
+      "endpoint": "/bookings",
+      "query": {"count": 1},
+      "body": {"id": "1234"},
+      "expectResponseCode": 400,
+      "expectNonEmpty": true,
+      "expectBookingStatus": "CONFIRMED"
+    }
+  ]
+}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			suite, err := ReadSuite(strings.NewReader(tc.input))
+			util.PanicIf(err)
+
+			if suite.Server != "http://localhost:1323" || suite.APIKey != "key" {
+				t.Errorf("wrong suite properties: %+v", suite)
+			}
+
+			if len(suite.Steps) != 1 {
+				t.Fatalf("expected a single step, got %d", len(suite.Steps))
+			}
+
+			step := suite.Steps[0]
+			if step.Method != http.MethodPost || step.Endpoint != "/bookings" ||
+				step.Query["count"] != "1" || step.ExpectResponseCode != 400 ||
+				!step.ExpectNonEmpty || step.ExpectBookingStatus != "CONFIRMED" {
+				t.Errorf("wrong step properties: %+v", step)
+			}
+
+			body, err := step.body(variables{})
+			util.PanicIf(err)
+
+			if string(body) != `{"id":"1234"}` {
+				t.Errorf("wrong step body: %s", body)
+			}
+		})
+	}
+}
+
+func TestStepURL(t *testing.T) {
+	t.Setenv("TEST_SERVER", "http://example.com")
+
+	testCases := []struct {
+		server      string
+		endpoint    string
+		expectedURL string
+	}{
+		{"http://localhost:1323", "/status", "http://localhost:1323/status"},
+		{"http://localhost:1323/", "status", "http://localhost:1323/status"},
+		{"$TEST_SERVER", "/status", "http://example.com/status"},
+		{"http://localhost:1323", "$TEST_SERVER/status", "http://example.com/status"},
+		{"", "https://example.com/bookings/1", "https://example.com/bookings/1"},
+	}
+
+	for _, tc := range testCases {
+		step := Step{Endpoint: tc.endpoint}
+
+		if got := step.url(&Suite{Server: tc.server}, variables{}); got != tc.expectedURL {
+			t.Errorf("expected URL %s, got %s", tc.expectedURL, got)
+		}
+	}
+}
+
+func TestStepFlags(t *testing.T) {
+	testCases := []struct {
+		step         Step
+		endpoint     endpoint.Info
+		expectedCode int
+	}{
+		{Step{}, endpoint.GetDriverJourneys, http.StatusOK},
+		{Step{}, endpoint.PostBookings, http.StatusCreated},
+		{Step{}, endpoint.PostMessages, http.StatusCreated},
+		{Step{ExpectResponseCode: 404}, endpoint.GetBookings, http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		flags := tc.step.flags(tc.endpoint, variables{})
+		if flags.ExpectedResponseCode != tc.expectedCode {
+			t.Errorf("%s: expected response code %d, got %d", tc.endpoint,
+				tc.expectedCode, flags.ExpectedResponseCode)
+		}
+	}
+}
+
+func TestStepDeepLinkFlags(t *testing.T) {
+	step := Step{ExpectDeepLink: true, DeepLinkHosts: []string{"${host}", "operator.com"}}
+
+	flags := step.flags(endpoint.GetDriverJourneys, variables{"host": "www.operator.com"})
+
+	if !flags.ExpectDeepLinkSupport {
+		t.Error("expected deep link support")
+	}
+
+	if len(flags.DeepLinkHosts) != 2 || flags.DeepLinkHosts[0] != "www.operator.com" {
+		t.Errorf("expected expanded deep link hosts, got %v", flags.DeepLinkHosts)
+	}
+}
+
+func TestRunSuite(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			_, _ = w.Write([]byte("[]"))
+		},
+	))
+	defer server.Close()
+
+	query := map[string]string{
+		"departureLat":  "0",
+		"departureLng":  "0",
+		"arrivalLat":    "0",
+		"arrivalLng":    "0",
+		"departureDate": "0",
+	}
+
+	testCases := []struct {
+		name        string
+		steps       []Step
+		expectError bool
+	}{
+		{
+			"successful steps",
+			[]Step{
+				{Endpoint: "/driver_journeys", Query: query},
+				{Endpoint: "/passenger_journeys", Query: query},
+			},
+			false,
+		},
+		{
+			"failing step",
+			[]Step{
+				{Endpoint: "/driver_journeys", Query: query},
+				{Endpoint: "/driver_journeys", Query: query, ExpectNonEmpty: true},
+			},
+			true,
+		},
+		{
+			"unknown endpoint",
+			[]Step{{Endpoint: "/unknown"}},
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			suite := &Suite{Server: server.URL, Steps: tc.steps}
+
+			err := RunSuite(suite, false, ReportText)
+			if (err != nil) != tc.expectError {
+				t.Errorf("expected error: %t, got %s", tc.expectError, err)
+			}
+		})
+	}
+}
+
+func TestVariablesExpand(t *testing.T) {
+	t.Setenv("TEST_VAR", "env")
+
+	vars := newVariables(map[string]string{"a": "${TEST_VAR}-a", "b": "b"})
+	vars["b"] = "captured"
+
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"${a}", "env-a"},
+		{"/bookings/$b", "/bookings/captured"},
+		{"${TEST_VAR}", "env"},
+		{"${missing}", ""},
+		{"no variable", "no variable"},
+	}
+
+	for _, tc := range testCases {
+		if got := vars.expand(tc.input); got != tc.expected {
+			t.Errorf("expanding %q: expected %q, got %q", tc.input, tc.expected, got)
+		}
+	}
+
+	if vars.expand("${uuid}") == vars.expand("${uuid}") {
+		t.Error("expected a new UUID on each expansion")
+	}
+}
+
+func TestLookupPath(t *testing.T) {
+	body := `[{"id": "1", "price": {"amount": 1.5}, "driver": {"id": "2"}}]`
+
+	testCases := []struct {
+		path        string
+		expected    string
+		expectError bool
+	}{
+		{"0.id", "1", false},
+		{"0.driver.id", "2", false},
+		{"0.price.amount", "1.5", false},
+		{"0.driver", `{"id":"2"}`, false},
+		{"0.missing", "", true},
+		{"1.id", "", true},
+		{"0.id.id", "", true},
+	}
+
+	for _, tc := range testCases {
+		response := &http.Response{Body: io.NopCloser(strings.NewReader(body))}
+		step := Step{Capture: map[string]string{"v": tc.path}}
+		vars := variables{}
+
+		results := step.capture(response, vars)
+		if len(results) != 1 {
+			t.Fatalf("expected one capture result, got %d", len(results))
+		}
+
+		if (results[0].Unwrap() != nil) != tc.expectError {
+			t.Errorf("path %q: expected error: %t, got %s", tc.path, tc.expectError, results[0].Unwrap())
+		}
+
+		if vars["v"] != tc.expected {
+			t.Errorf("path %q: expected value %q, got %q", tc.path, tc.expected, vars["v"])
+		}
+	}
+}
+
+func TestRunSuiteWithCapture(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			_, _ = w.Write([]byte(`{"status": "ok"}`))
+		},
+	))
+	defer server.Close()
+
+	testCases := []struct {
+		name        string
+		capture     map[string]string
+		expectError bool
+	}{
+		{"existing property", map[string]string{"status": "status"}, false},
+		{"missing property", map[string]string{"status": "missing"}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			suite := &Suite{
+				Server: server.URL,
+				Steps: []Step{
+					{Endpoint: "/status", Capture: tc.capture},
+				},
+			}
+
+			err := RunSuite(suite, false, ReportText)
+			if (err != nil) != tc.expectError {
+				t.Errorf("expected error: %t, got %s", tc.expectError, err)
+			}
+		})
+	}
+}
+
+func TestScenarios(t *testing.T) {
+	names := ScenarioNames()
+	if len(names) == 0 {
+		t.Fatal("expected built-in scenarios")
+	}
+
+	for _, name := range names {
+		suite, err := Scenario(name)
+		if err != nil {
+			t.Errorf("scenario %s: %s", name, err)
+		} else if len(suite.Steps) == 0 {
+			t.Errorf("scenario %s has no steps", name)
+		}
+	}
+
+	if _, err := Scenario("unknown"); err == nil {
+		t.Error("expected an error for an unknown scenario")
+	}
+}
@@ -25,11 +25,50 @@ func testGetDriverJourneys(
 	a assert.Accumulator,
 	flags Flags,
 ) {
+	testJourneys(request, response, a, flags)
 
+	if !isSuccessfulSearch(flags) {
+		return
+	}
+
+	assert.DriverJourneysDates(a, response)
+	assert.DriverJourneysDurationDistance(a, response)
+	assert.DriverJourneysWalking(a, response)
+	assert.DriverJourneysPolyline(a, response)
+}
+
+func testGetPassengerJourneys(
+	request *http.Request,
+	response *http.Response,
+	a assert.Accumulator,
+	flags Flags,
+) {
+	testJourneys(request, response, a, flags)
+
+	if !isSuccessfulSearch(flags) {
+		return
+	}
+
+	assert.PassengerJourneysPassenger(a, response)
+	assert.PassengerJourneysRequestedSeats(a, response)
+	assert.NoDriverProperties(a, response)
+}
+
+// testJourneys runs the assertions common to driver and passenger journeys
+func testJourneys(
+	request *http.Request,
+	response *http.Response,
+	a assert.Accumulator,
+	flags Flags,
+) {
 	assert.CriticFormat(a, request, response)
-	assert.StatusCode(a, response, flags.ExpectedResponseCode)
+	searchStatusCode(a, response, flags)
 	assert.HeaderContains(a, response, echo.HeaderContentType, echo.MIMEApplicationJSON)
 
+	if !isSuccessfulSearch(flags) {
+		return
+	}
+
 	if flags.ExpectNonEmpty {
 		assert.CriticArrayNotEmpty(a, response)
 	}
@@ -40,16 +79,10 @@ func testGetDriverJourneys(
 	assert.JourneysCount(a, request, response)
 	assert.UniqueIDs(a, response)
 	assert.OperatorFieldFormat(a, response)
-}
 
-func testGetPassengerJourneys(
-	request *http.Request,
-	response *http.Response,
-	a assert.Accumulator,
-	flags Flags,
-) {
-	// Passenger journeys are very similar to driver journeys.
-	testGetDriverJourneys(request, response, a, flags)
+	if flags.ExpectDeepLinkSupport {
+		assert.DeepLinks(a, response, flags.DeepLinkHosts)
+	}
 }
 
 func testGetDriverRegularTrips(
@@ -59,7 +92,11 @@ func testGetDriverRegularTrips(
 	flags Flags,
 ) {
 	assert.CriticFormat(a, request, response)
-	assert.StatusCode(a, response, flags.ExpectedResponseCode)
+	searchStatusCode(a, response, flags)
+
+	if !isSuccessfulSearch(flags) {
+		return
+	}
 
 	if flags.ExpectNonEmpty {
 		assert.CriticArrayNotEmpty(a, response)
@@ -67,8 +104,13 @@ func testGetDriverRegularTrips(
 
 	assert.JourneysDepartureRadius(a, request, response)
 	assert.JourneysArrivalRadius(a, request, response)
+	assert.RegularTripsSchedules(a, request, response)
 	assert.JourneysCount(a, request, response)
 	assert.OperatorFieldFormat(a, response)
+
+	if flags.ExpectDeepLinkSupport {
+		assert.DeepLinks(a, response, flags.DeepLinkHosts)
+	}
 }
 
 func testGetPassengerRegularTrips(
@@ -77,14 +119,28 @@ func testGetPassengerRegularTrips(
 	a assert.Accumulator,
 	flags Flags,
 ) {
-	assert.CriticFormat(a, request, response)
-	assert.StatusCode(a, response, flags.ExpectedResponseCode)
+	// Passenger regular trips are very similar to driver regular trips.
+	testGetDriverRegularTrips(request, response, a, flags)
+}
 
-	if flags.ExpectNonEmpty {
-		assert.CriticArrayNotEmpty(a, response)
+// searchStatusCode checks the status code of a search. It is critic in the
+// conformance battery only, so that a failed search does not skip the other
+// assertions of the `test` command.
+func searchStatusCode(a assert.Accumulator, response *http.Response, flags Flags) {
+	if flags.conformance {
+		assert.CriticStatusCode(a, response, flags.ExpectedResponseCode)
+	} else {
+		assert.StatusCode(a, response, flags.ExpectedResponseCode)
 	}
 }
 
+// isSuccessfulSearch returns false if a search of the conformance battery is
+// expected to fail: other assertions on search results do not apply to error
+// responses.
+func isSuccessfulSearch(flags Flags) bool {
+	return !flags.conformance || flags.ExpectedResponseCode == http.StatusOK
+}
+
 //////////////////////////////////////////////////////////////
 // Tag "Webhooks"
 //////////////////////////////////////////////////////////////
@@ -97,6 +153,10 @@ func testPostBookingEvents(
 ) {
 	assert.CriticFormat(a, request, response)
 	assert.StatusCode(a, response, flags.ExpectedResponseCode)
+
+	if flags.ExpectIDTokenVerified {
+		assert.InvalidIDTokenRejected(a, request, flags.IDTokenSecret, flags.IDTokenAudience)
+	}
 }
 
 //////////////////////////////////////////////////////////////
@@ -121,6 +181,11 @@ func testPostBookings(
 ) {
 	assert.CriticFormat(a, request, response)
 	assert.StatusCode(a, response, flags.ExpectedResponseCode)
+
+	if flags.ExpectedResponseCode == http.StatusCreated {
+		testBooking(response, a, flags)
+		assert.BookingEchoed(a, request, response)
+	}
 }
 
 func testPatchBookings(
@@ -131,6 +196,10 @@ func testPatchBookings(
 ) {
 	assert.CriticFormat(a, request, response)
 	assert.StatusCode(a, response, flags.ExpectedResponseCode)
+
+	if flags.ExpectTransitionsEnforced {
+		assert.IllegalTransitionsRejected(a, request, response)
+	}
 }
 
 // testGetBookings currently assumes that the request returns a 200 response.
@@ -147,6 +216,22 @@ func testGetBookings(
 	if flags.ExpectedBookingStatus != "" {
 		assert.BookingStatus(a, response, string(flags.ExpectedBookingStatus))
 	}
+
+	if flags.ExpectedResponseCode == http.StatusOK {
+		testBooking(response, a, flags)
+	}
+}
+
+// testBooking checks the semantics of a booking returned by GET or POST
+// /bookings
+func testBooking(response *http.Response, a assert.Accumulator, flags Flags) {
+	assert.BookingPaying(a, response)
+	assert.BookingPriceAmount(a, response)
+	assert.BookingOperatorsFormat(a, response)
+
+	if flags.ExpectDeepLinkSupport {
+		assert.BookingWebURL(a, response, flags.DeepLinkHosts)
+	}
 }
 
 //////////////////////////////////////////////////////////////
@@ -2,6 +2,7 @@ package test
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/fabmob/playground-standard-covoiturage/cmd/api"
 	"github.com/fabmob/playground-standard-covoiturage/cmd/endpoint"
@@ -44,12 +45,41 @@ func executeTestFun(
 ) *Report {
 	var all = []assert.Result{}
 
-	all = append(all, wrapTestResponseFun(testFun)(client, request, flags)...)
+	recorder := &responseRecorder{HttpRequestDoer: client.Client}
+	client.Client = recorder
+
+	recordErr := recordTest(client, flags, func() {
+		all = append(all, wrapTestResponseFun(testFun)(client, request, flags)...)
+	})
+	if recordErr != nil {
+		all = append(all, assert.NewAssertionResult(recordErr, "record request and response"))
+	}
+
 	report := NewReport(request, all...)
+	report.response = recorder.response
+	report.duration = recorder.duration
 
 	return &report
 }
 
+// responseRecorder is an api.HttpRequestDoer which keeps the last response
+// and its timing, so that they can be inspected after the test (e.g. to
+// capture values).
+type responseRecorder struct {
+	api.HttpRequestDoer
+	response *http.Response
+	duration time.Duration
+}
+
+func (r *responseRecorder) Do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	response, err := r.HttpRequestDoer.Do(req)
+	r.duration = time.Since(start)
+	r.response = response
+
+	return response, err
+}
+
 /////////////////////////////////////////////////////////////
 
 // A requestTestFun runs all tests associated with a given Request, and
@@ -95,6 +125,10 @@ func wrapTestImplementation(f testImplementation) ResponseTestFun {
 
 		f(req, resp, a, flags)
 
+		if flags.ExpectAuthRequired {
+			assert.UnauthenticatedRejected(a, req)
+		}
+
 		a.ExecuteAll()
 
 		return a.GetAssertionResults()
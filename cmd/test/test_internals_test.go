@@ -102,3 +102,34 @@ func cmpRequests(t *testing.T, req1, req2 *http.Request) bool {
 		cmp.Equal(req1.Header, req2.Header) &&
 		bodyString[0] == bodyString[1]
 }
+
+func TestSearchStatusCode(t *testing.T) {
+	request, err := makeRequestWithContext(http.MethodGet,
+		"http://localhost:1323/driver_journeys?departureLat=0&departureLng=0&arrivalLat=0&arrivalLng=0&departureDate=0",
+		nil, "")
+	util.PanicIf(err)
+
+	countResults := func(conformance bool) int {
+		response := &http.Response{
+			StatusCode: http.StatusBadRequest,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"error": "bad request"}`)),
+		}
+
+		flags := NewFlags()
+		flags.conformance = conformance
+
+		a := assert.NewAccumulator()
+		testGetDriverJourneys(request, response, a, flags)
+		a.ExecuteAll()
+
+		return len(a.GetAssertionResults())
+	}
+
+	// A failed search does not skip the other assertions of the `test`
+	// command, only of the conformance battery
+	if withTest, withConformance := countResults(false), countResults(true); withTest <= withConformance {
+		t.Errorf("expected more assertions with the test command (%d) than in the conformance battery (%d)",
+			withTest, withConformance)
+	}
+}
@@ -58,6 +58,7 @@ type MockRunner struct {
 	Query   Query
 	Body    []byte
 	Verbose bool
+	Format  ReportFormat
 	APIKey  string
 	Flags   Flags
 }
@@ -69,6 +70,7 @@ func (mr *MockRunner) Run(
 	query Query,
 	body []byte,
 	verbose bool,
+	format ReportFormat,
 	apiKey string,
 	flags Flags,
 ) error {
@@ -76,6 +78,7 @@ func (mr *MockRunner) Run(
 	mr.Method = method
 	mr.URL = URL
 	mr.Verbose = verbose
+	mr.Format = format
 	mr.Query = query
 	mr.Body = body
 	mr.APIKey = apiKey
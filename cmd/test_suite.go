@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/fabmob/playground-standard-covoiturage/cmd/test"
+	"github.com/spf13/cobra"
+)
+
+var suiteVariables map[string]string
+
+// suiteCmd represents the test suite command
+var suiteCmd = &cobra.Command{
+	Use:   "suite <file>",
+	Short: "Run a suite of tests described in a YAML or JSON file",
+	Long: `Run a suite of tests described in a YAML or JSON file.
+
+The file lists steps, each with method, endpoint, query, body and
+expectations. All steps are run in order and a single report is printed.
+
+Steps can capture values from responses (e.g. a booking id) into variables,
+which are used by later steps as "${name}".`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		file, err := os.Open(args[0])
+		exitWithError(err)
+
+		suite, err := test.ReadSuite(file)
+		file.Close()
+		exitWithError(err)
+
+		runSuite(suite)
+	},
+}
+
+// scenarioCmd represents the test scenario command
+var scenarioCmd = &cobra.Command{
+	Use:       "scenario <name>",
+	Short:     "Run a built-in test scenario",
+	Long:      "Run a built-in test scenario. Available scenarios are: " + strings.Join(test.ScenarioNames(), ", "),
+	Args:      cobra.ExactValidArgs(1),
+	ValidArgs: test.ScenarioNames(),
+	Run: func(cmd *cobra.Command, args []string) {
+		suite, err := test.Scenario(args[0])
+		exitWithError(err)
+
+		runSuite(suite)
+	},
+}
+
+// runSuite runs a suite, with properties overridden by command line flags
+func runSuite(suite *test.Suite) {
+	if server != "" {
+		suite.Server = server
+	}
+
+	if apiKey != "" {
+		suite.APIKey = apiKey
+	}
+
+	setSuiteVariables(suite)
+	startRecording()
+
+	err := test.RunSuite(suite, verbose, reportFormat)
+	exitWithError(err)
+}
+
+// setSuiteVariables overrides suite variables with the ones set with the
+// --var flag
+func setSuiteVariables(suite *test.Suite) {
+	if len(suiteVariables) > 0 && suite.Variables == nil {
+		suite.Variables = map[string]string{}
+	}
+
+	for name, value := range suiteVariables {
+		suite.Variables[name] = value
+	}
+}
+
+// replayCmd represents the test replay command
+var replayCmd = &cobra.Command{
+	Use:   "replay <dir>",
+	Short: "Replay offline the tests recorded with --record",
+	Long: `Replay offline the tests recorded with --record.
+
+All assertions are run again against the recorded responses, in the order of
+the recording, and a single report is printed. The additional requests of
+assertions (e.g. the same request without API key) get their recorded
+responses: no request is sent.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := test.Replay(args[0], verbose, reportFormat)
+		exitWithError(err)
+	},
+}
+
+func init() {
+	testCmd.AddCommand(replayCmd)
+
+	for _, cmd := range []*cobra.Command{suiteCmd, scenarioCmd} {
+		cmd.Flags().StringVar(&server, "server", "", "Server on which to run the suite, overrides the one of the suite file")
+		cmd.Flags().StringToStringVar(&suiteVariables, "var", nil, "Set a suite variable, e.g. --var operator=carpool.mycity.com")
+		testCmd.AddCommand(cmd)
+	}
+}